@@ -0,0 +1,262 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binlog implements a compact binary encoding of log entries. plog
+// writes it into log files with -logging_format=binary. It avoids the
+// cost of formatting values as text: numbers, time stamps and durations are
+// stored in binary form, only values without a more specific type get
+// serialized as JSON.
+//
+// The Reader decodes such a file. Records can be converted back into the
+// klog text format or the JSON format with WriteText and WriteJSON. The
+// plogcat command does that for entire files.
+//
+// # Encoding
+//
+// A file is a sequence of items. Each item starts with one byte for the kind
+// of item, followed by the length of the payload as 32 bit unsigned integer
+// in little endian byte order and the payload:
+//
+//   - 0x01: file header with the creation time, host name and
+//     information about the binary, written at the start of each file.
+//   - 0x02: log entry.
+//   - 0x03: output which is not a log entry, for example the stack traces
+//     that get written when exiting because of a fatal error.
+//
+// Inside a payload, integers are stored as varints (signed integers in
+// zig-zag encoding), strings and byte slices as length followed by the bytes
+// and time stamps as seconds since the Unix epoch and nanoseconds, followed
+// by the offset and name of the time zone. A log entry contains the time
+// stamp, severity, verbosity, flags, thread ID, file, line, message and the
+// number of key/value pairs, followed by those pairs. Each value starts with
+// a byte for its type.
+//
+// Readers must reject items of unknown kind and values of unknown type.
+// Future revisions of the format may add new kinds and types.
+package binlog
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/serialize"
+	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// Kinds of items.
+const (
+	kindFileHeader byte = 0x01
+	kindRecord     byte = 0x02
+	kindText       byte = 0x03
+)
+
+// Types of values.
+const (
+	typeNil byte = iota
+	typeFalse
+	typeTrue
+	typeInt
+	typeUint
+	typeFloat32
+	typeFloat64
+	typeString
+	typeBytes
+	typeTime
+	typeDuration
+	typeJSON
+)
+
+// Record flags.
+const (
+	flagStructured byte = 1 << iota
+)
+
+// maxItemSize limits how much memory the Reader allocates for one item.
+const maxItemSize = 64 * 1024 * 1024
+
+// IsBinary returns true if the data is the beginning of a file in the binary
+// encoding. Text logs never start with the bytes used for the kinds of
+// items.
+func IsBinary(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	switch data[0] {
+	case kindFileHeader, kindRecord, kindText:
+		return true
+	default:
+		return false
+	}
+}
+
+// FileHeader has the same information as the text lines at the start of a
+// log file in the text format.
+type FileHeader struct {
+	Created time.Time
+	Host    string
+	// Binary describes how the program was built, for example "Built
+	// with gc go1.22.0 for linux/amd64".
+	Binary string
+}
+
+// Record is one decoded item.
+type Record struct {
+	// Text is set for output which is not a log entry, like stack
+	// traces. All other fields are empty then.
+	Text string
+
+	Time     time.Time
+	Severity textparser.Severity
+	// Verbosity is the level of structured info messages, -1 otherwise.
+	Verbosity int
+	ThreadID  int
+	File      string
+	Line      int
+
+	// Structured is true for entries which were logged with a message
+	// and key/value pairs. The Message of other entries is the text
+	// produced by fmt.Sprint or fmt.Sprintf.
+	Structured bool
+	Message    string
+	Values     []KeyValue
+}
+
+// KeyValue is one key/value pair. The type of Value is one of nil, bool,
+// int64, uint64, float32, float64, string, []byte, time.Time, time.Duration
+// or JSON. Other types were converted when encoding: errors and
+// fmt.Stringer implementations into strings, logr.Marshaler into the result
+// of MarshalLog and everything else into JSON.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// JSON is a value which was stored as JSON. It gets formatted as it is, in
+// the text format as well as in the JSON format.
+type JSON []byte
+
+// MarshalJSON implements json.Marshaler.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	return j, nil
+}
+
+// WriteText writes the record in the klog text format, including the
+// trailing line break.
+func (r Record) WriteText(b *bytes.Buffer) {
+	if r.Text != "" {
+		b.WriteString(r.Text)
+		return
+	}
+	b.WriteByte(severity.Char[r.severity()])
+	b.WriteString(r.Time.Format("0102 15:04:05.000000"))
+	b.WriteByte(' ')
+	id := strconv.Itoa(r.ThreadID)
+	for i := len(id); i < 7; i++ {
+		b.WriteByte(' ')
+	}
+	b.WriteString(id)
+	b.WriteByte(' ')
+	b.WriteString(r.File)
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(r.Line))
+	b.WriteString("] ")
+	if !r.Structured {
+		b.WriteString(r.Message)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteString(strconv.Quote(r.Message))
+	for _, kv := range r.Values {
+		serialize.KVFormat(b, kv.Key, kv.Value)
+	}
+	b.WriteByte('\n')
+}
+
+// WriteJSON writes the record in the same JSON format as
+// -logging_format=json, including the trailing line break. Records with
+// Text become an object with only a "text" field.
+func (r Record) WriteJSON(b *bytes.Buffer) {
+	if r.Text != "" {
+		b.WriteString(`{"text":`)
+		serialize.JSONString(b, r.Text)
+		b.WriteString("}\n")
+		return
+	}
+	serialize.JSONHeader(b, r.Time, r.severity(), r.Verbosity, r.File, r.Line, r.Message)
+	for _, kv := range r.Values {
+		serialize.JSONFormat(b, kv.Key, kv.Value)
+	}
+	b.WriteString("}\n")
+}
+
+func (r Record) severity() severity.Severity {
+	if r.Severity < textparser.SeverityInfo || r.Severity > textparser.SeverityFatal {
+		return severity.InfoLog
+	}
+	return r.Severity
+}
+
+// Get returns the first key/value pair with the key.
+func (r Record) Get(key string) (KeyValue, bool) {
+	for _, kv := range r.Values {
+		if kv.Key == key {
+			return kv, true
+		}
+	}
+	return KeyValue{}, false
+}
+
+// TextRecord converts the record into the representation used by the
+// textparser package. Strings are stored as they are, all other values as
+// JSON. Text becomes the message of a record without header, without the
+// trailing line break.
+func (r Record) TextRecord() textparser.Record {
+	if r.Text != "" {
+		return textparser.Record{Severity: textparser.SeverityInfo, Message: strings.TrimSuffix(r.Text, "\n")}
+	}
+	record := textparser.Record{
+		HasHeader:  true,
+		Severity:   r.Severity,
+		Time:       r.Time,
+		ThreadID:   r.ThreadID,
+		File:       r.File,
+		Line:       r.Line,
+		Message:    r.Message,
+		Structured: r.Structured,
+	}
+	for _, kv := range r.Values {
+		value := textparser.KeyValue{Key: kv.Key}
+		switch v := kv.Value.(type) {
+		case string:
+			value.Kind = textparser.KindString
+			if strings.Contains(v, "\n") {
+				value.Kind = textparser.KindMultiLine
+			}
+			value.Value = v
+		case JSON:
+			value.Kind = textparser.KindRaw
+			value.Value = string(v)
+		default:
+			var b bytes.Buffer
+			serialize.JSONValue(&b, v)
+			value.Kind = textparser.KindRaw
+			value.Value = b.String()
+		}
+		record.Values = append(record.Values, value)
+	}
+	return record
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+type marshaler struct{}
+
+func (marshaler) MarshalLog() interface{} { return 42 }
+
+type object struct {
+	Name string `json:"name"`
+}
+
+func TestValues(t *testing.T) {
+	zone := time.FixedZone("CEST", 2*60*60)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 67890, zone)
+	for name, tc := range map[string]struct {
+		value    interface{}
+		expected interface{}
+		text     string
+		json     string
+	}{
+		"nil":      {value: nil, expected: nil, text: "null", json: "null"},
+		"true":     {value: true, expected: true, text: "true", json: "true"},
+		"false":    {value: false, expected: false, text: "false", json: "false"},
+		"int":      {value: -1, expected: int64(-1), text: "-1", json: "-1"},
+		"int8":     {value: int8(-8), expected: int64(-8), text: "-8", json: "-8"},
+		"uint":     {value: uint(1), expected: uint64(1), text: "1", json: "1"},
+		"uint64":   {value: uint64(1 << 63), expected: uint64(1 << 63), text: "9223372036854775808", json: "9223372036854775808"},
+		"float32":  {value: float32(0.1), expected: float32(0.1), text: "0.1", json: "0.1"},
+		"float64":  {value: 1.5, expected: 1.5, text: "1.5", json: "1.5"},
+		"string":   {value: "x y", expected: "x y", text: `"x y"`, json: `"x y"`},
+		"bytes":    {value: []byte("abc"), expected: []byte("abc"), text: `"abc"`, json: `"YWJj"`},
+		"time":     {value: now, expected: now, text: `"2006-01-02 15:04:05.00006789 +0200 CEST"`, json: `"2006-01-02 15:04:05.00006789 +0200 CEST"`},
+		"zero":     {value: time.Time{}, expected: time.Time{}.In(time.FixedZone("UTC", 0)), text: `"0001-01-01 00:00:00 +0000 UTC"`, json: `"0001-01-01 00:00:00 +0000 UTC"`},
+		"duration": {value: time.Minute, expected: time.Minute, text: `"1m0s"`, json: `"1m0s"`},
+		"error":    {value: errors.New("fail"), expected: "fail", text: `"fail"`, json: `"fail"`},
+		"stringer": {value: stringer{}, expected: "stringer", text: `"stringer"`, json: `"stringer"`},
+		"marshal":  {value: marshaler{}, expected: int64(42), text: "42", json: "42"},
+		"object":   {value: object{Name: "x"}, expected: JSON(`{"name":"x"}`), text: `{"name":"x"}`, json: `{"name":"x"}`},
+		"map":      {value: map[string]int{"a": 1}, expected: JSON(`{"a":1}`), text: `{"a":1}`, json: `{"a":1}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var b bytes.Buffer
+			AppendRecord(&b, Record{Time: now, Structured: true, Message: "msg"}, "key", tc.value)
+			record, err := NewReader(&b).Next()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(record.Values) != 1 {
+				t.Fatalf("expected one value, got %+v", record.Values)
+			}
+			actual := record.Values[0].Value
+			if actualTime, ok := actual.(time.Time); ok {
+				if expectedTime := tc.expected.(time.Time); !actualTime.Equal(expectedTime) || actualTime.String() != expectedTime.String() {
+					t.Errorf("expected %s, got %s", expectedTime, actualTime)
+				}
+			} else if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("expected %T %v, got %T %v", tc.expected, tc.expected, actual, actual)
+			}
+
+			var text, json bytes.Buffer
+			record.WriteText(&text)
+			record.WriteJSON(&json)
+			if expected := ` "msg" key=` + tc.text + "\n"; !strings.HasSuffix(text.String(), expected) {
+				t.Errorf("expected text output ending in %q, got %q", expected, text.String())
+			}
+			if expected := `"msg":"msg","key":` + tc.json + "}\n"; !strings.HasSuffix(json.String(), expected) {
+				t.Errorf("expected JSON output ending in %q, got %q", expected, json.String())
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	now := time.Date(2006, 1, 2, 15, 4, 5, 67890000, time.UTC)
+	var b bytes.Buffer
+	AppendFileHeader(&b, FileHeader{Created: now, Host: "host", Binary: "Built with gc"})
+	AppendRecord(&b, Record{
+		Time:       now,
+		Severity:   textparser.SeverityWarning,
+		Verbosity:  -1,
+		ThreadID:   1234,
+		File:       "main.go",
+		Line:       42,
+		Structured: true,
+		Message:    "hello",
+		Values:     []KeyValue{{Key: "err", Value: "fail"}},
+	}, "a", 1, "missing")
+	AppendRecord(&b, Record{Time: now, Verbosity: -1, File: "main.go", Line: 43, Message: "printf"})
+	AppendText(&b, []byte("goroutine 1 [running]:\n"))
+
+	if !IsBinary(b.Bytes()) {
+		t.Error("expected data to be detected as binary")
+	}
+	var text, json bytes.Buffer
+	var records []textparser.Record
+	reader := NewReader(&b)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		record.WriteText(&text)
+		record.WriteJSON(&json)
+		records = append(records, record.TextRecord())
+	}
+	if header := reader.Header(); header.Host != "host" || header.Binary != "Built with gc" || !header.Created.Equal(now) {
+		t.Errorf("unexpected file header: %+v", header)
+	}
+
+	expected := `W0102 15:04:05.067890    1234 main.go:42] "hello" err="fail" a=1 missing="(MISSING)"
+I0102 15:04:05.067890       0 main.go:43] printf
+goroutine 1 [running]:
+`
+	if text.String() != expected {
+		t.Errorf("unexpected text output:\n%s\nexpected:\n%s", text.String(), expected)
+	}
+	expected = `{"ts":"2006-01-02T15:04:05.067890Z","severity":"WARNING","caller":"main.go:42","msg":"hello","err":"fail","a":1,"missing":"(MISSING)"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","caller":"main.go:43","msg":"printf"}
+{"text":"goroutine 1 [running]:\n"}
+`
+	if json.String() != expected {
+		t.Errorf("unexpected JSON output:\n%s\nexpected:\n%s", json.String(), expected)
+	}
+
+	// The textparser representation formats the same way.
+	var converted strings.Builder
+	for _, record := range records {
+		converted.WriteString(record.String())
+		converted.WriteByte('\n')
+	}
+	expected = `W0102 15:04:05.067890    1234 main.go:42] "hello" err="fail" a=1 missing="(MISSING)"
+I0102 15:04:05.067890       0 main.go:43] printf
+goroutine 1 [running]:
+`
+	if converted.String() != expected {
+		t.Errorf("unexpected textparser output:\n%s\nexpected:\n%s", converted.String(), expected)
+	}
+}
+
+func TestReaderGrowing(t *testing.T) {
+	var encoded bytes.Buffer
+	AppendRecord(&encoded, Record{Message: "first"})
+	AppendRecord(&encoded, Record{Message: "second"})
+	data := encoded.Bytes()
+
+	// Feed the input byte by byte.
+	var input bytes.Buffer
+	reader := NewReader(&input)
+	var messages []string
+	for i := 0; i <= len(data); i++ {
+		for {
+			record, err := reader.Next()
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("after %d bytes: unexpected error: %v", i, err)
+				}
+				break
+			}
+			messages = append(messages, record.Message)
+		}
+		if i < len(data) {
+			input.WriteByte(data[i])
+		}
+	}
+	if expected := []string{"first", "second"}; !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected messages %q, got %q", expected, messages)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	var valid bytes.Buffer
+	AppendRecord(&valid, Record{Message: "hello"}, "a", 1)
+	data := valid.Bytes()
+
+	for name, tc := range map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"unknown-kind": {
+			data:     []byte("I0102 15:04:05.067890"),
+			expected: "unknown kind of item 0x49",
+		},
+		"too-large": {
+			data:     []byte{kindRecord, 0xff, 0xff, 0xff, 0xff},
+			expected: fmt.Sprintf("item size %d exceeds the limit of %d bytes", uint32(0xffffffff), maxItemSize),
+		},
+		"truncated-payload": {
+			data:     append([]byte{kindRecord, byte(len(data) - 6), 0, 0, 0}, data[5:len(data)-1]...),
+			expected: "decode log entry: payload is truncated",
+		},
+		"unknown-type": {
+			data:     append(append([]byte{}, data[:len(data)-2]...), 0xff, 0),
+			expected: "decode log entry: unknown type of value 0xff",
+		},
+		"truncated-input": {
+			data:     data[:len(data)-1],
+			expected: io.ErrUnexpectedEOF.Error(),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tc.data)).Next()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tc.expected {
+				t.Errorf("expected error %q, got %q", tc.expected, err.Error())
+			}
+		})
+	}
+}
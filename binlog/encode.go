@@ -0,0 +1,200 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/internal/serialize"
+)
+
+// AppendFileHeader encodes a file header.
+func AppendFileHeader(b *bytes.Buffer, header FileHeader) {
+	start := beginItem(b, kindFileHeader)
+	appendTime(b, header.Created)
+	appendString(b, header.Host)
+	appendString(b, header.Binary)
+	endItem(b, start)
+}
+
+// AppendText encodes output which is not a log entry.
+func AppendText(b *bytes.Buffer, text []byte) {
+	start := beginItem(b, kindText)
+	b.Write(text)
+	endItem(b, start)
+}
+
+// AppendRecord encodes a log entry. The record's Text is ignored. Its Values
+// get encoded first, followed by the additional key/value pairs. Those may
+// have arbitrary types, see KeyValue for how they get stored. A missing value
+// is stored as "(MISSING)", like in the text format.
+func AppendRecord(b *bytes.Buffer, r Record, keysAndValues ...interface{}) {
+	start := beginItem(b, kindRecord)
+	appendTime(b, r.Time)
+	b.WriteByte(byte(r.Severity))
+	appendInt(b, int64(r.Verbosity))
+	var flags byte
+	if r.Structured {
+		flags |= flagStructured
+	}
+	b.WriteByte(flags)
+	appendUint(b, uint64(r.ThreadID))
+	appendString(b, r.File)
+	appendUint(b, uint64(r.Line))
+	appendString(b, r.Message)
+	appendUint(b, uint64(len(r.Values)+(len(keysAndValues)+1)/2))
+	for _, kv := range r.Values {
+		appendString(b, kv.Key)
+		appendValue(b, kv.Value)
+	}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if key, ok := keysAndValues[i].(string); ok {
+			appendString(b, key)
+		} else {
+			appendString(b, fmt.Sprintf("%s", keysAndValues[i]))
+		}
+		if i+1 < len(keysAndValues) {
+			appendValue(b, keysAndValues[i+1])
+		} else {
+			appendValue(b, "(MISSING)")
+		}
+	}
+	endItem(b, start)
+}
+
+// beginItem writes the kind and a placeholder for the length. It returns
+// the offset of that placeholder.
+func beginItem(b *bytes.Buffer, kind byte) int {
+	b.WriteByte(kind)
+	start := b.Len()
+	b.Write([]byte{0, 0, 0, 0})
+	return start
+}
+
+// endItem stores the length of the payload.
+func endItem(b *bytes.Buffer, start int) {
+	binary.LittleEndian.PutUint32(b.Bytes()[start:], uint32(b.Len()-start-4))
+}
+
+func appendValue(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(typeNil)
+	case bool:
+		if v {
+			b.WriteByte(typeTrue)
+		} else {
+			b.WriteByte(typeFalse)
+		}
+	case int:
+		appendTypedInt(b, int64(v))
+	case int8:
+		appendTypedInt(b, int64(v))
+	case int16:
+		appendTypedInt(b, int64(v))
+	case int32:
+		appendTypedInt(b, int64(v))
+	case int64:
+		appendTypedInt(b, v)
+	case uint:
+		appendTypedUint(b, uint64(v))
+	case uint8:
+		appendTypedUint(b, uint64(v))
+	case uint16:
+		appendTypedUint(b, uint64(v))
+	case uint32:
+		appendTypedUint(b, uint64(v))
+	case uint64:
+		appendTypedUint(b, v)
+	case uintptr:
+		appendTypedUint(b, uint64(v))
+	case float32:
+		b.WriteByte(typeFloat32)
+		var data [4]byte
+		binary.LittleEndian.PutUint32(data[:], math.Float32bits(v))
+		b.Write(data[:])
+	case float64:
+		b.WriteByte(typeFloat64)
+		var data [8]byte
+		binary.LittleEndian.PutUint64(data[:], math.Float64bits(v))
+		b.Write(data[:])
+	case string:
+		b.WriteByte(typeString)
+		appendString(b, v)
+	case []byte:
+		b.WriteByte(typeBytes)
+		appendString(b, string(v))
+	case time.Time:
+		b.WriteByte(typeTime)
+		appendTime(b, v)
+	case time.Duration:
+		b.WriteByte(typeDuration)
+		appendInt(b, int64(v))
+	// The remaining cases have the same priorities as in the JSON
+	// format.
+	case fmt.Stringer:
+		b.WriteByte(typeString)
+		appendString(b, serialize.StringerToString(v))
+	case logr.Marshaler:
+		appendValue(b, serialize.MarshalerToValue(v))
+	case error:
+		b.WriteByte(typeString)
+		appendString(b, serialize.ErrorToString(v))
+	default:
+		var data bytes.Buffer
+		serialize.JSONValue(&data, v)
+		b.WriteByte(typeJSON)
+		appendString(b, data.String())
+	}
+}
+
+func appendTypedInt(b *bytes.Buffer, v int64) {
+	b.WriteByte(typeInt)
+	appendInt(b, v)
+}
+
+func appendTypedUint(b *bytes.Buffer, v uint64) {
+	b.WriteByte(typeUint)
+	appendUint(b, v)
+}
+
+func appendInt(b *bytes.Buffer, v int64) {
+	var data [binary.MaxVarintLen64]byte
+	b.Write(data[:binary.PutVarint(data[:], v)])
+}
+
+func appendUint(b *bytes.Buffer, v uint64) {
+	var data [binary.MaxVarintLen64]byte
+	b.Write(data[:binary.PutUvarint(data[:], v)])
+}
+
+func appendString(b *bytes.Buffer, s string) {
+	appendUint(b, uint64(len(s)))
+	b.WriteString(s)
+}
+
+func appendTime(b *bytes.Buffer, t time.Time) {
+	name, offset := t.Zone()
+	appendInt(b, t.Unix())
+	appendUint(b, uint64(t.Nanosecond()))
+	appendInt(b, int64(offset))
+	appendString(b, name)
+}
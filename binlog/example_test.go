@@ -0,0 +1,71 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlog_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+func ExampleReader() {
+	// Normally the input is a log file written by plog with
+	// -logging_format=binary.
+	now := time.Date(2006, 1, 2, 15, 4, 5, 67890000, time.UTC)
+	var file bytes.Buffer
+	binlog.AppendRecord(&file, binlog.Record{
+		Time:       now,
+		Severity:   textparser.SeverityInfo,
+		Verbosity:  2,
+		ThreadID:   1234,
+		File:       "main.go",
+		Line:       42,
+		Structured: true,
+		Message:    "request done",
+	}, "duration", 1500*time.Millisecond, "status", 200)
+
+	reader := binlog.NewReader(&file)
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return
+		}
+		for _, kv := range record.Values {
+			fmt.Printf("%s: %T %v\n", kv.Key, kv.Value, kv.Value)
+		}
+		var b bytes.Buffer
+		record.WriteText(&b)
+		record.WriteJSON(&b)
+		os.Stdout.Write(b.Bytes())
+	}
+
+	// Output:
+	// duration: time.Duration 1.5s
+	// status: int64 200
+	// I0102 15:04:05.067890    1234 main.go:42] "request done" duration="1.5s" status=200
+	// {"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":2,"caller":"main.go:42","msg":"request done","duration":"1.5s","status":200}
+}
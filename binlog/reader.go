@@ -0,0 +1,292 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// Reader decodes items from a stream in the binary encoding.
+type Reader struct {
+	in io.Reader
+	// buf[start:] contains input which has not been decoded yet.
+	buf    []byte
+	start  int
+	header FileHeader
+	// err is a permanent error.
+	err error
+}
+
+// NewReader creates a reader for the stream.
+func NewReader(in io.Reader) *Reader {
+	return &Reader{in: in}
+}
+
+// Header returns the most recent file header. Files get concatenated when
+// reading several of them through the same Reader.
+func (r *Reader) Header() FileHeader {
+	return r.header
+}
+
+// Next returns the next log entry or output which is not a log entry. File
+// headers are skipped, see Header. At the end of the input it returns
+// io.EOF, or io.ErrUnexpectedEOF when the input ends in the middle of an
+// item. In both cases Next may be called again afterwards, which is useful
+// when reading from a file that is still growing. All other errors are
+// permanent.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.err != nil {
+			return Record{}, r.err
+		}
+		kind, payload, err := r.item()
+		if err != nil {
+			return Record{}, err
+		}
+		d := decoder{data: payload}
+		switch kind {
+		case kindFileHeader:
+			header := FileHeader{
+				Created: d.time(),
+				Host:    d.string(),
+				Binary:  d.string(),
+			}
+			if d.err != nil {
+				r.err = fmt.Errorf("decode file header: %w", d.err)
+				continue
+			}
+			r.header = header
+		case kindText:
+			return Record{Text: string(payload)}, nil
+		default:
+			record := d.record()
+			if d.err != nil {
+				r.err = fmt.Errorf("decode log entry: %w", d.err)
+				continue
+			}
+			return record, nil
+		}
+	}
+}
+
+// item returns the next complete item. The payload is only valid until the
+// next call.
+func (r *Reader) item() (byte, []byte, error) {
+	const headerSize = 5
+	for {
+		data := r.buf[r.start:]
+		if len(data) >= headerSize {
+			kind := data[0]
+			if kind != kindFileHeader && kind != kindRecord && kind != kindText {
+				r.err = fmt.Errorf("unknown kind of item 0x%02x", kind)
+				return 0, nil, r.err
+			}
+			size := binary.LittleEndian.Uint32(data[1:])
+			if size > maxItemSize {
+				r.err = fmt.Errorf("item size %d exceeds the limit of %d bytes", size, maxItemSize)
+				return 0, nil, r.err
+			}
+			if end := headerSize + int(size); len(data) >= end {
+				r.start += end
+				return kind, data[headerSize:end], nil
+			}
+		}
+		if err := r.fill(); err != nil {
+			if errors.Is(err, io.EOF) && len(r.buf) > r.start {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+	}
+}
+
+// fill reads more data after moving the data which has not been decoded yet
+// to the beginning of the buffer.
+func (r *Reader) fill() error {
+	const minRead = 4096
+	r.buf = r.buf[:copy(r.buf, r.buf[r.start:])]
+	r.start = 0
+	if cap(r.buf)-len(r.buf) < minRead {
+		buf := make([]byte, len(r.buf), 2*cap(r.buf)+minRead)
+		copy(buf, r.buf)
+		r.buf = buf
+	}
+	n, err := r.in.Read(r.buf[len(r.buf):cap(r.buf)])
+	r.buf = r.buf[:len(r.buf)+n]
+	if n > 0 {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	if !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	return err
+}
+
+// decoder extracts values from a payload. The first error is recorded and
+// turns all further calls into no-ops.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+var errTruncated = errors.New("payload is truncated")
+
+func (d *decoder) record() Record {
+	r := Record{
+		Time:      d.time(),
+		Severity:  textparser.Severity(d.byte()),
+		Verbosity: int(d.int()),
+	}
+	flags := d.byte()
+	r.Structured = flags&flagStructured != 0
+	r.ThreadID = int(d.uint())
+	r.File = d.string()
+	r.Line = int(d.uint())
+	r.Message = d.string()
+	n := d.uint()
+	if n > uint64(len(d.data)) {
+		// Each pair needs at least two bytes.
+		d.fail(errTruncated)
+		return r
+	}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		r.Values = append(r.Values, KeyValue{Key: d.string(), Value: d.value()})
+	}
+	return r
+}
+
+func (d *decoder) value() interface{} {
+	switch t := d.byte(); t {
+	case typeNil:
+		return nil
+	case typeFalse:
+		return false
+	case typeTrue:
+		return true
+	case typeInt:
+		return d.int()
+	case typeUint:
+		return d.uint()
+	case typeFloat32:
+		data := d.bytes(4)
+		if data == nil {
+			return nil
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data))
+	case typeFloat64:
+		data := d.bytes(8)
+		if data == nil {
+			return nil
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data))
+	case typeString:
+		return d.string()
+	case typeBytes:
+		return []byte(d.string())
+	case typeTime:
+		return d.time()
+	case typeDuration:
+		return time.Duration(d.int())
+	case typeJSON:
+		return JSON(d.string())
+	default:
+		d.fail(fmt.Errorf("unknown type of value 0x%02x", t))
+		return nil
+	}
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.data = nil
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.fail(errTruncated)
+		return nil
+	}
+	data := d.data[:n]
+	d.data = d.data[n:]
+	return data
+}
+
+func (d *decoder) byte() byte {
+	data := d.bytes(1)
+	if data == nil {
+		return 0
+	}
+	return data[0]
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail(errTruncated)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail(errTruncated)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if n > uint64(len(d.data)) {
+		d.fail(errTruncated)
+		return ""
+	}
+	return string(d.bytes(int(n)))
+}
+
+func (d *decoder) time() time.Time {
+	sec := d.int()
+	nsec := d.uint()
+	offset := d.int()
+	name := d.string()
+	if d.err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, int64(nsec)).In(time.FixedZone(name, int(offset)))
+}
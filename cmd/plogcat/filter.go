@@ -0,0 +1,153 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// filter decides which records get written. The zero value accepts all
+// records.
+type filter struct {
+	severity textparser.Severity
+	since    time.Time
+	until    time.Time
+	logger   string
+	message  *regexp.Regexp
+	matches  matchList
+}
+
+// match returns true if the record passes all checks. Records without header
+// have no time stamp and are rejected by -since and -until.
+func (f *filter) match(record textparser.Record) bool {
+	if record.Severity < f.severity {
+		return false
+	}
+	if !f.since.IsZero() && (!record.HasHeader || record.Time.Before(f.since)) {
+		return false
+	}
+	if !f.until.IsZero() && (!record.HasHeader || !record.Time.Before(f.until)) {
+		return false
+	}
+	if f.logger != "" {
+		kv, ok := record.Get("logger")
+		if !ok || (kv.Value != f.logger && !strings.HasPrefix(kv.Value, f.logger+".")) {
+			return false
+		}
+	}
+	if f.message != nil && !f.message.MatchString(record.Message) {
+		return false
+	}
+	for _, m := range f.matches {
+		kv, ok := record.Get(m.key)
+		if !ok || kv.Value != m.value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchList implements flag.Value for -match.
+type matchList []keyValue
+
+type keyValue struct {
+	key, value string
+}
+
+func (m *matchList) String() string {
+	var parts []string
+	for _, kv := range *m {
+		parts = append(parts, kv.key+"="+kv.value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *matchList) Set(value string) error {
+	eq := strings.IndexByte(value, '=')
+	if eq <= 0 {
+		return fmt.Errorf("%q is not in key=value format", value)
+	}
+	*m = append(*m, keyValue{key: value[:eq], value: value[eq+1:]})
+	return nil
+}
+
+func parseSeverity(value string) (textparser.Severity, error) {
+	for s := textparser.SeverityInfo; s <= textparser.SeverityFatal; s++ {
+		if strings.EqualFold(value, s.String()) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", value)
+}
+
+// timeLayouts are the supported absolute time formats for -since and
+// -until. Times without zone are in local time.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseTime accepts an absolute time or a duration before now. An empty
+// value results in the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return timeNow().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a time nor a duration", value)
+}
+
+func compileRegexp(value string) (*regexp.Regexp, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return regexp.Compile(value)
+}
+
+// fileHeaderPrefixes are the beginnings of the lines which plog writes at
+// the start of each log file.
+var fileHeaderPrefixes = []string{
+	"Log file created at: ",
+	"Running on machine: ",
+	"Binary: ",
+	"Log line format: ",
+}
+
+// isFileHeader detects the lines at the start of a log file.
+func isFileHeader(record textparser.Record) bool {
+	if record.HasHeader || record.Structured {
+		return false
+	}
+	for _, prefix := range fileHeaderPrefixes {
+		if strings.HasPrefix(record.Message, prefix) {
+			return true
+		}
+	}
+	return false
+}
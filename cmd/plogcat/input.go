@@ -0,0 +1,246 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/internal/rotation"
+)
+
+// stdinName stands for stdin in the list of inputs.
+const stdinName = "-"
+
+// expandInputs replaces directories with the log files in them and, if
+// requested, adds the backups of each file.
+func expandInputs(args []string, tag string, rotated bool) ([]string, error) {
+	if len(args) == 0 {
+		return []string{stdinName}, nil
+	}
+	var inputs []string
+	for _, arg := range args {
+		if arg == stdinName {
+			inputs = append(inputs, arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if rotated {
+				inputs = append(inputs, backups(arg)...)
+			}
+			inputs = append(inputs, arg)
+			continue
+		}
+		files, err := logFiles(arg, tag)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, files...)
+	}
+	return inputs, nil
+}
+
+// logFiles returns all regular files in the directory with the tag as one
+// component of the name, like app.host.user.log.INFO.20060102-150405.1234.
+// Symlinks like app.INFO are skipped because they point to one of those
+// files.
+func logFiles(dir, tag string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		name    string
+		modTime time.Time
+	}
+	var files []file
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".gz")
+		if !strings.Contains("."+name+".", "."+tag+".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file{name: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].modTime.Equal(files[j].modTime) {
+			return files[i].modTime.Before(files[j].modTime)
+		}
+		return files[i].name < files[j].name
+	})
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.name)
+	}
+	return names, nil
+}
+
+// backups returns the existing backups <file>.N or <file>.N.gz, oldest
+// (= highest number) first.
+func backups(name string) []string {
+	var files []string
+	for i := 1; ; i++ {
+		backup := rotation.BackupName(name, i)
+		if _, err := os.Stat(backup); err != nil {
+			backup += ".gz"
+			if _, err := os.Stat(backup); err != nil {
+				break
+			}
+		}
+		files = append([]string{backup}, files...)
+	}
+	return files
+}
+
+// openInput opens stdin or a file, with decompression for .gz files. It also
+// determines whether the input is in the binary encoding. When following,
+// the reader returns io.EOF until more data is available.
+func openInput(name string, stdin io.Reader, follow bool) (io.ReadCloser, bool, error) {
+	if name == stdinName {
+		in := bufio.NewReader(stdin)
+		return readCloser{Reader: in, close: func() error { return nil }}, isBinary(in), nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, false, err
+		}
+		in := bufio.NewReader(gz)
+		return readCloser{Reader: in, close: file.Close}, isBinary(in), nil
+	}
+	var start [1]byte
+	n, _ := file.ReadAt(start[:], 0)
+	binary := binlog.IsBinary(start[:n])
+	if follow {
+		return &follower{path: name, file: file, binary: binary}, binary, nil
+	}
+	return file, binary, nil
+}
+
+func isBinary(in *bufio.Reader) bool {
+	start, _ := in.Peek(1)
+	return binlog.IsBinary(start)
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+// follower reads a file that is still being written. It only returns complete
+// lines, except for files in the binary encoding. When the file gets truncated, it starts again at the beginning. When
+// the path refers to a different file, for example because a symlink like
+// app.INFO was updated, it switches to that file.
+type follower struct {
+	path   string
+	file   *os.File
+	binary bool
+	// incomplete is data after the last line break.
+	incomplete []byte
+	// complete contains lines which have not been returned yet.
+	complete []byte
+	offset   int64
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	if len(f.complete) == 0 {
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+		if len(f.complete) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, f.complete)
+	f.complete = f.complete[n:]
+	return n, nil
+}
+
+// fill reads all available data.
+func (f *follower) fill() error {
+	if err := f.checkFile(); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f.file)
+	if err != nil {
+		return err
+	}
+	f.offset += int64(len(data))
+	f.incomplete = append(f.incomplete, data...)
+	if f.binary {
+		// binlog.Reader handles incomplete items itself.
+		f.complete = append(f.complete, f.incomplete...)
+		f.incomplete = nil
+	} else if end := bytes.LastIndexByte(f.incomplete, '\n'); end >= 0 {
+		f.complete = append(f.complete, f.incomplete[:end+1]...)
+		f.incomplete = append([]byte(nil), f.incomplete[end+1:]...)
+	}
+	return nil
+}
+
+// checkFile detects truncation and replacement of the file.
+func (f *follower) checkFile() error {
+	current, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if latest, err := os.Stat(f.path); err == nil && !os.SameFile(current, latest) {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		f.file.Close()
+		f.file, f.offset, f.incomplete = file, 0, nil
+		return nil
+	}
+	if current.Size() < f.offset {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.offset, f.incomplete = 0, nil
+	}
+	return nil
+}
+
+func (f *follower) Close() error {
+	return f.file.Close()
+}
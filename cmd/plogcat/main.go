@@ -0,0 +1,219 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command plogcat reads logs in the klog text format or in the binary format
+// (-logging_format=binary), filters them and converts them into other
+// formats.
+//
+// Usage:
+//
+//	plogcat [flags] [file|directory|-]...
+//
+// Without arguments or with "-", stdin is read. Files ending in .gz are
+// decompressed. For a directory, all log files of one severity (-tag, INFO
+// by default, which contains all entries) get read, sorted by modification
+// time. With -rotated, the numbered backups of a file written with
+// -log_file and -klog_log_file_max_backups are read first, oldest first.
+//
+// Examples:
+//
+//	plogcat -severity error -since 1h /var/log/app
+//	plogcat -logger controller -match pod=kube-system/coredns -output json app.log
+//	plogcat -follow -message 'timeout|deadline' /var/log/app/app.INFO
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// pollInterval is how often a followed file is checked for new data. Tests
+// can change it.
+var pollInterval = 250 * time.Millisecond
+
+// holdTimeout is how long the last entry of a followed file is held back
+// because continuation lines might still get appended. Tests can change it.
+var holdTimeout = time.Second
+
+// timeNow can be replaced by tests.
+var timeNow = time.Now
+
+type options struct {
+	filter  filter
+	output  string
+	follow  bool
+	rotated bool
+	tag     string
+	year    int
+}
+
+// run executes the command and returns the exit code: 0 for success, 1 for
+// errors while reading and 2 for invalid usage.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts options
+	fs := flag.NewFlagSet("plogcat", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: plogcat [flags] [file|directory|-]...\n\n")
+		fs.PrintDefaults()
+	}
+	var severity, since, until, message string
+	fs.StringVar(&severity, "severity", "info", "Minimum severity of entries: info, warning, error or fatal")
+	fs.StringVar(&since, "since", "", "Only entries at or after this time: RFC 3339, \"2006-01-02 15:04:05\", \"2006-01-02\" or a duration like 1h before now")
+	fs.StringVar(&until, "until", "", "Only entries before this time, same format as -since")
+	fs.StringVar(&opts.filter.logger, "logger", "", "Only entries of this logger or its children (logger=\"name\" or logger=\"name.child\")")
+	fs.StringVar(&message, "message", "", "Only entries with a message matching this regular expression")
+	fs.Var(&opts.filter.matches, "match", "Only entries with this key=value pair, may be repeated")
+	fs.StringVar(&opts.output, "output", "text", "Output format: text, json (JSON Lines) or logfmt")
+	fs.BoolVar(&opts.follow, "follow", false, "Keep reading the last file as it grows, like tail -f")
+	fs.BoolVar(&opts.rotated, "rotated", false, "Also read the numbered backups <file>.N of each file, oldest first")
+	fs.StringVar(&opts.tag, "tag", "INFO", "Severity of the log files that are read from a directory")
+	fs.IntVar(&opts.year, "year", 0, "Year for time stamps without year, the default is the current year")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	usageError := func(format string, args ...interface{}) int {
+		fmt.Fprintf(stderr, "plogcat: "+format+"\n", args...)
+		return 2
+	}
+
+	var err error
+	if opts.filter.severity, err = parseSeverity(severity); err != nil {
+		return usageError("-severity: %v", err)
+	}
+	if opts.filter.since, err = parseTime(since); err != nil {
+		return usageError("-since: %v", err)
+	}
+	if opts.filter.until, err = parseTime(until); err != nil {
+		return usageError("-until: %v", err)
+	}
+	if opts.filter.message, err = compileRegexp(message); err != nil {
+		return usageError("-message: %v", err)
+	}
+	format, ok := formats[opts.output]
+	if !ok {
+		return usageError("-output: unknown format %q", opts.output)
+	}
+
+	inputs, err := expandInputs(fs.Args(), opts.tag, opts.rotated)
+	if err != nil {
+		fmt.Fprintf(stderr, "plogcat: %v\n", err)
+		return 1
+	}
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	exitCode := 0
+	for i, input := range inputs {
+		follow := opts.follow && i == len(inputs)-1
+		if err := opts.process(ctx, input, stdin, follow, format, out); err != nil {
+			out.Flush()
+			fmt.Fprintf(stderr, "plogcat: %s: %v\n", input, err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// process reads one input and writes all matching records.
+func (o *options) process(ctx context.Context, input string, stdin io.Reader, follow bool, format formatFunc, out *bufio.Writer) error {
+	in, binary, err := openInput(input, stdin, follow)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var next func() (textparser.Record, error)
+	// flush returns the entry that the text parser holds back when following.
+	flush := func() (textparser.Record, bool) { return textparser.Record{}, false }
+	if binary {
+		reader := binlog.NewReader(in)
+		next = func() (textparser.Record, error) {
+			record, err := reader.Next()
+			if follow && errors.Is(err, io.ErrUnexpectedEOF) {
+				// The rest of the item has not been written yet.
+				err = io.EOF
+			}
+			return record.TextRecord(), err
+		}
+	} else {
+		var parserOpts []textparser.Option
+		if o.year != 0 {
+			parserOpts = append(parserOpts, textparser.Year(o.year))
+		}
+		if follow {
+			parserOpts = append(parserOpts, textparser.Follow())
+		}
+		reader := textparser.NewReader(in, parserOpts...)
+		next, flush = reader.Next, reader.Flush
+	}
+	write := func(record textparser.Record) {
+		if !isFileHeader(record) && o.filter.match(record) {
+			format(out, record)
+		}
+	}
+	// held is when the end of the file was reached while an entry might
+	// have been held back.
+	var held time.Time
+	for {
+		record, err := next()
+		switch {
+		case err == nil:
+			write(record)
+			held = time.Time{}
+			continue
+		case !errors.Is(err, io.EOF):
+			return err
+		case !follow:
+			return nil
+		}
+		if held.IsZero() {
+			held = time.Now()
+		} else if time.Since(held) >= holdTimeout {
+			if record, ok := flush(); ok {
+				write(record)
+			}
+			held = time.Time{}
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			if record, ok := flush(); ok {
+				write(record)
+			}
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+const testLog = `Log file created at: 2024/01/02 03:04:05
+Running on machine: host
+Binary: Built with gc go1.22 for linux/amd64
+Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg
+I0102 03:04:05.000001    1234 main.go:10] "starting" logger="app" version="1.0"
+W0102 03:04:06.000002    1234 ctrl.go:20] "slow" logger="app.controller" pod="kube-system/coredns" count=3
+E0102 03:04:07.000003    1234 ctrl.go:30] "failed" logger="application" err="timeout"
+ >  stack line
+`
+
+const (
+	lineStarting = `I0102 03:04:05.000001    1234 main.go:10] "starting" logger="app" version="1.0"` + "\n"
+	lineSlow     = `W0102 03:04:06.000002    1234 ctrl.go:20] "slow" logger="app.controller" pod="kube-system/coredns" count=3` + "\n"
+	lineFailed   = `E0102 03:04:07.000003    1234 ctrl.go:30] "failed" logger="application" err="timeout"` + "\n"
+	stackLine    = " >  stack line\n"
+)
+
+func TestRun(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.UTC
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 7, 0, time.UTC) }
+
+	for name, tc := range map[string]struct {
+		args           []string
+		expectedOutput string
+		expectedError  string
+		expectedCode   int
+	}{
+		"all": {
+			expectedOutput: lineStarting + lineSlow + lineFailed + stackLine,
+		},
+		"severity": {
+			args:           []string{"-severity", "WARNING"},
+			expectedOutput: lineSlow + lineFailed + stackLine,
+		},
+		"since": {
+			args:           []string{"-since", "2024-01-02 03:04:06"},
+			expectedOutput: lineSlow + lineFailed + stackLine,
+		},
+		"since-duration": {
+			args:           []string{"-since", "1s", "-until", "2024-01-02T03:04:07Z"},
+			expectedOutput: lineSlow,
+		},
+		"logger": {
+			args:           []string{"-logger", "app"},
+			expectedOutput: lineStarting + lineSlow,
+		},
+		"message": {
+			args:           []string{"-message", "^s"},
+			expectedOutput: lineStarting + lineSlow,
+		},
+		"match": {
+			args:           []string{"-match", "pod=kube-system/coredns", "-match", "count=3"},
+			expectedOutput: lineSlow,
+		},
+		"match-mismatch": {
+			args: []string{"-match", "pod=kube-system/coredns", "-match", "count=4"},
+		},
+		"json": {
+			args:           []string{"-output", "json", "-logger", "app.controller"},
+			expectedOutput: `{"ts":"2024-01-02T03:04:06.000002Z","severity":"WARNING","caller":"ctrl.go:20","msg":"slow","logger":"app.controller","pod":"kube-system/coredns","count":3}` + "\n",
+		},
+		"logfmt": {
+			args:           []string{"-output", "logfmt", "-logger", "app.controller"},
+			expectedOutput: `ts=2024-01-02T03:04:06.000002Z level=warning caller=ctrl.go:20 msg=slow logger=app.controller pod=kube-system/coredns count=3` + "\n",
+		},
+		"bad-severity": {
+			args:          []string{"-severity", "debug"},
+			expectedError: "plogcat: -severity: unknown severity \"debug\"\n",
+			expectedCode:  2,
+		},
+		"bad-match": {
+			args:          []string{"-match", "pod"},
+			expectedError: "invalid value \"pod\" for flag -match: \"pod\" is not in key=value format\n",
+			expectedCode:  2,
+		},
+		"bad-output": {
+			args:          []string{"-output", "yaml"},
+			expectedError: "plogcat: -output: unknown format \"yaml\"\n",
+			expectedCode:  2,
+		},
+		"missing-file": {
+			args:          []string{"/no/such/file"},
+			expectedError: "plogcat: stat /no/such/file: no such file or directory\n",
+			expectedCode:  1,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-year", "2024"}, tc.args...)
+			code := run(context.Background(), args, strings.NewReader(testLog), &stdout, &stderr)
+			if code != tc.expectedCode {
+				t.Errorf("expected exit code %d, got %d", tc.expectedCode, code)
+			}
+			if stdout.String() != tc.expectedOutput {
+				t.Errorf("Output mismatch. Expected:\n%s\nActual:\n%s", tc.expectedOutput, stdout.String())
+			}
+			if !strings.HasPrefix(stderr.String(), tc.expectedError) || (tc.expectedError == "" && stderr.Len() > 0) {
+				t.Errorf("Error mismatch. Expected:\n%s\nActual:\n%s", tc.expectedError, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, ".gz") {
+			var b bytes.Buffer
+			w := gzip.NewWriter(&b)
+			w.Write([]byte(content))
+			w.Close()
+			content = b.String()
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("app.host.user.log.INFO.20240102-030405.1.gz", lineStarting, now.Add(-2*time.Hour))
+	write("app.host.user.log.INFO.20240102-030406.2", lineSlow, now.Add(-time.Hour))
+	write("app.host.user.log.ERROR.20240102-030407.2", lineFailed, now)
+	if err := os.Symlink("app.host.user.log.INFO.20240102-030406.2", filepath.Join(dir, "app.INFO")); err != nil {
+		t.Fatal(err)
+	}
+	write("single.log.2", lineStarting, now)
+	write("single.log.1.gz", lineSlow, now)
+	write("single.log", lineFailed, now)
+	var binary bytes.Buffer
+	binlog.AppendFileHeader(&binary, binlog.FileHeader{Created: now, Host: "host"})
+	binlog.AppendRecord(&binary, binlog.Record{
+		Time:       time.Date(2024, 1, 2, 3, 4, 6, 2000, time.UTC),
+		Severity:   textparser.SeverityWarning,
+		ThreadID:   1234,
+		File:       "ctrl.go",
+		Line:       20,
+		Structured: true,
+		Message:    "slow",
+	}, "logger", "app.controller", "pod", "kube-system/coredns", "count", 3)
+	write("binary.log.gz", binary.String(), now)
+
+	for name, tc := range map[string]struct {
+		args           []string
+		expectedOutput string
+	}{
+		"dir": {
+			args:           []string{dir},
+			expectedOutput: lineStarting + lineSlow,
+		},
+		"dir-tag": {
+			args:           []string{"-tag", "ERROR", dir},
+			expectedOutput: lineFailed,
+		},
+		"file": {
+			args:           []string{filepath.Join(dir, "single.log")},
+			expectedOutput: lineFailed,
+		},
+		"binary": {
+			args:           []string{"-match", "count=3", filepath.Join(dir, "binary.log.gz")},
+			expectedOutput: lineSlow,
+		},
+		"rotated": {
+			args:           []string{"-rotated", filepath.Join(dir, "single.log")},
+			expectedOutput: lineStarting + lineSlow + lineFailed,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-year", "2024"}, tc.args...)
+			if code := run(context.Background(), args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+			}
+			if stdout.String() != tc.expectedOutput {
+				t.Errorf("Output mismatch. Expected:\n%s\nActual:\n%s", tc.expectedOutput, stdout.String())
+			}
+		})
+	}
+}
+
+func TestRunFollow(t *testing.T) {
+	defer func(previous time.Duration) { pollInterval = previous }(pollInterval)
+	pollInterval = time.Millisecond
+	defer func(previous time.Duration) { holdTimeout = previous }(holdTimeout)
+	holdTimeout = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(lineStarting), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout := &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-year", "2024", "-follow", path}, nil, stdout, &bytes.Buffer{})
+	}()
+	waitFor := func(expected string) {
+		t.Helper()
+		waitForOutput(t, stdout, expected)
+	}
+	waitFor(lineStarting)
+
+	// Append in two steps, the incomplete line must not get parsed yet.
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(lineSlow[:10])
+	time.Sleep(10 * pollInterval)
+	file.WriteString(lineSlow[10:])
+	waitFor(lineStarting + lineSlow)
+
+	// Replace the file, like a rotation would do.
+	replacement := path + ".new"
+	if err := os.WriteFile(replacement, []byte(lineFailed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(lineStarting + lineSlow + lineFailed)
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+}
+
+func TestRunFollowContinuation(t *testing.T) {
+	defer func(previous time.Duration) { pollInterval = previous }(pollInterval)
+	pollInterval = time.Millisecond
+	defer func(previous time.Duration) { holdTimeout = previous }(holdTimeout)
+	holdTimeout = time.Hour
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(lineFailed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout := &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-year", "2024", "-follow", path}, nil, stdout, &bytes.Buffer{})
+	}()
+
+	// The continuation line arrives after the end of the file was reached.
+	time.Sleep(10 * pollInterval)
+	if output := stdout.String(); output != "" {
+		t.Fatalf("entry should have been held back, got:\n%s", output)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(stackLine)
+	time.Sleep(10 * pollInterval)
+	file.WriteString(lineStarting)
+	waitForOutput(t, stdout, lineFailed+stackLine)
+
+	// The last entry gets written when stopping.
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if output := stdout.String(); output != lineFailed+stackLine+lineStarting {
+		t.Errorf("Output mismatch. Expected:\n%s\nActual:\n%s", lineFailed+stackLine+lineStarting, output)
+	}
+}
+
+func waitForOutput(t *testing.T, stdout *syncBuffer, expected string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for stdout.String() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Output mismatch. Expected:\n%s\nActual:\n%s", expected, stdout.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buffer.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.buffer.String()
+}
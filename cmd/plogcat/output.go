@@ -0,0 +1,88 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pohly/plog/v2/internal/serialize"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// formatFunc writes one record, including the trailing line break.
+type formatFunc func(out *bufio.Writer, record textparser.Record)
+
+// formats contains the supported values of -output.
+var formats = map[string]formatFunc{
+	"text":   formatText,
+	"json":   formatJSON,
+	"logfmt": formatLogfmt,
+}
+
+// timeLayout is the same as in the JSON and logfmt output of plog.
+const timeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+func formatText(out *bufio.Writer, record textparser.Record) {
+	out.WriteString(record.String())
+	out.WriteByte('\n')
+}
+
+// formatJSON produces the same keys as -logging_format=json. Values
+// which were written as JSON are copied, everything else becomes a string.
+func formatJSON(out *bufio.Writer, record textparser.Record) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if record.HasHeader {
+		b.WriteString(`"ts":"`)
+		b.WriteString(record.Time.Format(timeLayout))
+		b.WriteString(`",`)
+	}
+	b.WriteString(`"severity":"`)
+	b.WriteString(record.Severity.String())
+	b.WriteByte('"')
+	if record.HasHeader {
+		b.WriteString(`,"caller":`)
+		serialize.JSONString(&b, record.File+":"+strconv.Itoa(record.Line))
+	}
+	b.WriteString(`,"msg":`)
+	serialize.JSONString(&b, record.Message)
+	for _, kv := range record.Values {
+		b.WriteByte(',')
+		serialize.JSONString(&b, kv.Key)
+		b.WriteByte(':')
+		if kv.Kind == textparser.KindRaw && json.Valid([]byte(kv.Value)) {
+			if err := json.Compact(&b, []byte(kv.Value)); err == nil {
+				continue
+			}
+		}
+		serialize.JSONString(&b, kv.Value)
+	}
+	b.WriteString("}\n")
+	out.Write(b.Bytes())
+}
+
+// formatLogfmt produces the same keys as -logging_format=logfmt.
+func formatLogfmt(out *bufio.Writer, record textparser.Record) {
+	var b bytes.Buffer
+	serialize.LogfmtHeader(&b, record.Time, record.Severity, -1, record.File, record.Line, record.Message)
+	for _, kv := range record.Values {
+		serialize.LogfmtFormat(&b, kv.Key, kv.Interface())
+	}
+	b.WriteByte('\n')
+	out.Write(b.Bytes())
+}
@@ -152,12 +152,18 @@ func EnableContextualLogging(enabled bool) {
 
 // FromContext retrieves a logger set by the caller or, if not set,
 // falls back to the program's global logger (a Logger instance or klog
-// itself).
+// itself). A verbosity stored with ContextWithVerbosity gets applied to
+// the logger.
 func FromContext(ctx context.Context) Logger {
 	if logging.contextualLoggingEnabled {
-		if logger, err := logr.FromContext(ctx); err == nil {
-			return logger
+		logger, err := logr.FromContext(ctx)
+		if err != nil {
+			logger = Background()
 		}
+		if level, ok := ctx.Value(verbosityKey{}).(Level); ok {
+			logger = LoggerWithVerbosity(logger, level)
+		}
+		return logger
 	}
 
 	return Background()
@@ -210,3 +216,44 @@ func NewContext(ctx context.Context, logger Logger) context.Context {
 	}
 	return ctx
 }
+
+// verbosityKey is the context key for ContextWithVerbosity.
+type verbosityKey struct{}
+
+// ContextWithVerbosity returns a context which enables logging up to the
+// given level for all loggers retrieved from it with FromContext,
+// regardless of -v and -vmodule, when contextual logging is enabled.
+// Otherwise it returns ctx. This is useful for debugging a single request
+// without raising the verbosity for the whole process: tag the context of
+// the request and all code which uses FromContext with that context or a
+// context derived from it logs at the higher verbosity.
+//
+// This works for loggers whose LogSink implements VerbositySink, like
+// those of NewKlogr and textlogger. Other loggers are not modified.
+func ContextWithVerbosity(ctx context.Context, level Level) context.Context {
+	if logging.contextualLoggingEnabled {
+		return context.WithValue(ctx, verbosityKey{}, level)
+	}
+	return ctx
+}
+
+// VerbositySink is implemented by LogSinks which support a verbosity
+// override, as used by ContextWithVerbosity and LoggerWithVerbosity.
+type VerbositySink interface {
+	logr.LogSink
+
+	// WithVerbosity returns a LogSink which is enabled for all levels up
+	// to and including the given one, in addition to the levels that are
+	// enabled by its own configuration.
+	WithVerbosity(level int) logr.LogSink
+}
+
+// LoggerWithVerbosity returns a logger which is enabled for all levels up
+// to and including the given one if its LogSink implements VerbositySink,
+// otherwise the logger.
+func LoggerWithVerbosity(logger Logger, level Level) Logger {
+	if sink, ok := logger.GetSink().(VerbositySink); ok {
+		return logger.WithSink(sink.WithVerbosity(int(level)))
+	}
+	return logger
+}
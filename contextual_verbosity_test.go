@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog_test
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func ExampleContextWithVerbosity() {
+	ts, _ := time.Parse(time.RFC3339, "2000-12-24T12:30:40Z")
+	config := textlogger.NewConfig(
+		textlogger.FixedTime(ts), // To get consistent output for each run.
+		textlogger.OutputFormat(textlogger.FormatLogfmt),
+		textlogger.Output(os.Stdout),
+	)
+	ctx := plog.NewContext(context.Background(), textlogger.NewLogger(config))
+
+	handleRequest := func(ctx context.Context, id int) {
+		logger := plog.FromContext(ctx).WithValues("request", id)
+		logger.V(6).Info("Request details")
+		logger.Info("Request done")
+	}
+	handleRequest(ctx, 1)
+	// Only this request is debugged.
+	handleRequest(plog.ContextWithVerbosity(ctx, 6), 2)
+
+	// Output:
+	// ts=2000-12-24T12:30:40.000000Z level=info v=0 caller=contextual_verbosity_test.go:40 msg="Request done" request=1
+	// ts=2000-12-24T12:30:40.000000Z level=info v=6 caller=contextual_verbosity_test.go:39 msg="Request details" request=2
+	// ts=2000-12-24T12:30:40.000000Z level=info v=0 caller=contextual_verbosity_test.go:40 msg="Request done" request=2
+}
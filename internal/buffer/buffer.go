@@ -21,6 +21,7 @@ package buffer
 import (
 	"bytes"
 	"os"
+	"runtime"
 	"sync"
 	"time"
 
@@ -112,42 +113,76 @@ func (buf *Buffer) someDigits(i, d int) int {
 	return copy(buf.Tmp[i:], buf.Tmp[j:])
 }
 
+// ThreadID selects what gets written into the thread ID column of the header.
+type ThreadID int
+
+const (
+	// ThreadIDPid is the process ID. FormatHeader uses it by default,
+	// SprintHeader omits the column.
+	ThreadIDPid ThreadID = iota
+	// ThreadIDOS is the ID of the operating system thread which runs the
+	// goroutine that logs. Only supported on Linux, other platforms use
+	// the process ID.
+	ThreadIDOS
+	// ThreadIDGoroutine is the ID of the goroutine that logs.
+	ThreadIDGoroutine
+)
+
+// maxThreadIDWidth ensures that the header fits into Buffer.Tmp.
+const maxThreadIDWidth = 20
+
+// HeaderOptions modify the header written by FormatHeaderWithOptions. The
+// zero value produces the traditional klog header.
+type HeaderOptions struct {
+	// RFC3339 replaces "mmdd hh:mm:ss.uuuuuu" with a time stamp in RFC
+	// 3339 format, which includes the year and the time zone.
+	RFC3339 bool
+
+	// UTC converts the time stamp to UTC instead of local time.
+	UTC bool
+
+	// Precision is the number of digits for fractions of a second. Valid
+	// values are 3, 6 and 9. Zero is the same as 6.
+	Precision int
+
+	// ThreadID selects the identifier in the thread ID column.
+	ThreadID ThreadID
+
+	// ThreadIDWidth is the minimum width of the thread ID column, padded
+	// with spaces on the left. Zero is the same as 7. Longer IDs are
+	// never truncated.
+	ThreadIDWidth int
+}
+
+// rfc3339Layouts contains the time layout for each supported precision.
+var rfc3339Layouts = map[int]string{
+	3: "2006-01-02T15:04:05.000Z07:00",
+	6: "2006-01-02T15:04:05.000000Z07:00",
+	9: "2006-01-02T15:04:05.000000000Z07:00",
+}
+
 // FormatHeader formats a log header using the provided file name and line number
 // and writes it into the buffer.
 func (buf *Buffer) FormatHeader(s severity.Severity, file string, line int, now time.Time) {
+	buf.FormatHeaderWithOptions(s, file, line, now, HeaderOptions{})
+}
+
+// FormatHeaderWithOptions is a variant of FormatHeader which supports
+// different formats of the time stamp and thread ID.
+func (buf *Buffer) FormatHeaderWithOptions(s severity.Severity, file string, line int, now time.Time, opts HeaderOptions) {
 	if line < 0 {
 		line = 0 // not a real line number, but acceptable to someDigits
 	}
-	if s > severity.FatalLog {
-		s = severity.InfoLog // for safety.
-	}
 
-	// Avoid Fprintf, for speed. The format is so simple that we can do it quickly by hand.
-	// It's worth about 3X. Fprintf is hard.
-	if Time != nil {
-		now = *Time
-	}
-	_, month, day := now.Date()
-	hour, minute, second := now.Clock()
 	// Lmmdd hh:mm:ss.uuuuuu threadid file:line]
-	buf.Tmp[0] = severity.Char[s]
-	buf.twoDigits(1, int(month))
-	buf.twoDigits(3, day)
-	buf.Tmp[5] = ' '
-	buf.twoDigits(6, hour)
-	buf.Tmp[8] = ':'
-	buf.twoDigits(9, minute)
-	buf.Tmp[11] = ':'
-	buf.twoDigits(12, second)
-	buf.Tmp[14] = '.'
-	buf.nDigits(6, 15, now.Nanosecond()/1000, '0')
-	buf.Tmp[21] = ' '
-	buf.nDigits(7, 22, Pid, ' ') // TODO: should be TID
-	buf.Tmp[29] = ' '
-	buf.Write(buf.Tmp[:30])
+	n := buf.formatSeverityAndTime(s, now, opts)
+	buf.Tmp[n] = ' '
+	n += 1 + buf.threadID(n+1, opts)
+	buf.Tmp[n] = ' '
+	buf.Write(buf.Tmp[:n+1])
 	buf.WriteString(file)
 	buf.Tmp[0] = ':'
-	n := buf.someDigits(1, line)
+	n = buf.someDigits(1, line)
 	buf.Tmp[n+1] = ']'
 	buf.Tmp[n+2] = ' '
 	buf.Write(buf.Tmp[:n+3])
@@ -156,19 +191,47 @@ func (buf *Buffer) FormatHeader(s severity.Severity, file string, line int, now
 // SprintHeader formats a log header and returns a string. This is a simpler
 // version of FormatHeader for use in ktesting.
 func (buf *Buffer) SprintHeader(s severity.Severity, now time.Time) string {
+	return buf.SprintHeaderWithOptions(s, now, HeaderOptions{})
+}
+
+// SprintHeaderWithOptions is a variant of SprintHeader which supports the
+// same options as FormatHeaderWithOptions. The thread ID column is only
+// included for ThreadIDOS and ThreadIDGoroutine.
+func (buf *Buffer) SprintHeaderWithOptions(s severity.Severity, now time.Time, opts HeaderOptions) string {
+	n := buf.formatSeverityAndTime(s, now, opts)
+	if opts.ThreadID != ThreadIDPid {
+		buf.Tmp[n] = ' '
+		n += 1 + buf.threadID(n+1, opts)
+	}
+	buf.Tmp[n] = ']'
+	return string(buf.Tmp[:n+1])
+}
+
+// formatSeverityAndTime writes the beginning of the header into buf.Tmp and
+// returns its length.
+func (buf *Buffer) formatSeverityAndTime(s severity.Severity, now time.Time, opts HeaderOptions) int {
 	if s > severity.FatalLog {
 		s = severity.InfoLog // for safety.
 	}
+	precision := opts.Precision
+	if _, ok := rfc3339Layouts[precision]; !ok {
+		precision = 6
+	}
 
 	// Avoid Fprintf, for speed. The format is so simple that we can do it quickly by hand.
 	// It's worth about 3X. Fprintf is hard.
 	if Time != nil {
 		now = *Time
 	}
+	if opts.UTC {
+		now = now.UTC()
+	}
+	buf.Tmp[0] = severity.Char[s]
+	if opts.RFC3339 {
+		return len(now.AppendFormat(buf.Tmp[:1], rfc3339Layouts[precision]))
+	}
 	_, month, day := now.Date()
 	hour, minute, second := now.Clock()
-	// Lmmdd hh:mm:ss.uuuuuu threadid file:line]
-	buf.Tmp[0] = severity.Char[s]
 	buf.twoDigits(1, int(month))
 	buf.twoDigits(3, day)
 	buf.Tmp[5] = ' '
@@ -178,7 +241,63 @@ func (buf *Buffer) SprintHeader(s severity.Severity, now time.Time) string {
 	buf.Tmp[11] = ':'
 	buf.twoDigits(12, second)
 	buf.Tmp[14] = '.'
-	buf.nDigits(6, 15, now.Nanosecond()/1000, '0')
-	buf.Tmp[21] = ']'
-	return string(buf.Tmp[:22])
+	fraction := now.Nanosecond()
+	for i := precision; i < 9; i++ {
+		fraction /= 10
+	}
+	buf.nDigits(precision, 15, fraction, '0')
+	return 15 + precision
+}
+
+// CurrentThreadID returns the identifier which FormatHeaderWithOptions
+// writes into the thread ID column for the calling goroutine.
+func CurrentThreadID(mode ThreadID) int {
+	switch mode {
+	case ThreadIDOS:
+		return tid()
+	case ThreadIDGoroutine:
+		return goroutineID()
+	default:
+		return Pid
+	}
+}
+
+// threadID writes the thread ID column at buf.Tmp[i] and returns its width.
+func (buf *Buffer) threadID(i int, opts HeaderOptions) int {
+	id := CurrentThreadID(opts.ThreadID)
+	width := opts.ThreadIDWidth
+	if width <= 0 {
+		width = 7
+	}
+	numDigits := 1
+	for d := id / 10; d > 0; d /= 10 {
+		numDigits++
+	}
+	if width < numDigits {
+		width = numDigits
+	}
+	if width > maxThreadIDWidth {
+		width = maxThreadIDWidth
+	}
+	buf.nDigits(width, i, id, ' ')
+	if id == 0 {
+		buf.Tmp[i+width-1] = '0'
+	}
+	return width
+}
+
+// goroutineID extracts the ID of the current goroutine from the first line of
+// its stack trace ("goroutine 123 [running]:").
+func goroutineID() int {
+	var stack [64]byte
+	data := stack[:runtime.Stack(stack[:], false)]
+	data = bytes.TrimPrefix(data, []byte("goroutine "))
+	id := 0
+	for _, c := range data {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int(c-'0')
+	}
+	return id
 }
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package color contains the ANSI escape sequences and terminal detection
+// for colored text output.
+package color
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// ANSI escape sequences.
+const (
+	Reset  = "\x1b[0m"
+	Dim    = "\x1b[2m"
+	Red    = "\x1b[31m"
+	Green  = "\x1b[32m"
+	Yellow = "\x1b[33m"
+	Cyan   = "\x1b[36m"
+	// BoldRed is used for fatal errors.
+	BoldRed = "\x1b[1;31m"
+)
+
+// Modes for enabling colors.
+const (
+	Never  = "never"
+	Auto   = "auto"
+	Always = "always"
+)
+
+// Enabled determines whether output to w gets colored in the given mode. In
+// Auto mode, that is the case if w is a terminal and the NO_COLOR environment
+// variable is empty (https://no-color.org).
+func Enabled(mode string, w io.Writer) bool {
+	switch mode {
+	case Always:
+		return true
+	case Auto:
+		if os.Getenv("NO_COLOR") != "" {
+			return false
+		}
+		return IsTerminal(w)
+	default:
+		return false
+	}
+}
+
+// IsTerminal checks whether w is a file for a character device like a
+// terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+var severityColors = [severity.NumSeverity]string{
+	severity.InfoLog:    Green,
+	severity.WarningLog: Yellow,
+	severity.ErrorLog:   Red,
+	severity.FatalLog:   BoldRed,
+}
+
+// Severity colors the severity letter at the start of a klog header which
+// begins at the start offset in the buffer.
+func Severity(b *bytes.Buffer, start int, s severity.Severity) {
+	if b.Len() <= start {
+		return
+	}
+	insert(b, start+1, Reset)
+	insert(b, start, severityColors[s])
+}
+
+// KeyValue colors a key/value pair in the format written by KVFormat which
+// begins at the start offset in the buffer. Keys get highlighted, the value
+// of "err" is shown in red and the value of "logger" is dimmed.
+func KeyValue(b *bytes.Buffer, start int, key string) {
+	// The pair is a space, the key, an equal sign and the value.
+	eq := start + 1 + len(key)
+	pair := b.Bytes()
+	if len(pair) <= eq || pair[start] != ' ' || pair[eq] != '=' {
+		return
+	}
+	keyColor, valueColor := Cyan, ""
+	switch key {
+	case "err":
+		keyColor, valueColor = Red, Red
+	case "logger":
+		valueColor = Dim
+	}
+	// Inserting from the end keeps the offsets valid.
+	if valueColor != "" {
+		b.WriteString(Reset)
+		insert(b, eq+1, valueColor)
+	}
+	insert(b, eq, Reset)
+	insert(b, start+1, keyColor)
+}
+
+// insert inserts the escape sequence at the offset, moving the rest of the
+// buffer content without copying it into a temporary buffer.
+func insert(b *bytes.Buffer, offset int, seq string) {
+	end := b.Len()
+	// Only makes room, the content gets overwritten below.
+	b.WriteString(seq)
+	buf := b.Bytes()
+	copy(buf[offset+len(seq):], buf[offset:end])
+	copy(buf[offset:], seq)
+}
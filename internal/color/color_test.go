@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package color
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+func TestEnabled(t *testing.T) {
+	var buffer bytes.Buffer
+	if Enabled(Auto, &buffer) {
+		t.Error("colors enabled for a buffer in auto mode")
+	}
+	if Enabled(Never, os.Stderr) {
+		t.Error("colors enabled in never mode")
+	}
+	if !Enabled(Always, &buffer) {
+		t.Error("colors not enabled in always mode")
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skipf("no terminal available: %v", err)
+	}
+	defer tty.Close()
+	t.Setenv("NO_COLOR", "")
+	if !Enabled(Auto, tty) {
+		t.Error("colors not enabled for a terminal in auto mode")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if Enabled(Auto, tty) {
+		t.Error("colors enabled for a terminal in auto mode despite NO_COLOR")
+	}
+}
+
+func TestColor(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("prefix:")
+	start := b.Len()
+	b.WriteString("W0102 msg")
+	Severity(&b, start, severity.WarningLog)
+	start = b.Len()
+	b.WriteString(` err="fail"`)
+	KeyValue(&b, start, "err")
+	start = b.Len()
+	b.WriteString(` logger="foo"`)
+	KeyValue(&b, start, "logger")
+	start = b.Len()
+	b.WriteString(` a=1`)
+	KeyValue(&b, start, "a")
+
+	expected := "prefix:" + Yellow + "W" + Reset + "0102 msg" +
+		" " + Red + "err" + Reset + "=" + Red + `"fail"` + Reset +
+		" " + Cyan + "logger" + Reset + "=" + Dim + `"foo"` + Reset +
+		" " + Cyan + "a" + Reset + "=1"
+	if b.String() != expected {
+		t.Errorf("unexpected output:\n%q\nexpected:\n%q", b.String(), expected)
+	}
+}
+
+func TestKeyValueAllocs(t *testing.T) {
+	var b bytes.Buffer
+	b.Grow(1024)
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Reset()
+		b.WriteString(` err="fail"`)
+		KeyValue(&b, 0, "err")
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %f", allocs)
+	}
+}
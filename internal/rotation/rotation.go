@@ -0,0 +1,81 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rotation contains the log file handling which is shared by the
+// file output of plog and the logfile package.
+package rotation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Day is the length of a day without daylight saving time changes.
+const Day = 24 * time.Hour
+
+// Next returns the first rotation boundary after t. Boundaries are
+// multiples of the interval, counted from midnight in the time zone of t,
+// with an additional boundary at each midnight. The zero time is returned
+// if time-based rotation is disabled.
+func Next(t time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return time.Time{}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if interval >= Day {
+		// AddDate instead of Add because days are not always
+		// 24 hours long.
+		return midnight.AddDate(0, 0, int(interval/Day))
+	}
+	next := midnight.Add((t.Sub(midnight)/interval + 1) * interval)
+	if nextMidnight := midnight.AddDate(0, 0, 1); next.After(nextMidnight) {
+		next = nextMidnight
+	}
+	return next
+}
+
+// Backup renames name to name.1 after shifting the existing backups
+// name.1 ... name.(maxBackups-1) up by one, which replaces the oldest backup.
+// Each step is an atomic rename that is done in an order which ensures that
+// a crash in the middle never loses a file other than the oldest backup.
+// Missing backups are skipped.
+func Backup(name string, maxBackups int) error {
+	for i := maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(BackupName(name, i), BackupName(name, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(name, BackupName(name, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// BackupName returns the name of the i-th backup of a log file.
+func BackupName(name string, i int) string {
+	return fmt.Sprintf("%s.%d", name, i)
+}
+
+// Header returns the header that gets added at the start of a log file.
+func Header(now time.Time, host string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
+	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
+	fmt.Fprintf(&buf, "Binary: Built with %s %s for %s/%s\n", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
+	return buf.Bytes()
+}
@@ -21,8 +21,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/internal/color"
 )
 
 type textWriter interface {
@@ -98,6 +101,10 @@ func MergeKVs(first, second []interface{}) []interface{} {
 
 type Formatter struct {
 	AnyToStringHook AnyToStringFunc
+
+	// Colors enables ANSI colors for keys and some values in
+	// MergeAndFormatKVs and KVListFormat.
+	Colors bool
 }
 
 type AnyToStringFunc func(v interface{}) string
@@ -114,7 +121,7 @@ func (f Formatter) MergeAndFormatKVs(b *bytes.Buffer, first, second []interface{
 		// Nothing to be overridden, second slice is well-formed
 		// and can be used directly.
 		for i := 0; i < len(second); i += 2 {
-			f.KVFormat(b, second[i], second[i+1])
+			f.formatKV(b, second[i], second[i+1])
 		}
 		return
 	}
@@ -134,16 +141,16 @@ func (f Formatter) MergeAndFormatKVs(b *bytes.Buffer, first, second []interface{
 		if overrides[key] {
 			continue
 		}
-		f.KVFormat(b, key, first[i+1])
+		f.formatKV(b, key, first[i+1])
 	}
 	// Round down.
 	l := len(second)
 	l = l / 2 * 2
 	for i := 1; i < l; i += 2 {
-		f.KVFormat(b, second[i-1], second[i])
+		f.formatKV(b, second[i-1], second[i])
 	}
 	if len(second)%2 == 1 {
-		f.KVFormat(b, second[len(second)-1], missingValue)
+		f.formatKV(b, second[len(second)-1], missingValue)
 	}
 }
 
@@ -164,8 +171,23 @@ func (f Formatter) KVListFormat(b *bytes.Buffer, keysAndValues ...interface{}) {
 		} else {
 			v = missingValue
 		}
+		f.formatKV(b, k, v)
+	}
+}
+
+// formatKV is KVFormat plus the optional coloring.
+func (f Formatter) formatKV(b *bytes.Buffer, k, v interface{}) {
+	if !f.Colors {
 		f.KVFormat(b, k, v)
+		return
+	}
+	start := b.Len()
+	f.KVFormat(b, k, v)
+	sK, ok := k.(string)
+	if !ok {
+		sK = fmt.Sprintf("%s", k)
 	}
+	color.KeyValue(b, start, sK)
 }
 
 func KVListFormat(b *bytes.Buffer, keysAndValues ...interface{}) {
@@ -176,6 +198,85 @@ func KVFormat(b *bytes.Buffer, k, v interface{}) {
 	Formatter{}.KVFormat(b, k, v)
 }
 
+// JSONListFormat serializes all key/value pairs as members of a JSON object
+// into the provided buffer. A comma gets inserted before each pair.
+func JSONListFormat(b *bytes.Buffer, keysAndValues ...interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{}
+		k := keysAndValues[i]
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		} else {
+			v = missingValue
+		}
+		JSONFormat(b, k, v)
+	}
+}
+
+// JSONFormat serializes one key/value pair as member of a JSON object into
+// the provided buffer. A comma gets inserted before the pair.
+func JSONFormat(b *bytes.Buffer, k, v interface{}) {
+	b.WriteByte(',')
+	if sK, ok := k.(string); ok {
+		writeJSONString(b, sK)
+	} else {
+		writeJSONString(b, fmt.Sprintf("%s", k))
+	}
+	b.WriteByte(':')
+	writeJSONValue(b, v)
+}
+
+// JSONValue serializes one value as JSON into the provided buffer. It has the
+// same preference for plain strings as JSONFormat.
+func JSONValue(b *bytes.Buffer, v interface{}) {
+	writeJSONValue(b, v)
+}
+
+// JSONString serializes a string as JSON string into the provided buffer.
+func JSONString(b *bytes.Buffer, s string) {
+	writeJSONString(b, s)
+}
+
+// writeJSONString quotes the string according to the JSON spec, which
+// differs from strconv.Quote for control characters and invalid UTF-8.
+// In contrast to encoding/json, HTML characters are not escaped.
+func writeJSONString(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c < 0x20:
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xF])
+			default:
+				b.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b.WriteString(`\ufffd`)
+		} else {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+}
+
 // formatAny is the fallback formatter for a value. It supports a hook (for
 // example, for YAML encoding) and itself uses JSON encoding.
 func (f Formatter) formatAny(b *bytes.Buffer, v interface{}) {
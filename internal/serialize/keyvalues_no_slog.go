@@ -95,3 +95,23 @@ func (f Formatter) KVFormat(b *bytes.Buffer, k, v interface{}) {
 		f.formatAny(b, v)
 	}
 }
+
+// writeJSONValue is used by the JSON output format. It quotes strings
+// according to the JSON spec.
+//
+// This is the version without slog support. Must be kept in sync with
+// the version in keyvalues_slog.go.
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case fmt.Stringer:
+		writeJSONString(b, StringerToString(v))
+	case logr.Marshaler:
+		writeJSONValue(b, MarshalerToValue(v))
+	case string:
+		writeJSONString(b, v)
+	case error:
+		writeJSONString(b, v.Error())
+	default:
+		formatAsJSON(b, v)
+	}
+}
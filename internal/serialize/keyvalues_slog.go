@@ -153,3 +153,41 @@ func generateJSON(b *bytes.Buffer, v interface{}) {
 		formatAsJSON(b, v)
 	}
 }
+
+// writeJSONValue is used by the JSON output format. In contrast to
+// generateJSON, which is meant for the text format and therefore uses Go
+// quoting, it quotes strings according to the JSON spec.
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case slog.Value:
+		switch v.Kind() {
+		case slog.KindGroup:
+			b.WriteByte('{')
+			for i, attr := range v.Group() {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				writeJSONString(b, attr.Key)
+				b.WriteByte(':')
+				writeJSONValue(b, attr.Value)
+			}
+			b.WriteByte('}')
+		case slog.KindLogValuer:
+			writeJSONValue(b, v.Resolve())
+		default:
+			writeJSONValue(b, v.Any())
+		}
+	case fmt.Stringer:
+		writeJSONString(b, StringerToString(v))
+	case logr.Marshaler:
+		writeJSONValue(b, MarshalerToValue(v))
+	case slog.LogValuer:
+		writeJSONValue(b, slog.AnyValue(v).Resolve().Any())
+	case string:
+		writeJSONString(b, v)
+	case error:
+		writeJSONString(b, v.Error())
+	default:
+		formatAsJSON(b, v)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serialize
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// logfmtLevel maps severities to the values of the level key in logfmt.
+var logfmtLevel = [severity.NumSeverity]string{
+	severity.InfoLog:    "info",
+	severity.WarningLog: "warning",
+	severity.ErrorLog:   "error",
+	severity.FatalLog:   "fatal",
+}
+
+// LogfmtHeader writes the well-known keys at the start of a log entry in
+// logfmt format: ts (time stamp in RFC 3339 format with microseconds), level
+// (info, warning, error, fatal), v (verbosity, skipped if negative), caller
+// (file:line) and msg.
+func LogfmtHeader(b *bytes.Buffer, now time.Time, s severity.Severity, v int, file string, line int, msg string) {
+	b.WriteString("ts=")
+	b.WriteString(now.Format("2006-01-02T15:04:05.000000Z07:00"))
+	b.WriteString(" level=")
+	b.WriteString(logfmtLevel[s])
+	if v >= 0 {
+		b.WriteString(" v=")
+		b.WriteString(strconv.Itoa(v))
+	}
+	b.WriteString(" caller=")
+	writeLogfmtString(b, file+":"+strconv.Itoa(line))
+	b.WriteString(" msg=")
+	writeLogfmtString(b, msg)
+}
+
+// JSONHeader writes the beginning of a JSON object with the well-known keys
+// of a log entry: ts (time stamp in RFC 3339 format with microseconds),
+// severity (INFO, WARNING, ERROR, FATAL), v (verbosity, skipped if negative),
+// caller (file:line) and msg. The closing brace is not written.
+func JSONHeader(b *bytes.Buffer, now time.Time, s severity.Severity, v int, file string, line int, msg string) {
+	b.WriteString(`{"ts":"`)
+	b.WriteString(now.Format("2006-01-02T15:04:05.000000Z07:00"))
+	b.WriteString(`","severity":"`)
+	b.WriteString(severity.Name[s])
+	b.WriteByte('"')
+	if v >= 0 {
+		b.WriteString(`,"v":`)
+		b.WriteString(strconv.Itoa(v))
+	}
+	b.WriteString(`,"caller":`)
+	writeJSONString(b, file+":"+strconv.Itoa(line))
+	b.WriteString(`,"msg":`)
+	writeJSONString(b, msg)
+}
+
+// LogfmtListFormat serializes all key/value pairs in logfmt format into the
+// provided buffer. A space gets inserted before each pair.
+func LogfmtListFormat(b *bytes.Buffer, keysAndValues ...interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{}
+		k := keysAndValues[i]
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		} else {
+			v = missingValue
+		}
+		LogfmtFormat(b, k, v)
+	}
+}
+
+// LogfmtFormat serializes one key/value pair in logfmt format into the
+// provided buffer. A space gets inserted before the pair.
+//
+// Characters which are not allowed in a logfmt key get replaced with an
+// underscore. Values are written as plain strings if possible, otherwise
+// they get quoted. Complex values are serialized as JSON first.
+func LogfmtFormat(b *bytes.Buffer, k, v interface{}) {
+	b.WriteByte(' ')
+	sK, ok := k.(string)
+	if !ok {
+		sK = fmt.Sprintf("%s", k)
+	}
+	writeLogfmtKey(b, sK)
+	b.WriteByte('=')
+
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case string:
+		writeLogfmtString(b, v)
+	case fmt.Stringer:
+		writeLogfmtString(b, StringerToString(v))
+	case error:
+		writeLogfmtString(b, ErrorToString(v))
+	case logr.Marshaler:
+		// Called only once, like in KVFormat.
+		switch value := MarshalerToValue(v).(type) {
+		case string:
+			writeLogfmtString(b, value)
+		default:
+			writeLogfmtAny(b, value)
+		}
+	case []byte:
+		writeLogfmtString(b, string(v))
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		fmt.Fprint(b, v)
+	default:
+		writeLogfmtAny(b, v)
+	}
+}
+
+// writeLogfmtAny serializes a value as JSON, then writes that as string.
+func writeLogfmtAny(b *bytes.Buffer, v interface{}) {
+	var value bytes.Buffer
+	writeJSONValue(&value, v)
+	writeLogfmtString(b, value.String())
+}
+
+// writeLogfmtKey writes the key, replacing all characters that are not
+// allowed. An empty key becomes a single underscore.
+func writeLogfmtKey(b *bytes.Buffer, k string) {
+	if k == "" {
+		b.WriteByte('_')
+		return
+	}
+	for _, r := range k {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+}
+
+// writeLogfmtString writes the string without quotes if possible,
+// otherwise quoted with JSON escaping. The empty string is always quoted.
+func writeLogfmtString(b *bytes.Buffer, s string) {
+	if s == "" || strings.IndexFunc(s, needsLogfmtQuoting) >= 0 {
+		writeJSONString(b, s)
+		return
+	}
+	b.WriteString(s)
+}
+
+func needsLogfmtQuoting(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serialize_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/internal/serialize"
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+func TestLogfmtFormat(t *testing.T) {
+	testKVList := []struct {
+		keysValues []interface{}
+		want       string
+	}{
+		{
+			keysValues: []interface{}{"pod", "kubedns"},
+			want:       " pod=kubedns",
+		},
+		{
+			keysValues: []interface{}{"msg", "hello world", "empty", ""},
+			want:       ` msg="hello world" empty=""`,
+		},
+		{
+			keysValues: []interface{}{"multi", "line1\nline2", "quote", `a"b`, "eq", "a=b"},
+			want:       ` multi="line1\nline2" quote="a\"b" eq="a=b"`,
+		},
+		{
+			keysValues: []interface{}{"int", 1, "float", 1.5, "bool", true, "nil", nil},
+			want:       " int=1 float=1.5 bool=true nil=null",
+		},
+		{
+			keysValues: []interface{}{"err", errors.New("failed"), "pod", plog.KRef("kube-system", "kubedns")},
+			want:       " err=failed pod=kube-system/kubedns",
+		},
+		{
+			keysValues: []interface{}{"map", map[string]int{"a": 1}, "slice", []int{1, 2}},
+			want:       ` map="{\"a\":1}" slice=[1,2]`,
+		},
+		{
+			keysValues: []interface{}{"bad key", 1, "", 2, "missing"},
+			want:       " bad_key=1 _=2 missing=(MISSING)",
+		},
+		{
+			keysValues: []interface{}{"marshaler", &dummyStructWithStringMarshal{"key", "value"}},
+			want:       ` marshaler="key=value"`,
+		},
+	}
+
+	for _, d := range testKVList {
+		b := &bytes.Buffer{}
+		serialize.LogfmtListFormat(b, d.keysValues...)
+		if b.String() != d.want {
+			t.Errorf("LogfmtListFormat error:\n got:\n\t%s\nwant:\t%s", b.String(), d.want)
+		}
+	}
+}
+
+func TestLogfmtHeader(t *testing.T) {
+	b := &bytes.Buffer{}
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	serialize.LogfmtHeader(b, now, severity.InfoLog, 2, "file.go", 10, "hello world")
+	serialize.LogfmtHeader(b, now, severity.ErrorLog, -1, "file.go", 11, "failed")
+	want := `ts=2006-01-02T15:04:05.067890Z level=info v=2 caller=file.go:10 msg="hello world"` +
+		`ts=2006-01-02T15:04:05.067890Z level=error caller=file.go:11 msg=failed`
+	if b.String() != want {
+		t.Errorf("LogfmtHeader error:\n got:\n\t%s\nwant:\t%s", b.String(), want)
+	}
+}
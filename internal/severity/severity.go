@@ -17,6 +17,7 @@
 package severity
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -46,6 +47,14 @@ var Name = []string{
 	FatalLog:   "FATAL",
 }
 
+// String returns the name of the severity level or, if unknown, its number.
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(Name) {
+		return strconv.Itoa(int(s))
+	}
+	return Name[s]
+}
+
 // ByName looks up a severity level by name.
 func ByName(s string) (Severity, bool) {
 	s = strings.ToUpper(s)
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sourcepath shortens the path of a source file for the log header.
+package sourcepath
+
+import (
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mode determines how much of the path is kept.
+type Mode int
+
+const (
+	// Base keeps only the file name.
+	Base Mode = iota
+	// Dir keeps the file name and the directory which contains it.
+	Dir
+	// Module keeps the path relative to the root of the Go module which
+	// contains the file.
+	Module
+)
+
+// Shorten returns the file name in the given mode. The function is the
+// fully qualified name of the function in that file, as returned by
+// runtime.FuncForPC or runtime.Frame.Function. Without it, Module falls back
+// to Base.
+func Shorten(function, file string, mode Mode) string {
+	slash := strings.LastIndex(file, "/")
+	if slash < 0 {
+		return file
+	}
+	switch mode {
+	case Dir:
+		if dirsep := strings.LastIndex(file[:slash], "/"); dirsep >= 0 {
+			return file[dirsep+1:]
+		}
+		return file
+	case Module:
+		if function == "" {
+			return file[slash+1:]
+		}
+		if shortened, ok := moduleCache.Load(file); ok {
+			return shortened.(string)
+		}
+		shortened := file[slash+1:]
+		if pkg := packagePath(function); pkg != "" {
+			if dir := relativeToModule(pkg); dir != "" && dir != "." {
+				shortened = dir + "/" + shortened
+			}
+		}
+		moduleCache.Store(file, shortened)
+		return shortened
+	default:
+		return file[slash+1:]
+	}
+}
+
+// moduleCache maps the path of a source file to the result of Shorten in
+// Module mode. All functions in a file belong to the same package, so the
+// function is not needed for the lookup.
+var moduleCache sync.Map
+
+// packagePath extracts the import path from a function name like
+// example.com/pkg.(*T).Method. Dots in the last element of the import path
+// are escaped as %2e in function names, for example in
+// gopkg.in/yaml%2ev3.Unmarshal.
+func packagePath(function string) string {
+	lastSlash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[lastSlash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	pkg := strings.ReplaceAll(function[:lastSlash+1+dot], "%2e", ".")
+	// Tests in an external test package.
+	pkg = strings.TrimSuffix(pkg, "_test")
+	if pkg == "main" {
+		return mainPath()
+	}
+	return pkg
+}
+
+// relativeToModule returns the directory of the package relative to the
+// root of its module. The module itself is ".". For packages from the
+// standard library, the entire import path is returned.
+func relativeToModule(pkg string) string {
+	for _, module := range modulePaths() {
+		switch {
+		case pkg == module:
+			return "."
+		case strings.HasPrefix(pkg, module+"/"):
+			return pkg[len(module)+1:]
+		}
+	}
+	return pkg
+}
+
+var (
+	buildInfoOnce sync.Once
+	modules       []string
+	mainPackage   string
+)
+
+func readBuildInfo() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	mainPackage = info.Path
+	if info.Main.Path != "" {
+		modules = append(modules, info.Main.Path)
+	}
+	for _, dep := range info.Deps {
+		modules = append(modules, dep.Path)
+	}
+	// The longest prefix must be found first because modules can be
+	// nested.
+	sort.Slice(modules, func(i, j int) bool { return len(modules[i]) > len(modules[j]) })
+}
+
+// modulePaths returns the paths of all modules in the binary, longest first.
+func modulePaths() []string {
+	buildInfoOnce.Do(readBuildInfo)
+	return modules
+}
+
+// mainPath returns the import path of the main package.
+func mainPath() string {
+	buildInfoOnce.Do(readBuildInfo)
+	return mainPackage
+}
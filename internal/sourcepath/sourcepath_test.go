@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sourcepath
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestShorten(t *testing.T) {
+	pc, file, _, _ := runtime.Caller(0)
+	function := runtime.FuncForPC(pc).Name()
+	for name, tc := range map[string]struct {
+		function, file string
+		mode           Mode
+		expected       string
+	}{
+		"base":          {function: function, file: file, mode: Base, expected: "sourcepath_test.go"},
+		"dir":           {function: function, file: file, mode: Dir, expected: "sourcepath/sourcepath_test.go"},
+		"module":        {function: function, file: file, mode: Module, expected: "internal/sourcepath/sourcepath_test.go"},
+		"module-root":   {function: "github.com/pohly/plog/v2.(*loggingT).header", file: "/src/plog/klog.go", mode: Module, expected: "klog.go"},
+		"external-test": {function: "github.com/pohly/plog/v2/textlogger_test.ExampleNewLogger.func1", file: "/src/plog/textlogger/example_test.go", mode: Module, expected: "textlogger/example_test.go"},
+		"dotted":        {function: "github.com/pohly/plog/v2/internal/foo%2ebar.F", file: "/src/plog/internal/foo.bar/foo.go", mode: Module, expected: "internal/foo.bar/foo.go"},
+		"dotted-other":  {function: "gopkg.in/yaml%2ev3.(*Decoder).Decode", file: "/go/pkg/mod/gopkg.in/yaml.v3@v3.0.1/decode.go", mode: Module, expected: "gopkg.in/yaml.v3/decode.go"},
+		"stdlib":        {function: "net/http.(*conn).serve", file: "/usr/local/go/src/net/http/server.go", mode: Module, expected: "net/http/server.go"},
+		"no-function":   {file: "/src/plog/klog.go", mode: Module, expected: "klog.go"},
+		"no-slash":      {function: function, file: "klog.go", mode: Dir, expected: "klog.go"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if actual := Shorten(tc.function, tc.file, tc.mode); actual != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestShortenCache(t *testing.T) {
+	file := "/src/other/cached.go"
+	expected := "example.com/other/pkg/cached.go"
+	if actual := Shorten("example.com/other/pkg.F", file, Module); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+	if cached, ok := moduleCache.Load(file); !ok || cached != expected {
+		t.Errorf("expected %q in cache, got %v", expected, cached)
+	}
+	// The cached result is used for all functions in the file.
+	if actual := Shorten("example.com/other/pkg.G", file, Module); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func BenchmarkShortenModule(b *testing.B) {
+	pc, file, _, _ := runtime.Caller(0)
+	function := runtime.FuncForPC(pc).Name()
+	for i := 0; i < b.N; i++ {
+		Shorten(function, file, Module)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Boosts keeps track of temporary verbosity boosts. They get applied on top
+// of the -v and -vmodule settings of their owner, which is either a VState
+// or the global logger in plog. The verbosity then is the maximum of -v and
+// the levels of all boosts. For each source code location, the vmodule
+// level is the maximum of the first matching pattern in -vmodule and in
+// each boost. Boosts therefore never lower the verbosity and the flags keep
+// their values.
+//
+// The zero value has no boosts. All methods except Start must be called
+// while holding the mutex of the owner.
+type Boosts struct {
+	active []*boost
+}
+
+// boost is one active verbosity boost.
+type boost struct {
+	level  Level
+	filter []modulePat
+	timer  *time.Timer
+}
+
+// Start starts a boost with the given level and vmodule patterns (same
+// syntax as -vmodule, may be empty). It ends when the duration expires or
+// when the returned cancel function is called, whichever comes first.
+//
+// mu is the mutex of the owner, which must not be locked by the caller.
+// changed gets called while holding mu after the boost started and after it
+// ended.
+func (b *Boosts) Start(mu sync.Locker, changed func(), level Level, vmodule string, duration time.Duration) (cancel func(), err error) {
+	if level < 0 {
+		return nil, errors.New("negative verbosity level")
+	}
+	if duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	filter, err := parseModuleSpec(vmodule)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	bst := &boost{level: level, filter: filter}
+	b.active = append(b.active, bst)
+	changed()
+
+	var once sync.Once
+	end := func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			// Not found after Stop.
+			for i, other := range b.active {
+				if other == bst {
+					b.active = append(b.active[:i:i], b.active[i+1:]...)
+					changed()
+					return
+				}
+			}
+		})
+	}
+	bst.timer = time.AfterFunc(duration, end)
+	return func() {
+		bst.timer.Stop()
+		end()
+	}, nil
+}
+
+// Level returns the highest level of all boosts, zero if there are none.
+func (b *Boosts) Level() Level {
+	var level Level
+	for _, bst := range b.active {
+		if bst.level > level {
+			level = bst.level
+		}
+	}
+	return level
+}
+
+// NumPatterns returns the number of vmodule patterns in all boosts.
+func (b *Boosts) NumPatterns() int {
+	num := 0
+	for _, bst := range b.active {
+		num += len(bst.filter)
+	}
+	return num
+}
+
+// ModuleLevel returns the highest level of the first matching vmodule
+// pattern in each boost, zero if none matches.
+func (b *Boosts) ModuleLevel(loc Location) Level {
+	var level Level
+	for _, bst := range b.active {
+		for _, filter := range bst.filter {
+			if filter.match(loc) {
+				if filter.level > level {
+					level = filter.level
+				}
+				break
+			}
+		}
+	}
+	return level
+}
+
+// Stop ends all boosts without calling changed.
+func (b *Boosts) Stop() {
+	for _, bst := range b.active {
+		bst.timer.Stop()
+	}
+	b.active = nil
+}
+
+// Boost starts a temporary verbosity boost, see Boosts.
+func (vs *VState) Boost(level Level, vmodule string, duration time.Duration) (cancel func(), err error) {
+	return vs.boosts.Start(&vs.mu, vs.boostsChanged, level, vmodule, duration)
+}
+
+// boostsChanged updates the state after a boost started or ended.
+// The mutex must be held.
+func (vs *VState) boostsChanged() {
+	vs.set(vs.verbosity.l, vs.vmodule.filter, true)
+}
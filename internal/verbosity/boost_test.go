@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func TestBoost(t *testing.T) {
+	vs := New()
+	require.NoError(t, vs.verbosity.Set("1"))
+	require.NoError(t, vs.vmodule.Set("base=2"))
+	check := func(t *testing.T, v, vmodule string, enabled Level) {
+		t.Helper()
+		if actual := vs.verbosity.String(); actual != v {
+			t.Errorf("expected v=%s, got %s", v, actual)
+		}
+		if actual := vs.vmodule.String(); actual != vmodule {
+			t.Errorf("expected vmodule=%q, got %q", vmodule, actual)
+		}
+		if !vs.Enabled(enabled, 0) {
+			t.Errorf("V(%d) not enabled", enabled)
+		}
+		if vs.Enabled(enabled+1, 0) {
+			t.Errorf("V(%d) enabled", enabled+1)
+		}
+	}
+
+	// The flags keep their values during boosts.
+	cancel1, err := vs.Boost(6, "", time.Hour)
+	require.NoError(t, err)
+	check(t, "1", "base=2", 6)
+	cancel2, err := vs.Boost(4, "boost_test=8", time.Hour)
+	require.NoError(t, err)
+	check(t, "1", "base=2", 8)
+
+	// Flags can be changed during boosts.
+	require.NoError(t, vs.verbosity.Set("2"))
+	require.NoError(t, vs.vmodule.Set("other=3"))
+	check(t, "2", "other=3", 8)
+
+	// Ending the older boost first keeps the newer one.
+	cancel1()
+	check(t, "2", "other=3", 8)
+	cancel1()
+	check(t, "2", "other=3", 8)
+	cancel2()
+	check(t, "2", "other=3", 2)
+}
+
+func TestBoostVModule(t *testing.T) {
+	vs := New()
+	require.NoError(t, vs.vmodule.Set("boost_test=5"))
+
+	// A boost does not lower the level of a matching -vmodule pattern.
+	cancel1, err := vs.Boost(0, "boost_test=2", time.Hour)
+	require.NoError(t, err)
+	defer cancel1()
+	if !vs.Enabled(5, 0) {
+		t.Error("V(5) not enabled during boost with lower vmodule level")
+	}
+
+	// Nor does a newer boost lower the level of an older one.
+	cancel2, err := vs.Boost(0, "boost*=7", time.Hour)
+	require.NoError(t, err)
+	defer cancel2()
+	cancel3, err := vs.Boost(0, "boost_test=6", time.Hour)
+	require.NoError(t, err)
+	defer cancel3()
+	if !vs.Enabled(7, 0) {
+		t.Error("V(7) not enabled during boosts")
+	}
+}
+
+func TestBoostExpires(t *testing.T) {
+	vs := New()
+	_, err := vs.Boost(3, "", time.Millisecond)
+	require.NoError(t, err)
+	for start := time.Now(); vs.Enabled(3, 0); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("boost did not expire")
+		}
+	}
+	if actual := vs.verbosity.String(); actual != "0" {
+		t.Errorf("expected v=0 after boost, got %s", actual)
+	}
+}
+
+func TestBoostErrors(t *testing.T) {
+	vs := New()
+	for name, tc := range map[string]struct {
+		level    Level
+		vmodule  string
+		duration time.Duration
+		expected string
+	}{
+		"negative-level":    {level: -1, duration: time.Second, expected: "negative verbosity level"},
+		"negative-duration": {level: 1, duration: -time.Second, expected: "duration must be positive"},
+		"vmodule":           {level: 1, vmodule: "x", duration: time.Second, expected: "syntax error: expect comma-separated list of filename=N"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := vs.Boost(tc.level, tc.vmodule, tc.duration)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected error %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
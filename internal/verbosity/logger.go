@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// LoggerFilter is the parsed value of a -vlogger flag: a list of logger
+// name patterns with their V level.
+type LoggerFilter []loggerPat
+
+// loggerPat contains a filter for the -vlogger flag.
+type loggerPat struct {
+	pattern string
+	literal bool // The pattern is a literal string
+	level   Level
+}
+
+var errVloggerSyntax = errors.New("syntax error: expect comma-separated list of name=N")
+
+// ParseLoggerFilter parses the value of a -vlogger flag.
+// Syntax: -vlogger=controller=2,controller.leader-election=4,*.cache=3
+func ParseLoggerFilter(value string) (LoggerFilter, error) {
+	var filter LoggerFilter
+	for _, pat := range strings.Split(value, ",") {
+		if len(pat) == 0 {
+			// Empty strings such as from a trailing comma can be ignored.
+			continue
+		}
+		patLev := strings.Split(pat, "=")
+		if len(patLev) != 2 || len(patLev[0]) == 0 || len(patLev[1]) == 0 {
+			return nil, errVloggerSyntax
+		}
+		pattern := patLev[0]
+		v, err := strconv.ParseInt(patLev[1], 10, 32)
+		if err != nil {
+			return nil, errVloggerSyntax
+		}
+		if v < 0 {
+			return nil, errors.New("negative value for vlogger level")
+		}
+		if v == 0 {
+			continue // Ignore. It's harmless but no point in paying the overhead.
+		}
+		filter = append(filter, loggerPat{pattern, isLiteral(pattern), Level(v)})
+	}
+	return filter, nil
+}
+
+func (f LoggerFilter) String() string {
+	var b bytes.Buffer
+	for i, p := range f {
+		if i > 0 {
+			b.WriteRune(',')
+		}
+		fmt.Fprintf(&b, "%s=%d", p.pattern, p.level)
+	}
+	return b.String()
+}
+
+// Level returns the V level of the first pattern which matches the logger
+// name, zero if none matches. The elements of the name are separated by
+// dots, as in the "logger" key added by WithName. A pattern matches a name
+// if its elements match the leading elements of the name, so a pattern
+// also applies to all loggers derived from a matching logger. Each element
+// is matched with filepath.Match.
+func (f LoggerFilter) Level(name string) Level {
+	if len(f) == 0 || name == "" {
+		return 0
+	}
+	names := strings.Split(name, ".")
+	for _, p := range f {
+		if matchElements(strings.Split(p.pattern, "."), true, p.literal, names) {
+			return p.level
+		}
+	}
+	return 0
+}
+
+// LoggerName holds the name of a logger together with a cache of the
+// -vlogger level for that name. A LogSink creates a new instance in
+// WithName and shares it with all copies which have the same name.
+type LoggerName struct {
+	name string
+	// cache is the generation of the filter in the upper 32 bits and the
+	// level in the lower 32 bits. It is accessed atomically.
+	cache uint64
+}
+
+// NewLoggerName creates a new instance without a cached level.
+func NewLoggerName(name string) *LoggerName {
+	return &LoggerName{name: name, cache: uint64(noGeneration) << 32}
+}
+
+// noGeneration is never used as generation of a filter.
+const noGeneration = ^uint32(0)
+
+// Name returns the name of the logger.
+func (n *LoggerName) Name() string {
+	return n.name
+}
+
+// Cached returns the cached level if it was computed for the given
+// generation of the filter.
+func (n *LoggerName) Cached(generation uint32) (Level, bool) {
+	cache := atomic.LoadUint64(&n.cache)
+	if uint32(cache>>32) != generation {
+		return 0, false
+	}
+	return Level(int32(uint32(cache))), true
+}
+
+// Store remembers the level for the given generation of the filter.
+func (n *LoggerName) Store(generation uint32, level Level) {
+	atomic.StoreUint64(&n.cache, uint64(generation)<<32|uint64(uint32(level)))
+}
+
+// loggerSpec represents the setting of the -vlogger flag.
+type loggerSpec struct {
+	vs         *VState
+	filter     LoggerFilter
+	generation uint32 // Incremented under lock, read atomically.
+}
+
+func (l *loggerSpec) String() string {
+	// Empty instances don't have and don't need a lock (can
+	// happen when flag uses introspection).
+	if l.vs != nil {
+		l.vs.mu.Lock()
+		defer l.vs.mu.Unlock()
+	}
+	return l.filter.String()
+}
+
+// Get is part of the (Go 1.2)  flag.Getter interface. It always returns nil for this flag type since the
+// struct is not exported.
+func (l *loggerSpec) Get() interface{} {
+	return nil
+}
+
+// Type is part of pflag.Value
+func (l *loggerSpec) Type() string {
+	return "name=N,..."
+}
+
+// Set will sets logger value
+// Syntax: -vlogger=controller=2,controller.leader-election=4,*.cache=3
+func (l *loggerSpec) Set(value string) error {
+	filter, err := ParseLoggerFilter(value)
+	if err != nil {
+		return err
+	}
+	l.vs.mu.Lock()
+	defer l.vs.mu.Unlock()
+	l.filter = filter
+	NextGeneration(&l.generation)
+	return nil
+}
+
+// NextGeneration increments the generation of a filter, skipping the value
+// which is reserved for "not cached". It must be called whenever the filter
+// changes. The caller must serialize calls, readers may use
+// atomic.LoadUint32.
+func NextGeneration(generation *uint32) {
+	next := *generation + 1
+	if next == noGeneration {
+		next = 0
+	}
+	atomic.StoreUint32(generation, next)
+}
+
+// VLogger returns the value for the -vlogger flag.
+func (vs *VState) VLogger() Value {
+	return &vs.vlogger
+}
+
+// LoggerLevel returns the -vlogger level for the logger name. It only
+// locks the mutex when the level is not cached yet.
+func (vs *VState) LoggerLevel(name *LoggerName) Level {
+	if level, ok := name.Cached(atomic.LoadUint32(&vs.vlogger.generation)); ok {
+		return level
+	}
+	vs.mu.Lock()
+	filter, generation := vs.vlogger.filter, vs.vlogger.generation
+	vs.mu.Unlock()
+	level := filter.Level(name.name)
+	name.Store(generation, level)
+	return level
+}
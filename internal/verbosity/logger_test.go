@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func TestLoggerFilter(t *testing.T) {
+	filter, err := ParseLoggerFilter("controller.leader-election=4,controller=2,*.cache=3,x=0,")
+	require.NoError(t, err)
+	if expected, actual := "controller.leader-election=4,controller=2,*.cache=3", filter.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	for name, expected := range map[string]Level{
+		"":                               0,
+		"controller":                     2,
+		"controller.leader-election":     4,
+		"controller.leader-election.sub": 4,
+		"controller.other":               2,
+		"controllers":                    0,
+		"store.cache":                    3,
+		"store.cache.sub":                3,
+		"store.x.cache":                  0,
+		"x":                              0,
+	} {
+		if actual := filter.Level(name); actual != expected {
+			t.Errorf("%q: expected level %d, got %d", name, expected, actual)
+		}
+	}
+}
+
+func TestLoggerFilterSyntax(t *testing.T) {
+	for value, expected := range map[string]string{
+		"a":     "syntax error: expect comma-separated list of name=N",
+		"a=b":   "syntax error: expect comma-separated list of name=N",
+		"=1":    "syntax error: expect comma-separated list of name=N",
+		"a=1=2": "syntax error: expect comma-separated list of name=N",
+		"a=-1":  "negative value for vlogger level",
+	} {
+		_, err := ParseLoggerFilter(value)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected error %q, got %v", value, expected, err)
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	vs := New()
+	name := NewLoggerName("controller")
+	if level := vs.LoggerLevel(name); level != 0 {
+		t.Errorf("expected level 0 without filter, got %d", level)
+	}
+	require.NoError(t, vs.VLogger().Set("controller=2"))
+	if level := vs.LoggerLevel(name); level != 2 {
+		t.Errorf("expected level 2, got %d", level)
+	}
+	if level, ok := name.Cached(vs.vlogger.generation); !ok || level != 2 {
+		t.Errorf("expected cached level 2, got %d, %v", level, ok)
+	}
+	require.NoError(t, vs.VLogger().Set("controller=5"))
+	if level := vs.LoggerLevel(name); level != 5 {
+		t.Errorf("expected level 5 after changing the filter, got %d", level)
+	}
+	if expected, actual := "controller=5", vs.VLogger().String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// funcPrefix marks a -vmodule pattern which matches function names.
+const funcPrefix = "func:"
+
+// Location describes the source code of a V call for -vmodule matching.
+type Location struct {
+	// File is the path of the source file without the .go suffix.
+	File string
+	// Package is the import path of the package.
+	Package string
+	// Function is the name of the function, including the package
+	// import path. Methods are written as pkg.Type.Method, without
+	// parentheses and pointer, type parameters are removed.
+	Function string
+}
+
+var functionReplacer = strings.NewReplacer("(*", "", ")", "", "[...]", "")
+
+// LocationForPC returns the location for a program counter.
+func LocationForPC(pc uintptr) Location {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return Location{}
+	}
+	file, _ := fn.FileLine(pc)
+	name := functionReplacer.Replace(fn.Name())
+	pkg := name
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		pkg = name[:slash+1+dot]
+	}
+	return Location{
+		File:     strings.TrimSuffix(file, ".go"),
+		Package:  pkg,
+		Function: name,
+	}
+}
+
+// CheckPattern validates the syntax of a single -vmodule pattern.
+func CheckPattern(pattern string) error {
+	if strings.HasPrefix(pattern, funcPrefix) {
+		if pattern == funcPrefix {
+			return errors.New("syntax error: empty function name in vmodule pattern")
+		}
+		return nil
+	}
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if elem == "..." && (i == 0 || i != len(elems)-1) {
+			return errors.New("syntax error: ... is only supported as last element of a vmodule path pattern")
+		}
+	}
+	return nil
+}
+
+// MatchPattern reports whether a -vmodule pattern matches the location.
+// Each pattern or path element of it uses filepath.Match unless literal is
+// true, in which case a string comparison is used. There are three kinds
+// of patterns:
+//   - A pattern without a slash matches the base name of the source file.
+//   - A pattern with a slash matches the package import path, the directory
+//     of the source file or the source file itself, in both cases ignoring
+//     leading directories. With "/..." as last element it also matches
+//     everything below that.
+//   - A pattern with the "func:" prefix matches the function name qualified
+//     with the last element of the package import path (scheduler.Run for
+//     k8s.io/kubernetes/pkg/scheduler.Run), or the full function name if
+//     the pattern contains a slash. Function literals inside a function
+//     are matched by the pattern for that function.
+func MatchPattern(pattern string, literal bool, loc Location) bool {
+	if strings.HasPrefix(pattern, funcPrefix) {
+		return matchFunction(pattern[len(funcPrefix):], literal, loc.Function)
+	}
+	if !strings.Contains(pattern, "/") {
+		return matchElement(pattern, literal, loc.File[strings.LastIndex(loc.File, "/")+1:])
+	}
+	elems := strings.Split(pattern, "/")
+	recursive := elems[len(elems)-1] == "..."
+	if recursive {
+		elems = elems[:len(elems)-1]
+	}
+	if matchElements(elems, recursive, literal, strings.Split(loc.Package, "/")) {
+		return true
+	}
+	file := strings.Split(loc.File, "/")
+	dir := file[:len(file)-1]
+	for i := range file {
+		if matchElements(elems, recursive, literal, file[i:]) ||
+			i < len(dir) && matchElements(elems, recursive, literal, dir[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElements matches the beginning of the path against the pattern
+// elements. The entire path must match unless recursive is true.
+func matchElements(elems []string, recursive, literal bool, path []string) bool {
+	if len(path) < len(elems) || !recursive && len(path) != len(elems) {
+		return false
+	}
+	for i, elem := range elems {
+		if !matchElement(elem, literal, path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchFunction(pattern string, literal bool, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+	for {
+		if matchElement(pattern, literal, name) {
+			return true
+		}
+		// Try again with the enclosing function.
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 || !isFuncLiteral(name[dot+1:]) {
+			return false
+		}
+		name = name[:dot]
+	}
+}
+
+// isFuncLiteral reports whether the last element of a function name
+// was generated by the compiler for a function literal (func1, 2)
+// or a go statement (gowrap1).
+func isFuncLiteral(elem string) bool {
+	if strings.HasPrefix(elem, "func") {
+		elem = elem[len("func"):]
+	} else if strings.HasPrefix(elem, "gowrap") {
+		elem = elem[len("gowrap"):]
+	}
+	if elem == "" {
+		return false
+	}
+	for _, r := range elem {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func matchElement(pattern string, literal bool, s string) bool {
+	if literal {
+		return s == pattern
+	}
+	match, _ := filepath.Match(pattern, s)
+	return match
+}
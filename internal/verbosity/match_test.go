@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verbosity
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+type receiver struct{}
+
+func (*receiver) location() (loc Location) {
+	func() {
+		pc, _, _, _ := runtime.Caller(0)
+		loc = LocationForPC(pc)
+	}()
+	return
+}
+
+func TestLocationForPC(t *testing.T) {
+	loc := new(receiver).location()
+	if !strings.HasSuffix(loc.File, "/internal/verbosity/match_test") {
+		t.Errorf("unexpected file: %q", loc.File)
+	}
+	if expected := "github.com/pohly/plog/v2/internal/verbosity"; loc.Package != expected {
+		t.Errorf("expected package %q, got %q", expected, loc.Package)
+	}
+	if expected := "github.com/pohly/plog/v2/internal/verbosity.receiver.location.func1"; loc.Function != expected {
+		t.Errorf("expected function %q, got %q", expected, loc.Function)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	loc := Location{
+		File:     "/home/user/src/k8s.io/kubernetes/pkg/scheduler/framework/cycle",
+		Package:  "k8s.io/kubernetes/pkg/scheduler/framework",
+		Function: "k8s.io/kubernetes/pkg/scheduler/framework.CycleState.Read.func1.2",
+	}
+	for pattern, expected := range map[string]bool{
+		"cycle":  true,
+		"cyc*":   true,
+		"frame*": false,
+
+		"k8s.io/kubernetes/pkg/scheduler/framework":       true,
+		"k8s.io/kubernetes/pkg/scheduler":                 false,
+		"k8s.io/kubernetes/pkg/scheduler/...":             true,
+		"k8s.io/kubernetes/pkg/scheduler/framework/...":   true,
+		"k8s.io/kubernetes/pkg/sched*/...":                true,
+		"k8s.io/kubernetes/pkg/kubelet/...":               false,
+		"kubernetes/pkg/scheduler/...":                    true,
+		"pkg/scheduler/framework":                         true,
+		"pkg/scheduler/framework/cycle":                   true,
+		"pkg/scheduler/framework/c*":                      true,
+		"pkg/scheduler":                                   false,
+		"/home/user/src/k8s.io/kubernetes/pkg/...":        true,
+		"/src/k8s.io/kubernetes/pkg/...":                  false,
+		"scheduler/framework/cycle/...":                   true,
+		"framework/cycle/x":                               false,
+		"k8s.io/kubernetes/pkg/scheduler/framework/x/...": false,
+
+		"func:framework.CycleState.Read":                                 true,
+		"func:framework.CycleState.Read.func1":                           true,
+		"func:framework.CycleState.Read.func1.2":                         true,
+		"func:framework.CycleState.*":                                    true,
+		"func:framework.*":                                               true,
+		"func:framework.CycleState":                                      false,
+		"func:CycleState.Read":                                           false,
+		"func:k8s.io/kubernetes/pkg/scheduler/framework.CycleState.Read": true,
+		"func:k8s.io/kubernetes/pkg/scheduler/*.CycleState.Read":         true,
+		"func:k8s.io/kubernetes/pkg/scheduler.CycleState.Read":           false,
+		"func:framework.CycleState.Write":                                false,
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			if actual := MatchPattern(pattern, isLiteral(pattern), loc); actual != expected {
+				t.Errorf("expected match %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestCheckPattern(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"file":           "",
+		"pkg/...":        "",
+		"/...":           "",
+		"func:main.main": "",
+		"func:":          "syntax error: empty function name in vmodule pattern",
+		"pkg/.../file":   "syntax error: ... is only supported as last element of a vmodule path pattern",
+		".../file":       "syntax error: ... is only supported as last element of a vmodule path pattern",
+		"...":            "syntax error: ... is only supported as last element of a vmodule path pattern",
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			err := CheckPattern(pattern)
+			actual := ""
+			if err != nil {
+				actual = err.Error()
+			}
+			if actual != expected {
+				t.Errorf("expected error %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestVmodulePath(t *testing.T) {
+	for pattern, expected := range map[string]bool{
+		"github.com/pohly/plog/v2/internal/verbosity=2":    true,
+		"github.com/pohly/plog/v2/internal/...=2":          true,
+		"github.com/pohly/plog/v2/internal=2":              false,
+		"internal/verbosity/verbosity_test=2":              false,
+		"internal/verbosity/match_test=2":                  true,
+		"func:verbosity.TestVmodulePath=2":                 true,
+		"func:verbosity.TestVmodulePath.func1=2":           true,
+		"func:verbosity.enabledInHelper=2":                 false,
+		"func:github.com/pohly/plog/v2/internal/*.Test*=2": true,
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			vs := New()
+			require.NoError(t, vs.vmodule.Set(pattern))
+			if actual := vs.Enabled(2, 0); actual != expected {
+				t.Errorf("expected enabled %v, got %v", expected, actual)
+			}
+		})
+	}
+}
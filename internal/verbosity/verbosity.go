@@ -22,7 +22,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -30,16 +29,17 @@ import (
 	"sync/atomic"
 )
 
-// New returns a struct that implements -v and -vmodule support. Changing and
+// New returns a struct that implements -v, -vmodule and -vlogger support. Changing and
 // checking these settings is thread-safe, with all concurrency issues handled
 // internally.
 func New() *VState {
 	vs := new(VState)
 
-	// The two fields must have a pointer to the overal struct for their
+	// These fields must have a pointer to the overal struct for their
 	// implementation of Set.
 	vs.vmodule.vs = vs
 	vs.verbosity.vs = vs
+	vs.vlogger.vs = vs
 
 	return vs
 }
@@ -67,6 +67,7 @@ type VState struct {
 	// safely using atomic.LoadInt32.
 	vmodule   moduleSpec // The state of the -vmodule flag.
 	verbosity levelSpec  // V logging level, the value of the -v flag/
+	vlogger   loggerSpec // The state of the -vlogger flag.
 
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
@@ -77,6 +78,12 @@ type VState struct {
 	// than zero, it means vmodule is enabled. It may be read safely
 	// using sync.LoadInt32, but is only modified under mu.
 	filterLength int32
+
+	// boosts are the active verbosity boosts.
+	boosts Boosts
+	// effective is the maximum of the -v flag and the boosts. It may be
+	// read safely using atomic.LoadInt32, but is only modified under mu.
+	effective Level
 }
 
 // Level must be an int32 to support atomic read/writes.
@@ -87,11 +94,6 @@ type levelSpec struct {
 	l  Level
 }
 
-// get returns the value of the level.
-func (l *levelSpec) get() Level {
-	return Level(atomic.LoadInt32((*int32)(&l.l)))
-}
-
 // set sets the value of the level.
 func (l *levelSpec) set(val Level) {
 	atomic.StoreInt32((*int32)(&l.l), int32(val))
@@ -132,21 +134,17 @@ type moduleSpec struct {
 }
 
 // modulePat contains a filter for the -vmodule flag.
-// It holds a verbosity level and a file pattern to match.
+// It holds a verbosity level and a pattern to match, see MatchPattern.
 type modulePat struct {
 	pattern string
 	literal bool // The pattern is a literal string
 	level   Level
 }
 
-// match reports whether the file matches the pattern. It uses a string
+// match reports whether the location matches the pattern. It uses a string
 // comparison if the pattern contains no metacharacters.
-func (m *modulePat) match(file string) bool {
-	if m.literal {
-		return file == m.pattern
-	}
-	match, _ := filepath.Match(m.pattern, file)
-	return match
+func (m *modulePat) match(loc Location) bool {
+	return MatchPattern(m.pattern, m.literal, loc)
 }
 
 func (m *moduleSpec) String() string {
@@ -181,8 +179,19 @@ func (m *moduleSpec) Type() string {
 var errVmoduleSyntax = errors.New("syntax error: expect comma-separated list of filename=N")
 
 // Set will sets module value
-// Syntax: -vmodule=recordio=2,file=1,gfs*=3
+// Syntax: -vmodule=recordio=2,file=1,gfs*=3,k8s.io/kubernetes/pkg/scheduler/...=4,func:scheduler.Scheduler.Run=5
 func (m *moduleSpec) Set(value string) error {
+	filter, err := parseModuleSpec(value)
+	if err != nil {
+		return err
+	}
+	m.vs.mu.Lock()
+	defer m.vs.mu.Unlock()
+	m.vs.set(m.vs.verbosity.l, filter, true)
+	return nil
+}
+
+func parseModuleSpec(value string) ([]modulePat, error) {
 	var filter []modulePat
 	for _, pat := range strings.Split(value, ",") {
 		if len(pat) == 0 {
@@ -191,26 +200,25 @@ func (m *moduleSpec) Set(value string) error {
 		}
 		patLev := strings.Split(pat, "=")
 		if len(patLev) != 2 || len(patLev[0]) == 0 || len(patLev[1]) == 0 {
-			return errVmoduleSyntax
+			return nil, errVmoduleSyntax
 		}
 		pattern := patLev[0]
 		v, err := strconv.ParseInt(patLev[1], 10, 32)
 		if err != nil {
-			return errors.New("syntax error: expect comma-separated list of filename=N")
+			return nil, errors.New("syntax error: expect comma-separated list of filename=N")
 		}
 		if v < 0 {
-			return errors.New("negative value for vmodule level")
+			return nil, errors.New("negative value for vmodule level")
 		}
 		if v == 0 {
 			continue // Ignore. It's harmless but no point in paying the overhead.
 		}
-		// TODO: check syntax of filter?
+		if err := CheckPattern(pattern); err != nil {
+			return nil, err
+		}
 		filter = append(filter, modulePat{pattern, isLiteral(pattern), Level(v)})
 	}
-	m.vs.mu.Lock()
-	defer m.vs.mu.Unlock()
-	m.vs.set(m.vs.verbosity.l, filter, true)
-	return nil
+	return filter, nil
 }
 
 // isLiteral reports whether the pattern is a literal string, that is, has no metacharacters
@@ -219,11 +227,12 @@ func isLiteral(pattern string) bool {
 	return !strings.ContainsAny(pattern, `\*?[]`)
 }
 
-// set sets a consistent state for V logging.
+// set sets a consistent state for V logging, with the boosts applied on
+// top of the flags.
 // The mutex must be held.
 func (vs *VState) set(l Level, filter []modulePat, setFilter bool) {
 	// Turn verbosity off so V will not fire while we are in transition.
-	vs.verbosity.set(0)
+	atomic.StoreInt32((*int32)(&vs.effective), 0)
 	// Ditto for filter length.
 	atomic.StoreInt32(&vs.filterLength, 0)
 
@@ -232,11 +241,16 @@ func (vs *VState) set(l Level, filter []modulePat, setFilter bool) {
 		vs.vmodule.filter = filter
 		vs.vmap = make(map[uintptr]Level)
 	}
+	vs.verbosity.set(l)
+	effective := l
+	if boost := vs.boosts.Level(); boost > effective {
+		effective = boost
+	}
 
 	// Things are consistent now, so enable filtering and verbosity.
 	// They are enabled in order opposite to that in V.
-	atomic.StoreInt32(&vs.filterLength, int32(len(filter)))
-	vs.verbosity.set(l)
+	atomic.StoreInt32(&vs.filterLength, int32(len(filter)+vs.boosts.NumPatterns()))
+	atomic.StoreInt32((*int32)(&vs.effective), int32(effective))
 }
 
 // Enabled checks whether logging is enabled at the given level. This must be
@@ -249,7 +263,7 @@ func (vs *VState) Enabled(level Level, depth int) bool {
 	// The fast path is two atomic loads and compares.
 
 	// Here is a cheap but safe test to see if V logging is enabled globally.
-	if vs.verbosity.get() >= level {
+	if Level(atomic.LoadInt32((*int32)(&vs.effective))) >= level {
 		return true
 	}
 
@@ -280,24 +294,20 @@ func (vs *VState) Enabled(level Level, depth int) bool {
 
 // setV computes and remembers the V level for a given PC
 // when vmodule is enabled.
-// File pattern matching takes the basename of the file, stripped
-// of its .go suffix, and uses filepath.Match, which is a little more
-// general than the *? matching used in C++.
+// Pattern matching is described in MatchPattern. It uses filepath.Match,
+// which is a little more general than the *? matching used in C++.
 // Mutex is held.
 func (vs *VState) setV(pc uintptr) Level {
-	fn := runtime.FuncForPC(pc)
-	file, _ := fn.FileLine(pc)
-	// The file is something like /a/b/c/d.go. We want just the d.
-	file = strings.TrimSuffix(file, ".go")
-	if slash := strings.LastIndex(file, "/"); slash >= 0 {
-		file = file[slash+1:]
-	}
+	loc := LocationForPC(pc)
+	level := vs.boosts.ModuleLevel(loc)
 	for _, filter := range vs.vmodule.filter {
-		if filter.match(file) {
-			vs.vmap[pc] = filter.level
-			return filter.level
+		if filter.match(loc) {
+			if filter.level > level {
+				level = filter.level
+			}
+			break
 		}
 	}
-	vs.vmap[pc] = 0
-	return 0
+	vs.vmap[pc] = level
+	return level
 }
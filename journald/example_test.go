@@ -0,0 +1,34 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald_test
+
+import (
+	"github.com/pohly/plog/v2/journald"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func ExampleDial() {
+	writer, err := journald.Dial("")
+	if err != nil {
+		panic(err)
+	}
+	defer writer.Close()
+
+	logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(writer)))
+	// Shows up with the fields MESSAGE=hello world and POD=kube-system/coredns.
+	logger.Info("hello world", "pod", "kube-system/coredns")
+}
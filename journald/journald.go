@@ -0,0 +1,229 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package journald provides a writer which sends log entries in the klog
+// text format to systemd-journald, using its native protocol. It can be used
+// wherever an io.Writer is accepted, for example with plog.SetOutput,
+// plog.SetOutputBySeverity or textlogger.Output.
+//
+// Each call to Write must contain exactly one log entry, which is how plog
+// and textlogger write their output. The entry becomes a journal entry with
+// the fields MESSAGE, PRIORITY (derived from the severity), CODE_FILE,
+// CODE_LINE and SYSLOG_IDENTIFIER. Each key/value pair becomes an additional
+// field. Its name is the key in upper case, with all characters other than
+// letters, digits and underscores replaced by underscores. Keys that would
+// collide with fields that journald itself defines get a "KV_" prefix, see
+// FieldName.
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// SocketPath is the socket of systemd-journald for the native protocol.
+const SocketPath = "/run/systemd/journal/socket"
+
+// Writer sends log entries to systemd-journald. Entries which are too large
+// for a single datagram get passed via a sealed memfd, like sd_journal_send
+// does. A Writer is safe for concurrent use.
+type Writer struct {
+	config config
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+type config struct {
+	identifier string
+}
+
+// Option implements functional parameters for Dial.
+type Option func(*config)
+
+// Identifier overrides the base name of the program in the
+// SYSLOG_IDENTIFIER field.
+func Identifier(identifier string) Option {
+	return func(c *config) {
+		c.identifier = identifier
+	}
+}
+
+// Dial connects to the journal socket at the given path. If the path is
+// empty, SocketPath is used.
+func Dial(path string, opts ...Option) (*Writer, error) {
+	if path == "" {
+		path = SocketPath
+	}
+	w := &Writer{
+		config: config{
+			identifier: filepath.Base(os.Args[0]),
+		},
+	}
+	for _, opt := range opts {
+		opt(&w.config)
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("journald: unable to connect: %v", err)
+	}
+	w.conn = conn
+	return w, nil
+}
+
+// Write is part of the io.Writer interface. It sends one log entry.
+func (w *Writer) Write(p []byte) (int, error) {
+	data := w.format(textparser.Parse(p))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return 0, errClosed
+	}
+	_, err := w.conn.Write(data)
+	if err != nil && isTooLarge(err) {
+		err = sendLarge(w.conn, data)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("journald: %v", err)
+	}
+	return len(p), nil
+}
+
+// Close closes the connection. Writing is not possible afterwards.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return errClosed
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+var errClosed = errors.New("journald writer is closed")
+
+// priority maps plog severities to syslog priorities.
+var priority = [...]string{
+	textparser.SeverityInfo:    "6", // informational
+	textparser.SeverityWarning: "4", // warning
+	textparser.SeverityError:   "3", // error
+	textparser.SeverityFatal:   "2", // critical
+}
+
+// format serializes the entry as fields of the native journal protocol.
+func (w *Writer) format(r textparser.Record) []byte {
+	var b bytes.Buffer
+	writeField(&b, "MESSAGE", r.Message)
+	writeField(&b, "PRIORITY", priority[r.Severity])
+	if r.HasHeader {
+		writeField(&b, "CODE_FILE", r.File)
+		writeField(&b, "CODE_LINE", strconv.Itoa(r.Line))
+	}
+	if w.config.identifier != "" {
+		writeField(&b, "SYSLOG_IDENTIFIER", w.config.identifier)
+	}
+	for _, kv := range r.Values {
+		writeField(&b, FieldName(kv.Key), kv.Value)
+	}
+	return b.Bytes()
+}
+
+// writeField writes NAME=value and a newline. Values with line breaks get
+// written as NAME, newline, the size as 64 bit little endian integer, the
+// value and a newline.
+func writeField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b.Write(size[:])
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// FieldName turns a key into a valid journal field name: letters get
+// converted to upper case, other characters except digits and underscores
+// become underscores. Leading underscores are removed because they are
+// reserved for trusted fields. Names which would start with a digit or be
+// empty get prefixed with "KEY_". The result is limited to 64 characters.
+// Names of fields that have a special meaning for journald, for example
+// MESSAGE or PRIORITY, get prefixed with "KV_" so that they cannot be
+// mistaken for the fields set by Writer.
+func FieldName(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z':
+			r -= 'a' - 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	name := strings.TrimLeft(b.String(), "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "KEY_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if reservedFields[name] {
+		name = "KV_" + name
+	}
+	return name
+}
+
+// reservedFields are the user journal fields documented in
+// systemd.journal-fields(7). Writer sets some of them itself.
+var reservedFields = map[string]bool{
+	"MESSAGE":            true,
+	"MESSAGE_ID":         true,
+	"PRIORITY":           true,
+	"CODE_FILE":          true,
+	"CODE_LINE":          true,
+	"CODE_FUNC":          true,
+	"ERRNO":              true,
+	"INVOCATION_ID":      true,
+	"USER_INVOCATION_ID": true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_IDENTIFIER":  true,
+	"SYSLOG_PID":         true,
+	"SYSLOG_TIMESTAMP":   true,
+	"SYSLOG_RAW":         true,
+	"DOCUMENTATION":      true,
+	"TID":                true,
+	"UNIT":               true,
+	"USER_UNIT":          true,
+}
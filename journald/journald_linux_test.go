@@ -0,0 +1,62 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+// Passing file descriptors is only supported on Linux.
+func TestLarge(t *testing.T) {
+	server, path := listen(t)
+	w, err := Dial(path, Identifier("app"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	// Larger than the default maximum datagram size.
+	value := strings.Repeat("x", 4*1024*1024)
+	_, err = w.Write([]byte(`I0102 15:04:05.067890    1234 main.go:42] "large" value="` + value + `"` + "\n"))
+	require.NoError(t, err)
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := server.ReadMsgUnix(nil, oob)
+	require.NoError(t, err)
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	require.NoError(t, err)
+	if len(messages) != 1 {
+		t.Fatalf("expected one control message, got %d", len(messages))
+	}
+	fds, err := syscall.ParseUnixRights(&messages[0])
+	require.NoError(t, err)
+	file := os.NewFile(uintptr(fds[0]), "memfd")
+	defer file.Close()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	expected := "MESSAGE=large\nPRIORITY=6\nCODE_FILE=main.go\nCODE_LINE=42\nSYSLOG_IDENTIFIER=app\nVALUE=" + value + "\n"
+	if string(content) != expected {
+		t.Errorf("unexpected content with %d bytes, expected %d bytes", len(content), len(expected))
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+	"github.com/pohly/plog/v2/textlogger"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+func TestFieldName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"podName":               "PODNAME",
+		"http.status":           "HTTP_STATUS",
+		"_secret":               "SECRET",
+		"2fa":                   "KEY_2FA",
+		"":                      "KEY_",
+		"grüße":                 "GR__E",
+		strings.Repeat("a", 70): strings.Repeat("A", 64),
+		"message":               "KV_MESSAGE",
+		"code.file":             "KV_CODE_FILE",
+		"_priority":             "KV_PRIORITY",
+	} {
+		if actual := FieldName(key); actual != expected {
+			t.Errorf("FieldName(%q): expected %q, got %q", key, expected, actual)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	w := &Writer{config: config{identifier: "app"}}
+	actual := string(w.format(textparser.Parse([]byte("E0102 15:04:05.067890    1234 main.go:42] \"oops\" err=\"fail\" text=<\n\tline 1\n\tline 2\n >\n"))))
+	expected := "MESSAGE=oops\nPRIORITY=3\nCODE_FILE=main.go\nCODE_LINE=42\nSYSLOG_IDENTIFIER=app\nERR=fail\n" +
+		"TEXT\n\x0d\x00\x00\x00\x00\x00\x00\x00line 1\nline 2\n"
+	if actual != expected {
+		t.Errorf("unexpected fields:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
+func TestFormatCollision(t *testing.T) {
+	w := &Writer{config: config{identifier: "app"}}
+	actual := string(w.format(textparser.Parse([]byte("I0102 15:04:05.067890    1234 main.go:42] \"hello\" message=\"fake\" priority=\"2\" code_line=1 syslog_identifier=\"other\"\n"))))
+	expected := "MESSAGE=hello\nPRIORITY=6\nCODE_FILE=main.go\nCODE_LINE=42\nSYSLOG_IDENTIFIER=app\n" +
+		"KV_MESSAGE=fake\nKV_PRIORITY=2\nKV_CODE_LINE=1\nKV_SYSLOG_IDENTIFIER=other\n"
+	if actual != expected {
+		t.Errorf("unexpected fields:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
+// listen creates a unixgram socket which acts as journald.
+func listen(t *testing.T) (*net.UnixConn, string) {
+	// The path of a unix domain socket must be short.
+	dir, err := os.MkdirTemp("", "journald")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "socket")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+	return server, path
+}
+
+func TestUnixgram(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+	server, path := listen(t)
+	w, err := Dial(path, Identifier("app"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(w)))
+	logger.WithName("foo").Error(errors.New("fail"), "oops", "podName", "pod-1")
+	logger.Info("hello")
+
+	re := regexp.MustCompile(`CODE_LINE=[0-9]+`)
+	buffer := make([]byte, 4096)
+	for _, expected := range []string{
+		"MESSAGE=oops\nPRIORITY=3\nCODE_FILE=journald_test.go\nCODE_LINE=NNN\nSYSLOG_IDENTIFIER=app\nERR=fail\nLOGGER=foo\nPODNAME=pod-1\n",
+		"MESSAGE=hello\nPRIORITY=6\nCODE_FILE=journald_test.go\nCODE_LINE=NNN\nSYSLOG_IDENTIFIER=app\n",
+	} {
+		n, err := server.Read(buffer)
+		require.NoError(t, err)
+		actual := re.ReplaceAllString(string(buffer[:n]), "CODE_LINE=NNN")
+		if actual != expected {
+			t.Errorf("unexpected fields:\n%q\nexpected:\n%q", actual, expected)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journald
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Constants from linux/memfd.h and linux/fcntl.h which are not in the
+// syscall package.
+const (
+	mfdCloexec       = 0x1
+	mfdAllowSealing  = 0x2
+	fAddSeals        = 1024 + 9
+	fSealSeal        = 0x1
+	fSealShrink      = 0x2
+	fSealGrow        = 0x4
+	fSealWrite       = 0x8
+	allSeals         = fSealSeal | fSealShrink | fSealGrow | fSealWrite
+	memfdNamePrefix  = "plog-journal"
+	sharedMemoryPath = "/dev/shm"
+)
+
+// isTooLarge checks whether sending a datagram failed because of its size.
+func isTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendLarge writes the data into a sealed memfd and passes its file
+// descriptor to journald. Without memfd support, an unlinked file in
+// /dev/shm is used instead, which journald only accepts from root.
+func sendLarge(conn *net.UnixConn, data []byte) error {
+	file, err := memfd()
+	if err != nil {
+		file, err = os.CreateTemp(sharedMemoryPath, memfdNamePrefix)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(file.Name()) // ignore err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	if sysMemfdCreate != 0 {
+		// Fails for the temporary file, which is okay.
+		_, _, _ = syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), fAddSeals, allSeals)
+	}
+	// WriteMsgUnix cannot be used with a connected socket.
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	var sendErr error
+	if err := raw.Write(func(fd uintptr) bool {
+		sendErr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return sendErr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// memfd creates an anonymous file which supports sealing.
+func memfd() (*os.File, error) {
+	if sysMemfdCreate == 0 {
+		return nil, errors.New("memfd_create not supported")
+	}
+	name, err := syscall.BytePtrFromString(memfdNamePrefix)
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(name)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, memfdNamePrefix), nil
+}
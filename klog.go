@@ -88,6 +88,18 @@
 //			"glob" pattern and N is a V level. For instance,
 //				-vmodule=gopher*=3
 //			sets the V level to 3 in all Go files whose names begin "gopher".
+//			A pattern containing a slash matches the import path of a
+//			package or a source directory, ignoring leading directories.
+//			When "/..." is appended, it also matches everything below it:
+//				-vmodule=k8s.io/kubernetes/pkg/scheduler/...=4
+//			A pattern with the "func:" prefix matches the name of the
+//			function which calls V, including its function literals.
+//			The function name is qualified with the last element of the
+//			package import path, or with the full import path if the
+//			pattern contains a slash. Methods are written without
+//			parentheses and pointer:
+//				-vmodule=func:scheduler.Scheduler.Run=5
+//			The first matching pattern determines the V level.
 package plog
 
 import (
@@ -100,7 +112,6 @@ import (
 	stdLog "log"
 	"math"
 	"os"
-	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -108,11 +119,16 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/pohly/plog/v2/binlog"
 	"github.com/pohly/plog/v2/internal/buffer"
 	"github.com/pohly/plog/v2/internal/clock"
+	"github.com/pohly/plog/v2/internal/color"
 	"github.com/pohly/plog/v2/internal/dbg"
+	"github.com/pohly/plog/v2/internal/rotation"
 	"github.com/pohly/plog/v2/internal/serialize"
 	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/internal/sourcepath"
+	"github.com/pohly/plog/v2/internal/verbosity"
 )
 
 // severityValue identifies the sort of log: info, warning etc. It also implements
@@ -180,6 +196,15 @@ func (s *OutputStats) Bytes() int64 {
 // per severity level. Values must be read with atomic.LoadInt64.
 var Stats struct {
 	Info, Warning, Error OutputStats
+
+	// Failed tracks log output that could not be written to a log file
+	// and was handled according to the write error policy instead.
+	Failed OutputStats
+
+	// Dropped tracks log output that was discarded because the queue
+	// for asynchronous output was full. It is also included in the
+	// per-severity stats.
+	Dropped OutputStats
 }
 
 var severityStats = [severity.NumSeverity]*OutputStats{
@@ -247,14 +272,10 @@ type modulePat struct {
 	level   Level
 }
 
-// match reports whether the file matches the pattern. It uses a string
+// match reports whether the location matches the pattern. It uses a string
 // comparison if the pattern contains no metacharacters.
-func (m *modulePat) match(file string) bool {
-	if m.literal {
-		return file == m.pattern
-	}
-	match, _ := filepath.Match(m.pattern, file)
-	return match
+func (m *modulePat) match(loc verbosity.Location) bool {
+	return verbosity.MatchPattern(m.pattern, m.literal, loc)
 }
 
 func (m *moduleSpec) String() string {
@@ -284,7 +305,7 @@ func (m *moduleSpec) Get() interface{} {
 var errVmoduleSyntax = errors.New("syntax error: expect comma-separated list of filename=N")
 
 // Set will sets module value
-// Syntax: -vmodule=recordio=2,file=1,gfs*=3
+// Syntax: -vmodule=recordio=2,file=1,gfs*=3,k8s.io/kubernetes/pkg/scheduler/...=4,func:scheduler.Scheduler.Run=5
 func (m *moduleSpec) Set(value string) error {
 	filter, err := parseModuleSpec(value)
 	if err != nil {
@@ -318,12 +339,45 @@ func parseModuleSpec(value string) ([]modulePat, error) {
 		if v == 0 {
 			continue // Ignore. It's harmless but no point in paying the overhead.
 		}
-		// TODO: check syntax of filter?
+		if err := verbosity.CheckPattern(pattern); err != nil {
+			return nil, err
+		}
 		filter = append(filter, modulePat{pattern, isLiteral(pattern), Level(v)})
 	}
 	return filter, nil
 }
 
+// loggerSpec represents the setting of the -vlogger flag.
+type loggerSpec struct {
+	filter verbosity.LoggerFilter
+}
+
+func (l *loggerSpec) String() string {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	return l.filter.String()
+}
+
+// Get is part of the (Go 1.2)  flag.Getter interface. It always returns nil for this flag type since the
+// struct is not exported.
+func (l *loggerSpec) Get() interface{} {
+	return nil
+}
+
+// Set will sets logger value
+// Syntax: -vlogger=controller=2,controller.leader-election=4,*.cache=3
+func (l *loggerSpec) Set(value string) error {
+	filter, err := verbosity.ParseLoggerFilter(value)
+	if err != nil {
+		return err
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	l.filter = filter
+	logging.setVLogger(filter)
+	return nil
+}
+
 // isLiteral reports whether the pattern is a literal string, that is, has no metacharacters
 // that require filepath.Match to be called to match the pattern.
 func isLiteral(pattern string) bool {
@@ -421,11 +475,41 @@ func init() {
 	commandLine.Uint64Var(&logging.logFileMaxSizeMB, "log_file_max_size", 1800,
 		"Defines the maximum size a log file can grow to (no effect when -logtostderr=true). Unit is megabytes. "+
 			"If the value is 0, the maximum file size is unlimited.")
+	logging.logNameTemplate = nameTemplate{template: defaultLogNameTemplate}
+	commandLine.Var(&logging.logNameTemplate, "klog_log_file_name_template", "Defines the names of log files in the log directory. Supported placeholders are {program}, {host}, {user}, {severity}, {timestamp}, {pid} and {seq}, {severity} and one of {timestamp} or {seq} are required (no effect when -logtostderr=true or -log_file is set).")
+	logging.linkNameTemplate = nameTemplate{template: defaultLinkNameTemplate, optional: true}
+	commandLine.Var(&logging.linkNameTemplate, "klog_log_file_link_template", "Defines the names of the symlinks to the current log files in the log directory, using the same placeholders as -klog_log_file_name_template. If empty, no symlinks are created (no effect when -logtostderr=true or -log_file is set).")
+	logging.colorMode = colorMode{mode: ColorNever}
+	commandLine.Var(&logging.colorMode, "klog_color", "Determines whether log entries which are only written to stderr get colored when using the text format: never, auto (if stderr is a terminal and NO_COLOR is empty) or always")
+	logging.loggingFormat = loggingFormat{format: LoggingFormatText}
+	commandLine.Var(&logging.loggingFormat, "logging_format", "Sets the format of log entries: text (the klog text format), json (one JSON object per line), logfmt (key=value pairs) or binary (compact encoding for log files, see the binlog package) (no effect when a logger was set with SetLogger)")
+	commandLine.IntVar(&logging.asyncQueueSize, "klog_async_queue_size", 0, "If positive, log output is written to stderr and log files by a background goroutine, with up to this many log entries waiting in a queue. Flush and Fatal write all pending entries (no effect when a logger was set with SetLogger).")
+	logging.asyncOverflow = overflowPolicy{policy: OverflowBlock}
+	commandLine.Var(&logging.asyncOverflow, "klog_async_overflow", "Determines what happens when the queue for asynchronous output is full: block (wait for space), drop_newest or drop_oldest (no effect when -klog_async_queue_size=0)")
+	logging.writeErrorPolicy = writeErrorPolicy{policy: WriteErrorExit}
+	commandLine.Var(&logging.writeErrorPolicy, "klog_write_error_policy", "Determines what happens when a log file cannot be created or written: exit, stderr (write to standard error instead) or drop (no effect when -logtostderr=true)")
+	commandLine.DurationVar(&logging.fileRetryInterval, "klog_file_retry_interval", 10*time.Second, "Defines how long to wait before trying again to create or write a log file after an error (no effect when -klog_write_error_policy=exit)")
+	commandLine.BoolVar(&logging.detectTruncation, "klog_detect_truncation", false, "If true, detect when a log file gets truncated by an external tool like logrotate with copytruncate and continue writing at the new end of the file (no effect when -logtostderr=true)")
+	commandLine.IntVar(&logging.logFileMaxBackups, "klog_log_file_max_backups", 0, "Defines how many numbered backups (<log_file>.1, <log_file>.2, ...) are kept when the log file set with -log_file gets rotated (no effect when -logtostderr=true). If the value is 0, the log file is truncated instead.")
+	commandLine.IntVar(&logging.retention.MaxFiles, "klog_retention_max_files", 0, "Defines how many log files per severity are kept in the log directory, including the current one (no effect when -logtostderr=true or -log_file is set). If the value is 0, the number of files is unlimited.")
+	commandLine.Uint64Var(&logging.retention.MaxTotalSizeMB, "klog_retention_max_size", 0, "Defines the maximum total size of all log files per severity in the log directory (no effect when -logtostderr=true or -log_file is set). Unit is megabytes. If the value is 0, the total size is unlimited.")
+	commandLine.DurationVar(&logging.retention.MaxAge, "klog_retention_max_age", 0, "Defines how long old log files are kept in the log directory (no effect when -logtostderr=true or -log_file is set). If the value is 0, the age is unlimited.")
+	commandLine.Var(&logging.compression, "klog_compression", "If non-empty, rotated log files are compressed in the background. The only supported format is gzip (no effect when -logtostderr=true or -log_file is set).")
+	commandLine.Var(&logging.rotationInterval, "klog_rotation_interval", "If non-empty, log files are also rotated when the wall clock crosses an interval boundary: hourly, daily, or a duration like 30m. Boundaries are aligned to local midnight (no effect when -logtostderr=true, or when -log_file is set and -klog_log_file_max_backups=0).")
 	commandLine.BoolVar(&logging.toStderr, "logtostderr", true, "log to standard error instead of files")
 	commandLine.BoolVar(&logging.alsoToStderr, "alsologtostderr", false, "log to standard error as well as files (no effect when -logtostderr=true)")
 	logging.setVState(0, nil, false)
 	commandLine.Var(&logging.verbosity, "v", "number for the log level verbosity")
 	commandLine.BoolVar(&logging.addDirHeader, "add_dir_header", false, "If true, adds the file directory to the header of the log messages")
+	commandLine.BoolVar(&logging.headerRFC3339, "klog_header_rfc3339", false, "If true, the header contains the time stamp in RFC 3339 format, with year and time zone")
+	commandLine.BoolVar(&logging.headerUTC, "klog_header_utc", false, "If true, the time stamp in the header is in UTC instead of local time")
+	logging.headerPrecision = timePrecision{precision: PrecisionMicroseconds}
+	commandLine.Var(&logging.headerPrecision, "klog_header_precision", "Determines the fractions of a second in the header: ms, us or ns")
+	logging.headerPath = headerPath{path: HeaderPathBase}
+	commandLine.Var(&logging.headerPath, "klog_header_path", "Determines how the source file is shown in the header: base (file name), dir (file name and directory, the same as -add_dir_header) or module (path relative to the root of the Go module)")
+	logging.headerThreadID = threadIDMode{mode: ThreadIDPid}
+	commandLine.Var(&logging.headerThreadID, "klog_header_thread_id", "Determines the content of the thread ID column in the header: pid (process ID), tid (operating system thread ID, only on Linux) or goroutine (goroutine ID)")
+	commandLine.IntVar(&logging.headerThreadIDWidth, "klog_header_thread_id_width", 7, "Minimum width of the thread ID column in the header, longer IDs are not truncated")
 	commandLine.BoolVar(&logging.skipHeaders, "skip_headers", false, "If true, avoid header prefixes in the log messages")
 	commandLine.BoolVar(&logging.oneOutput, "one_output", false, "If true, only write logs to their native severity level (vs also writing to each lower severity level; no effect when -logtostderr=true)")
 	commandLine.BoolVar(&logging.skipLogHeaders, "skip_log_headers", false, "If true, avoid headers when opening log files (no effect when -logtostderr=true)")
@@ -433,7 +517,8 @@ func init() {
 		Severity: severity.ErrorLog, // Default stderrThreshold is ERROR.
 	}
 	commandLine.Var(&logging.stderrThreshold, "stderrthreshold", "logs at or above this threshold go to stderr when writing to files and stderr (no effect when -logtostderr=true or -alsologtostderr=true)")
-	commandLine.Var(&logging.vmodule, "vmodule", "comma-separated list of pattern=N settings for file-filtered logging")
+	commandLine.Var(&logging.vmodule, "vmodule", "comma-separated list of pattern=N settings for file-filtered logging (patterns match file names, package paths or directories with an optional /... suffix, or func:<function name>)")
+	commandLine.Var(&logging.vlogger, "vlogger", "comma-separated list of name=N settings for logger-filtered logging: a name matches loggers created with WithName, with nested names separated by dots, and the loggers derived from them; elements may use glob patterns")
 	commandLine.Var(&logging.traceLocation, "log_backtrace_at", "when logging hits line file:N, emit a stack trace")
 
 	logging.settings.contextualLoggingEnabled = true
@@ -455,9 +540,13 @@ func InitFlags(flagset *flag.FlagSet) {
 	})
 }
 
-// Flush flushes all pending log I/O.
+// Flush flushes all pending log I/O, including log entries which are
+// queued for asynchronous output. It also waits for the background
+// compression of rotated log files.
 func Flush() {
+	asyncOutput.drain()
 	logging.lockAndFlushAll()
+	fileCompressor.wait()
 }
 
 // settings collects global settings.
@@ -485,7 +574,8 @@ type settings struct {
 
 	// Access to all of the following fields must be protected via a mutex.
 
-	// file holds writer for each of the log types.
+	// file holds writer for each of the log types. Protected by
+	// loggingT.fileMu.
 	file [severity.NumSeverity]flushSyncWriter
 	// flushInterval is the interval for periodic flushing. If zero,
 	// the global default will be used.
@@ -501,11 +591,16 @@ type settings struct {
 	// safely using atomic.LoadInt32.
 	vmodule   moduleSpec // The state of the -vmodule flag.
 	verbosity Level      // V logging level, the value of the -v flag/
+	vlogger   loggerSpec // The state of the -vlogger flag.
 
 	// If non-empty, overrides the choice of directory in which to write logs.
 	// See createLogDirs for the full list of possible destinations.
 	logDir string
 
+	// Templates for the names of log files and their symlinks in logDir.
+	logNameTemplate  nameTemplate
+	linkNameTemplate nameTemplate
+
 	// If non-empty, specifies the path of the file to write logs. mutually exclusive
 	// with the log_dir option.
 	logFile string
@@ -514,15 +609,74 @@ type settings struct {
 	// logFile will be cleaned up. If this value is 0, no size limitation will be applied to logFile.
 	logFileMaxSizeMB uint64
 
+	// When logFile is rotated, it gets renamed to <logFile>.1 after
+	// shifting older backups, keeping at most this many of them. If this
+	// value is 0, logFile gets truncated instead.
+	logFileMaxBackups int
+
+	// If non-zero, log files are additionally rotated whenever the wall clock
+	// crosses a multiple of this interval, counted from local midnight.
+	rotationInterval rotationInterval
+
+	// retention determines which old log files are removed from the
+	// log directory when creating a new one.
+	retention RetentionPolicy
+
+	// compression is the format used for compressing rotated log files.
+	// Empty if disabled.
+	compression compression
+
 	// If true, do not add the prefix headers, useful when used with SetOutput
 	skipHeaders bool
 
 	// If true, do not add the headers to log files
 	skipLogHeaders bool
 
+	// If true, check during each flush whether log files were truncated
+	// by some external tool.
+	detectTruncation bool
+
+	// writeErrorPolicy determines what happens to log output that cannot
+	// be written to a log file.
+	writeErrorPolicy writeErrorPolicy
+
+	// fileRetryInterval is the time between attempts to create or write
+	// a log file again after an error.
+	fileRetryInterval time.Duration
+
+	// writeErrorHandler, if set, gets called for errors while creating
+	// or writing log files.
+	writeErrorHandler func(err error)
+
+	// loggingFormat determines how log entries get formatted.
+	loggingFormat loggingFormat
+
+	// colorMode determines whether log entries get colored.
+	colorMode colorMode
+
+	// asyncQueueSize is the maximum number of log entries waiting for
+	// asynchronous output. Zero disables asynchronous output.
+	asyncQueueSize int
+
+	// asyncOverflow determines what happens when the queue for
+	// asynchronous output is full.
+	asyncOverflow overflowPolicy
+
 	// If true, add the file directory to the header
 	addDirHeader bool
 
+	// headerRFC3339, headerUTC, headerPrecision and headerPath modify
+	// the header of the text format.
+	headerRFC3339   bool
+	headerUTC       bool
+	headerPrecision timePrecision
+	headerPath      headerPath
+
+	// headerThreadID and headerThreadIDWidth determine the thread ID
+	// column of the header.
+	headerThreadID      threadIDMode
+	headerThreadIDWidth int
+
 	// If true, messages will not be propagated to lower severity log levels
 	oneOutput bool
 
@@ -537,6 +691,7 @@ func (s settings) deepCopy() settings {
 	filter := make([]modulePat, len(s.vmodule.filter))
 	copy(filter, s.vmodule.filter)
 	s.vmodule.filter = filter
+	s.vlogger.filter = append(verbosity.LoggerFilter(nil), s.vlogger.filter...)
 
 	if s.logger != nil {
 		logger := *s.logger
@@ -558,18 +713,63 @@ type loggingT struct {
 	// in settingsT which need a mutex lock.
 	mu sync.Mutex
 
+	// fileMu protects file, createRetryAt and the state of the log files.
+	// When both are needed, mu gets locked first. Asynchronous output only
+	// locks fileMu, so logging calls don't wait for file I/O. Settings which
+	// are used while writing log files get modified while holding both,
+	// see lockWithFiles.
+	fileMu sync.Mutex
+
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
 	// vmap is a cache of the V Level for each V() call site, identified by PC.
 	// It is wiped whenever the vmodule flag changes state.
 	vmap map[uintptr]Level
+	// boosts are the active verbosity boosts started by BoostVerbosity.
+	boosts verbosity.Boosts
+	// effectiveVerbosity is the maximum of the -v flag and the boosts. It
+	// may be read safely using atomic.LoadInt32, but is only modified
+	// under mu.
+	effectiveVerbosity Level
+
+	// vloggerMu protects vloggerFilter and vloggerGeneration. It is
+	// separate from mu so that computing the level for a logger name
+	// does not have to wait for log output.
+	vloggerMu sync.Mutex
+
+	// vloggerFilter is a copy of the -vlogger filter which can be read
+	// without holding mu.
+	vloggerFilter verbosity.LoggerFilter
+
+	// vloggerGeneration gets incremented whenever the vlogger flag changes
+	// state. It is used to invalidate the level cached for logger names.
+	// It may be read safely using atomic.LoadUint32, but is only modified
+	// under vloggerMu.
+	vloggerGeneration uint32
+
+	// createRetryAt is the time at which creating log files is attempted
+	// again after an error. Protected by fileMu.
+	createRetryAt time.Time
+}
+
+// lockWithFiles locks mu and fileMu, for modifying settings which are also
+// needed while writing log files.
+func (l *loggingT) lockWithFiles() {
+	l.mu.Lock()
+	l.fileMu.Lock()
+}
+
+// unlockWithFiles reverts lockWithFiles.
+func (l *loggingT) unlockWithFiles() {
+	l.fileMu.Unlock()
+	l.mu.Unlock()
 }
 
 // setVState sets a consistent state for V logging.
 // l.mu is held.
 func (l *loggingT) setVState(verbosity Level, filter []modulePat, setFilter bool) {
 	// Turn verbosity off so V will not fire while we are in transition.
-	l.verbosity.set(0)
+	l.effectiveVerbosity.set(0)
 	// Ditto for filter length.
 	atomic.StoreInt32(&l.filterLength, 0)
 
@@ -578,11 +778,16 @@ func (l *loggingT) setVState(verbosity Level, filter []modulePat, setFilter bool
 		l.vmodule.filter = filter
 		l.vmap = make(map[uintptr]Level)
 	}
+	l.verbosity.set(verbosity)
+	effective := verbosity
+	if boost := Level(l.boosts.Level()); boost > effective {
+		effective = boost
+	}
 
 	// Things are consistent now, so enable filtering and verbosity.
 	// They are enabled in order opposite to that in V.
-	atomic.StoreInt32(&l.filterLength, int32(len(filter)))
-	l.verbosity.set(verbosity)
+	atomic.StoreInt32(&l.filterLength, int32(len(filter)+l.boosts.NumPatterns()))
+	l.effectiveVerbosity.set(effective)
 }
 
 var timeNow = time.Now // Stubbed out for testing.
@@ -590,8 +795,8 @@ var timeNow = time.Now // Stubbed out for testing.
 // CaptureState gathers information about all current klog settings.
 // The result can be used to restore those settings.
 func CaptureState() State {
-	logging.mu.Lock()
-	defer logging.mu.Unlock()
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
 	return &state{
 		settings:      logging.settings.deepCopy(),
 		flushDRunning: logging.flushD.isRunning(),
@@ -628,11 +833,13 @@ func (s *state) Restore() {
 		logging.flushD.stop()
 	}
 
-	logging.mu.Lock()
-	defer logging.mu.Unlock()
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
 
 	logging.settings = s.settings
+	logging.boosts.Stop()
 	logging.setVState(s.verbosity, s.vmodule.filter, true)
+	logging.setVLogger(s.vlogger.filter)
 	MaxSize = s.maxSize
 }
 
@@ -657,20 +864,19 @@ where the fields are defined as follows:
 	msg              The user-supplied message
 */
 func (l *loggingT) header(s severity.Severity, depth int) (*buffer.Buffer, string, int) {
-	_, file, line, ok := runtime.Caller(3 + depth)
+	pc, file, line, ok := runtime.Caller(3 + depth)
 	if !ok {
 		file = "???"
 		line = 1
 	} else {
-		if slash := strings.LastIndex(file, "/"); slash >= 0 {
-			path := file
-			file = path[slash+1:]
-			if l.addDirHeader {
-				if dirsep := strings.LastIndex(path[:slash], "/"); dirsep >= 0 {
-					file = path[dirsep+1:]
-				}
+		mode := l.sourcePathMode()
+		var function string
+		if mode == sourcepath.Module {
+			if fn := runtime.FuncForPC(pc); fn != nil {
+				function = fn.Name()
 			}
 		}
+		file = sourcepath.Shorten(function, file, mode)
 	}
 	return l.formatHeader(s, file, line, timeNow()), file, line
 }
@@ -678,10 +884,13 @@ func (l *loggingT) header(s severity.Severity, depth int) (*buffer.Buffer, strin
 // formatHeader formats a log header using the provided file name and line number.
 func (l *loggingT) formatHeader(s severity.Severity, file string, line int, now time.Time) *buffer.Buffer {
 	buf := buffer.GetBuffer()
-	if l.skipHeaders {
+	if l.skipHeaders || l.loggingFormat.format != LoggingFormatText {
 		return buf
 	}
-	buf.FormatHeader(s, file, line, now)
+	buf.FormatHeaderWithOptions(s, file, line, now, l.headerOptions())
+	if l.colors() {
+		color.Severity(&buf.Buffer, 0, s)
+	}
 	return buf
 }
 
@@ -706,6 +915,7 @@ func (l *loggingT) printlnDepth(s severity.Severity, logger *logWriter, filter L
 		args = filter.Filter(args)
 	}
 	fmt.Fprintln(buf, args...)
+	buf = l.textToFormat(s, logger, file, line, buf)
 	l.output(s, logger, buf, depth, file, line, false)
 }
 
@@ -737,6 +947,7 @@ func (l *loggingT) printWithInfos(buf *buffer.Buffer, file string, line int, s s
 	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
 		buf.WriteByte('\n')
 	}
+	buf = l.textToFormat(s, logger, file, line, buf)
 	l.output(s, logger, buf, depth, file, line, false)
 }
 
@@ -764,6 +975,7 @@ func (l *loggingT) printfDepth(s severity.Severity, logger *logWriter, filter Lo
 	if buf.Bytes()[buf.Len()-1] != '\n' {
 		buf.WriteByte('\n')
 	}
+	buf = l.textToFormat(s, logger, file, line, buf)
 	l.output(s, logger, buf, depth, file, line, false)
 }
 
@@ -786,6 +998,7 @@ func (l *loggingT) printWithFileLine(s severity.Severity, logger *logWriter, fil
 	if buf.Bytes()[buf.Len()-1] != '\n' {
 		buf.WriteByte('\n')
 	}
+	buf = l.textToFormat(s, logger, file, line, buf)
 	l.output(s, logger, buf, 2 /* depth */, file, line, alsoToStderr)
 }
 
@@ -798,11 +1011,11 @@ func (l *loggingT) errorS(err error, logger *logWriter, filter LogFilter, depth
 		logger.WithCallDepth(depth+2).Error(err, msg, keysAndValues...)
 		return
 	}
-	l.printS(err, severity.ErrorLog, depth+1, msg, keysAndValues...)
+	l.printS(err, severity.ErrorLog, 0, depth+1, msg, keysAndValues...)
 }
 
 // if logger is specified, will call logger.Info, otherwise output with logging module.
-func (l *loggingT) infoS(logger *logWriter, filter LogFilter, depth int, msg string, keysAndValues ...interface{}) {
+func (l *loggingT) infoS(logger *logWriter, filter LogFilter, level Level, depth int, msg string, keysAndValues ...interface{}) {
 	if filter != nil {
 		msg, keysAndValues = filter.FilterS(msg, keysAndValues)
 	}
@@ -810,22 +1023,27 @@ func (l *loggingT) infoS(logger *logWriter, filter LogFilter, depth int, msg str
 		logger.WithCallDepth(depth+2).Info(msg, keysAndValues...)
 		return
 	}
-	l.printS(nil, severity.InfoLog, depth+1, msg, keysAndValues...)
+	l.printS(nil, severity.InfoLog, level, depth+1, msg, keysAndValues...)
 }
 
 // printS is called from infoS and errorS if logger is not specified.
 // set log severity by s
-func (l *loggingT) printS(err error, s severity.Severity, depth int, msg string, keysAndValues ...interface{}) {
+func (l *loggingT) printS(err error, s severity.Severity, level Level, depth int, msg string, keysAndValues ...interface{}) {
+	if l.loggingFormat.format != LoggingFormatText {
+		l.printFormatted(err, s, level, depth+1, msg, keysAndValues...)
+		return
+	}
 	// Only create a new buffer if we don't have one cached.
 	b := buffer.GetBuffer()
 	// The message is always quoted, even if it contains line breaks.
 	// If developers want multi-line output, they should use a small, fixed
 	// message and put the multi-line output into a value.
 	b.WriteString(strconv.Quote(msg))
+	formatter := serialize.Formatter{Colors: l.colors()}
 	if err != nil {
-		serialize.KVListFormat(&b.Buffer, "err", err)
+		formatter.KVListFormat(&b.Buffer, "err", err)
 	}
-	serialize.KVListFormat(&b.Buffer, keysAndValues...)
+	formatter.KVListFormat(&b.Buffer, keysAndValues...)
 	l.printDepth(s, nil, nil, depth+1, &b.Buffer)
 	// Make the buffer available for reuse.
 	buffer.PutBuffer(b)
@@ -837,10 +1055,16 @@ type redirectBuffer struct {
 }
 
 func (rb *redirectBuffer) Sync() error {
+	if s, ok := rb.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
 	return nil
 }
 
 func (rb *redirectBuffer) Flush() error {
+	if f, ok := rb.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
 	return nil
 }
 
@@ -848,22 +1072,27 @@ func (rb *redirectBuffer) Write(bytes []byte) (n int, err error) {
 	return rb.w.Write(bytes)
 }
 
-// SetOutput sets the output destination for all severities
+// SetOutput sets the output destination for all severities.
+//
+// Flush and the periodic flushing also call the Flush and Sync methods of
+// the writer, if it has them. This makes it possible to write to a rotating
+// log file created with the logfile package.
 func SetOutput(w io.Writer) {
-	logging.mu.Lock()
-	defer logging.mu.Unlock()
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	// The same instance for all severities gets flushed only once.
+	rb := &redirectBuffer{
+		w: w,
+	}
 	for s := severity.FatalLog; s >= severity.InfoLog; s-- {
-		rb := &redirectBuffer{
-			w: w,
-		}
 		logging.file[s] = rb
 	}
 }
 
 // SetOutputBySeverity sets the output destination for specific severity
 func SetOutputBySeverity(name string, w io.Writer) {
-	logging.mu.Lock()
-	defer logging.mu.Unlock()
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
 	sev, ok := severity.ByName(name)
 	if !ok {
 		panic(fmt.Sprintf("SetOutputBySeverity(%q): unrecognized severity name", name))
@@ -884,6 +1113,10 @@ func LogToStderr(stderr bool) {
 
 // output writes the data to the log files and releases the buffer.
 func (l *loggingT) output(s severity.Severity, logger *logWriter, buf *buffer.Buffer, depth int, file string, line int, alsoToStderr bool) {
+	if s == severity.FatalLog {
+		// Pending asynchronous output must be written first.
+		asyncOutput.drain()
+	}
 	var isLocked = true
 	l.mu.Lock()
 	defer func() {
@@ -895,10 +1128,30 @@ func (l *loggingT) output(s severity.Severity, logger *logWriter, buf *buffer.Bu
 
 	if l.traceLocation.isSet() {
 		if l.traceLocation.match(file, line) {
-			buf.Write(dbg.Stacks(false))
+			l.writeStacks(buf, logger, dbg.Stacks(false))
 		}
 	}
 	data := buf.Bytes()
+	format := l.loggingFormat.format
+	if logger == nil && l.asyncQueueSize > 0 && s != severity.FatalLog {
+		entry := asyncEntry{
+			s:            s,
+			buf:          buf,
+			format:       format,
+			toStderr:     l.toStderr,
+			alsoToStderr: alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get(),
+		}
+		size, policy := l.asyncQueueSize, l.asyncOverflow.policy
+		l.mu.Unlock()
+		isLocked = false
+		if stats := severityStats[s]; stats != nil {
+			atomic.AddInt64(&stats.lines, 1)
+			atomic.AddInt64(&stats.bytes, int64(len(data)))
+		}
+		// The buffer gets released after writing it.
+		asyncOutput.put(entry, size, policy)
+		return
+	}
 	if logger != nil {
 		if logger.writeKlogBuffer != nil {
 			logger.writeKlogBuffer(data)
@@ -915,48 +1168,17 @@ func (l *loggingT) output(s severity.Severity, logger *logWriter, buf *buffer.Bu
 			}
 		}
 	} else if l.toStderr {
-		os.Stderr.Write(data)
+		writeStderr(format, data)
 	} else {
-		if alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get() {
-			os.Stderr.Write(data)
+		wroteToStderr := alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get()
+		if wroteToStderr {
+			writeStderr(format, data)
 		}
-
-		if logging.logFile != "" {
-			// Since we are using a single log file, all of the items in l.file array
-			// will point to the same file, so just use one of them to write data.
-			if l.file[severity.InfoLog] == nil {
-				if err := l.createFiles(severity.InfoLog); err != nil {
-					os.Stderr.Write(data) // Make sure the message appears somewhere.
-					l.exit(err)
-				}
-			}
-			_, _ = l.file[severity.InfoLog].Write(data)
-		} else {
-			if l.file[s] == nil {
-				if err := l.createFiles(s); err != nil {
-					os.Stderr.Write(data) // Make sure the message appears somewhere.
-					l.exit(err)
-				}
-			}
-
-			if l.oneOutput {
-				_, _ = l.file[s].Write(data)
-			} else {
-				switch s {
-				case severity.FatalLog:
-					_, _ = l.file[severity.FatalLog].Write(data)
-					fallthrough
-				case severity.ErrorLog:
-					_, _ = l.file[severity.ErrorLog].Write(data)
-					fallthrough
-				case severity.WarningLog:
-					_, _ = l.file[severity.WarningLog].Write(data)
-					fallthrough
-				case severity.InfoLog:
-					_, _ = l.file[severity.InfoLog].Write(data)
-				}
-			}
+		l.fileMu.Lock()
+		if err := l.writeFiles(s, data); err != nil {
+			l.writeFailed(err, format, data, wroteToStderr)
 		}
+		l.fileMu.Unlock()
 	}
 	if s == severity.FatalLog {
 		// If we got here via Exit rather than Fatal, print no stacks.
@@ -971,17 +1193,23 @@ func (l *loggingT) output(s severity.Severity, logger *logWriter, buf *buffer.Bu
 		// If -logtostderr has been specified, the loop below will do that anyway
 		// as the first stack in the full dump.
 		if !l.toStderr {
-			os.Stderr.Write(dbg.Stacks(false))
+			stacksFormat := format
+			if logger != nil {
+				stacksFormat = LoggingFormatText
+			}
+			writeStderr(stacksFormat, l.fatalStacks(logger, file, line, false))
 		}
 
 		// Write the stack trace for all goroutines to the files.
-		trace := dbg.Stacks(true)
+		trace := l.fatalStacks(logger, file, line, true)
 		logExitFunc = func(error) {} // If we get a write error, we'll still exit below.
+		l.fileMu.Lock()
 		for log := severity.FatalLog; log >= severity.InfoLog; log-- {
 			if f := l.file[log]; f != nil { // Can be nil if -logtostderr is set.
 				_, _ = f.Write(trace)
 			}
 		}
+		l.fileMu.Unlock()
 		l.mu.Unlock()
 		isLocked = false
 		timeoutFlush(ExitFlushTimeout)
@@ -995,6 +1223,155 @@ func (l *loggingT) output(s severity.Severity, logger *logWriter, buf *buffer.Bu
 	}
 }
 
+// writeFiles writes the data to the log files for the severity, creating
+// them if necessary. It returns the first error, if any.
+// l.fileMu is held.
+func (l *loggingT) writeFiles(s severity.Severity, data []byte) error {
+	if logging.logFile != "" {
+		// Since we are using a single log file, all of the items in l.file array
+		// will point to the same file, so just use one of them to write data.
+		if err := l.ensureFiles(severity.InfoLog); err != nil {
+			return err
+		}
+		_, err := l.file[severity.InfoLog].Write(data)
+		return err
+	}
+
+	if err := l.ensureFiles(s); err != nil {
+		return err
+	}
+	if l.oneOutput {
+		_, err := l.file[s].Write(data)
+		return err
+	}
+	var firstErr error
+	for log := s; log >= severity.InfoLog; log-- {
+		if _, err := l.file[log].Write(data); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ensureFiles creates the log files for the severity and all lower ones if
+// they don't exist yet. After a failure, the next attempt is made only after
+// -klog_file_retry_interval.
+// l.fileMu is held.
+func (l *loggingT) ensureFiles(sev severity.Severity) error {
+	if l.file[sev] != nil {
+		return nil
+	}
+	now := timeNow()
+	if now.Before(l.createRetryAt) {
+		return errFileFailed
+	}
+	if err := l.createFiles(sev); err != nil {
+		l.createRetryAt = now.Add(l.fileRetryInterval)
+		return err
+	}
+	return nil
+}
+
+// errFileFailed is returned for log files which are unavailable because of
+// an earlier error and wait for the next attempt to create them again.
+var errFileFailed = errors.New("log file unavailable because of an earlier error")
+
+// WriteErrorPolicy determines what happens to log output that cannot be
+// written to a log file because creating or writing the file failed.
+type WriteErrorPolicy string
+
+const (
+	// WriteErrorExit writes the log output to stderr, flushes all
+	// logs and exits the program with exit code 2. This is the
+	// default.
+	WriteErrorExit WriteErrorPolicy = "exit"
+	// WriteErrorStderr writes the log output to stderr instead.
+	WriteErrorStderr WriteErrorPolicy = "stderr"
+	// WriteErrorDrop discards the log output.
+	WriteErrorDrop WriteErrorPolicy = "drop"
+)
+
+// writeErrorPolicy represents the setting of the -klog_write_error_policy flag.
+type writeErrorPolicy struct {
+	policy WriteErrorPolicy
+}
+
+func (w *writeErrorPolicy) String() string {
+	return string(w.policy)
+}
+
+// Get is part of the flag.Getter interface. It returns a WriteErrorPolicy.
+func (w *writeErrorPolicy) Get() interface{} {
+	return w.policy
+}
+
+// Set is part of the flag.Value interface.
+func (w *writeErrorPolicy) Set(value string) error {
+	switch policy := WriteErrorPolicy(value); policy {
+	case WriteErrorExit, WriteErrorStderr, WriteErrorDrop:
+		w.policy = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown write error policy %q, must be one of %s, %s, %s", value, WriteErrorExit, WriteErrorStderr, WriteErrorDrop)
+	}
+}
+
+// SetWriteErrorPolicy determines what happens when a log file cannot be
+// created or written. This is the programmatic equivalent of the
+// -klog_write_error_policy flag.
+//
+// With a policy other than WriteErrorExit, klog tries again to create the log
+// file after the interval set with -klog_file_retry_interval. The log output that could not be written gets counted
+// in Stats.Failed.
+func SetWriteErrorPolicy(policy WriteErrorPolicy) {
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	if err := logging.writeErrorPolicy.Set(string(policy)); err != nil {
+		panic(fmt.Sprintf("SetWriteErrorPolicy(%q): %v", policy, err))
+	}
+}
+
+// SetWriteErrorHandler installs a callback which gets invoked for each error
+// that occurs while creating or writing a log file, before applying the
+// write error policy. It is not called again for log output that gets
+// handled according to the policy while waiting for the next attempt to
+// create the file. Nil removes the callback.
+//
+// The callback is invoked while klog holds internal locks and therefore must
+// not log through klog.
+func SetWriteErrorHandler(handler func(err error)) {
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	logging.writeErrorHandler = handler
+}
+
+// writeFailed handles an error while creating or writing a log file
+// according to the write error policy. data is the log output in the given
+// format that could not be written. wroteToStderr is true if the data is already on stderr.
+// l.fileMu is held.
+func (l *loggingT) writeFailed(err error, format LoggingFormat, data []byte, wroteToStderr bool) {
+	atomic.AddInt64(&Stats.Failed.lines, 1)
+	atomic.AddInt64(&Stats.Failed.bytes, int64(len(data)))
+	if err != errFileFailed && l.writeErrorHandler != nil {
+		l.writeErrorHandler(err)
+	}
+	if err != errFileFailed && l.writeErrorHandler == nil && l.writeErrorPolicy.policy != WriteErrorExit {
+		fmt.Fprintf(os.Stderr, "plog: writing log file failed, trying again in %s: %s\n", l.fileRetryInterval, err)
+	}
+	switch l.writeErrorPolicy.policy {
+	case WriteErrorStderr:
+		if !wroteToStderr {
+			writeStderr(format, data)
+		}
+	case WriteErrorDrop:
+	default:
+		if !wroteToStderr {
+			writeStderr(format, data) // Make sure the message appears somewhere.
+		}
+		l.exit(err)
+	}
+}
+
 // logExitFunc provides a simple mechanism to override the default behavior
 // of exiting on error. Used in testing and to guarantee we reach a required exit
 // for fatal logs. Instead, exit could be a function rather than a method but that
@@ -1003,9 +1380,9 @@ var logExitFunc func(error)
 
 // exit is called if there is trouble creating or writing log files.
 // It flushes the logs and exits the program; there's no point in hanging around.
-// l.mu is held.
+// l.fileMu is held.
 func (l *loggingT) exit(err error) {
-	fmt.Fprintf(os.Stderr, "log: exiting because of error: %s\n", err)
+	fmt.Fprintf(os.Stderr, "plog: exiting because of error: %s\n", err)
 	// If logExitFunc is set, we do that instead of exiting.
 	if logExitFunc != nil {
 		logExitFunc(err)
@@ -1018,7 +1395,7 @@ func (l *loggingT) exit(err error) {
 // syncBuffer joins a bufio.Writer to its underlying file, providing access to the
 // file's Sync method and providing a wrapper for the Write method that provides log
 // file rotation. There are conflicting methods, so the file cannot be embedded.
-// l.mu is held for all its methods.
+// l.fileMu is held for all its methods.
 type syncBuffer struct {
 	logger *loggingT
 	*bufio.Writer
@@ -1026,6 +1403,14 @@ type syncBuffer struct {
 	sev      severity.Severity
 	nbytes   uint64 // The number of bytes written to this file
 	maxbytes uint64 // The max number of bytes this syncBuffer.file can hold before cleaning up.
+
+	// nextRotation is the time at which the file gets rotated regardless
+	// of its size. Zero if time-based rotation is disabled.
+	nextRotation time.Time
+
+	// retryAt is the time at which the file gets created again after
+	// an error. Zero if there was no error.
+	retryAt time.Time
 }
 
 func (sb *syncBuffer) Sync() error {
@@ -1046,33 +1431,61 @@ func CalculateMaxSize() uint64 {
 	return MaxSize
 }
 
+// Write writes to the file after rotating it, if necessary. After an error,
+// it returns errFileFailed until -klog_file_retry_interval has passed and then tries
+// again with a new file.
 func (sb *syncBuffer) Write(p []byte) (n int, err error) {
-	if sb.nbytes+uint64(len(p)) >= sb.maxbytes {
-		if err := sb.rotateFile(time.Now(), false); err != nil {
-			sb.logger.exit(err)
+	now := timeNow()
+	if !sb.retryAt.IsZero() {
+		if now.Before(sb.retryAt) {
+			return 0, errFileFailed
+		}
+		if err := sb.rotateFile(now, true); err != nil {
+			sb.retryAt = now.Add(sb.logger.fileRetryInterval)
+			return 0, err
+		}
+		sb.retryAt = time.Time{}
+	} else if sb.nbytes+uint64(len(p)) >= sb.maxbytes || sb.rotationDue(now) {
+		if err := sb.rotateFile(now, false); err != nil {
+			sb.retryAt = now.Add(sb.logger.fileRetryInterval)
+			return 0, err
 		}
 	}
 	n, err = sb.Writer.Write(p)
 	sb.nbytes += uint64(n)
 	if err != nil {
-		sb.logger.exit(err)
+		sb.retryAt = now.Add(sb.logger.fileRetryInterval)
 	}
 	return
 }
 
+// rotationDue reports whether the file has reached its time-based rotation
+// boundary.
+func (sb *syncBuffer) rotationDue(now time.Time) bool {
+	return !sb.nextRotation.IsZero() && !now.Before(sb.nextRotation)
+}
+
 // rotateFile closes the syncBuffer's file and starts a new one.
 // The startup argument indicates whether this is the initial startup of plog.
 // If startup is true, existing files are opened for appending instead of truncated.
 func (sb *syncBuffer) rotateFile(now time.Time, startup bool) error {
+	var oldName string
 	if sb.file != nil {
 		sb.Flush()
 		sb.file.Close()
+		oldName = sb.file.Name()
 	}
-	var err error
-	sb.file, _, err = create(severity.Name[sb.sev], now, startup)
+	file, _, err := create(severity.Name[sb.sev], now, startup)
 	if err != nil {
 		return err
 	}
+	sb.file = file
+	// Rotating twice within the same second reuses the old name,
+	// in which case the old content is already gone.
+	if oldName != "" && oldName != sb.file.Name() && sb.logger.compression != "" {
+		// Runs in the background, without holding l.mu.
+		fileCompressor.compress(string(sb.logger.compression), oldName)
+	}
 	if startup {
 		fileInfo, err := sb.file.Stat()
 		if err != nil {
@@ -1084,18 +1497,27 @@ func (sb *syncBuffer) rotateFile(now time.Time, startup bool) error {
 		sb.nbytes = 0
 	}
 	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
+	sb.nextRotation = rotation.Next(now, sb.logger.timeRotationInterval())
 
 	if sb.logger.skipLogHeaders {
 		return nil
 	}
+	return sb.writeHeader(now)
+}
 
-	// Write header.
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
-	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
-	fmt.Fprintf(&buf, "Binary: Built with %s %s for %s/%s\n", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
-	n, err := sb.file.Write(buf.Bytes())
+// writeHeader writes the header that gets added at the start of a log file.
+func (sb *syncBuffer) writeHeader(now time.Time) error {
+	header := rotation.Header(now, host)
+	if sb.logger.loggingFormat.format == LoggingFormatBinary {
+		var b bytes.Buffer
+		binlog.AppendFileHeader(&b, binlog.FileHeader{
+			Created: now,
+			Host:    host,
+			Binary:  fmt.Sprintf("Built with %s %s for %s/%s", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH),
+		})
+		header = b.Bytes()
+	}
+	n, err := sb.file.Write(header)
 	sb.nbytes += uint64(n)
 	return err
 }
@@ -1106,14 +1528,14 @@ func (sb *syncBuffer) rotateFile(now time.Time, startup bool) error {
 const bufferSize = 256 * 1024
 
 // createFiles creates all the log files for severity from sev down to infoLog.
-// l.mu is held.
+// l.fileMu is held.
 func (l *loggingT) createFiles(sev severity.Severity) error {
 	interval := l.flushInterval
 	if interval == 0 {
 		interval = flushInterval
 	}
 	l.flushD.run(interval)
-	now := time.Now()
+	now := timeNow()
 	// Files are created in decreasing severity order, so as soon as we find one
 	// has already been created, we can stop.
 	for s := sev; s >= severity.InfoLog && l.file[s] == nil; s-- {
@@ -1123,6 +1545,13 @@ func (l *loggingT) createFiles(sev severity.Severity) error {
 			maxbytes: CalculateMaxSize(),
 		}
 		if err := sb.rotateFile(now, true); err != nil {
+			// Undo, so that the next attempt starts again with sev.
+			for undo := sev; undo > s; undo-- {
+				if sb, ok := l.file[undo].(*syncBuffer); ok {
+					_ = sb.file.Close() // ignore err
+				}
+				l.file[undo] = nil
+			}
 			return err
 		}
 		l.file[s] = sb
@@ -1220,22 +1649,25 @@ func StartFlushDaemon(interval time.Duration) {
 	logging.flushD.run(interval)
 }
 
-// lockAndFlushAll is like flushAll but locks l.mu first.
+// lockAndFlushAll is like flushAll but locks l.fileMu first.
 func (l *loggingT) lockAndFlushAll() {
-	l.mu.Lock()
+	l.fileMu.Lock()
 	l.flushAll()
-	l.mu.Unlock()
+	l.fileMu.Unlock()
 }
 
 // flushAll flushes all the logs and attempts to "sync" their data to disk.
-// l.mu is held.
+// l.fileMu is held.
 func (l *loggingT) flushAll() {
 	// Flush from fatal down, in case there's trouble flushing.
 	for s := severity.FatalLog; s >= severity.InfoLog; s-- {
 		file := l.file[s]
-		if file != nil {
+		if file != nil && (s == severity.FatalLog || file != l.file[s+1]) {
 			_ = file.Flush() // ignore error
 			_ = file.Sync()  // ignore error
+			if sb, ok := file.(*syncBuffer); ok && l.detectTruncation {
+				sb.checkTruncation()
+			}
 		}
 	}
 	if logging.loggerOptions.flush != nil {
@@ -1306,41 +1738,63 @@ func (lb logBridge) Write(b []byte) (n int, err error) {
 
 // setV computes and remembers the V level for a given PC
 // when vmodule is enabled.
-// File pattern matching takes the basename of the file, stripped
-// of its .go suffix, and uses filepath.Match, which is a little more
-// general than the *? matching used in C++.
+// Pattern matching is described in the package documentation. It uses
+// filepath.Match, which is a little more general than the *? matching
+// used in C++.
 // l.mu is held.
 func (l *loggingT) setV(pc uintptr) Level {
-	fn := runtime.FuncForPC(pc)
-	file, _ := fn.FileLine(pc)
-	// The file is something like /a/b/c/d.go. We want just the d.
-	file = strings.TrimSuffix(file, ".go")
-	if slash := strings.LastIndex(file, "/"); slash >= 0 {
-		file = file[slash+1:]
-	}
+	loc := verbosity.LocationForPC(pc)
+	level := Level(l.boosts.ModuleLevel(loc))
 	for _, filter := range l.vmodule.filter {
-		if filter.match(file) {
-			l.vmap[pc] = filter.level
-			return filter.level
+		if filter.match(loc) {
+			if filter.level > level {
+				level = filter.level
+			}
+			break
 		}
 	}
-	l.vmap[pc] = 0
-	return 0
+	l.vmap[pc] = level
+	return level
+}
+
+// setVLogger updates the copy of the -vlogger filter and invalidates the
+// levels cached for logger names.
+// l.mu is held.
+func (l *loggingT) setVLogger(filter verbosity.LoggerFilter) {
+	l.vloggerMu.Lock()
+	defer l.vloggerMu.Unlock()
+	l.vloggerFilter = filter
+	verbosity.NextGeneration(&l.vloggerGeneration)
+}
+
+// loggerLevel returns the -vlogger level for a logger name. It does not
+// lock l.mu.
+func (l *loggingT) loggerLevel(name *verbosity.LoggerName) Level {
+	if level, ok := name.Cached(atomic.LoadUint32(&l.vloggerGeneration)); ok {
+		return Level(level)
+	}
+	l.vloggerMu.Lock()
+	filter, generation := l.vloggerFilter, l.vloggerGeneration
+	l.vloggerMu.Unlock()
+	level := filter.Level(name.Name())
+	name.Store(generation, level)
+	return Level(level)
 }
 
 // Verbose is a boolean type that implements Infof (like Printf) etc.
 // See the documentation of V for more information.
 type Verbose struct {
 	enabled bool
+	level   Level
 	logger  *logWriter
 }
 
 func newVerbose(level Level, b bool) Verbose {
 	if logging.logger == nil {
-		return Verbose{b, nil}
+		return Verbose{b, level, nil}
 	}
 	v := logging.logger.V(int(level))
-	return Verbose{b, &logWriter{Logger: v, writeKlogBuffer: logging.loggerOptions.writeKlogBuffer}}
+	return Verbose{b, level, &logWriter{Logger: v, writeKlogBuffer: logging.loggerOptions.writeKlogBuffer}}
 }
 
 // V reports whether verbosity at the call site is at least the requested level.
@@ -1374,7 +1828,7 @@ func VDepth(depth int, level Level) Verbose {
 	// The fast path is two atomic loads and compares.
 
 	// Here is a cheap but safe test to see if V logging is enabled globally.
-	if logging.verbosity.get() >= level {
+	if logging.effectiveVerbosity.get() >= level {
 		return newVerbose(level, true)
 	}
 
@@ -1462,21 +1916,21 @@ func (v Verbose) InfofDepth(depth int, format string, args ...interface{}) {
 // See the documentation of V for usage.
 func (v Verbose) InfoS(msg string, keysAndValues ...interface{}) {
 	if v.enabled {
-		logging.infoS(v.logger, logging.filter, 0, msg, keysAndValues...)
+		logging.infoS(v.logger, logging.filter, v.level, 0, msg, keysAndValues...)
 	}
 }
 
 // InfoSDepth acts as InfoS but uses depth to determine which call frame to log.
 // InfoSDepth(0, "msg") is the same as InfoS("msg").
 func InfoSDepth(depth int, msg string, keysAndValues ...interface{}) {
-	logging.infoS(logging.logger, logging.filter, depth, msg, keysAndValues...)
+	logging.infoS(logging.logger, logging.filter, 0, depth, msg, keysAndValues...)
 }
 
 // InfoSDepth is equivalent to the global InfoSDepth function, guarded by the value of v.
 // See the documentation of V for usage.
 func (v Verbose) InfoSDepth(depth int, msg string, keysAndValues ...interface{}) {
 	if v.enabled {
-		logging.infoS(v.logger, logging.filter, depth, msg, keysAndValues...)
+		logging.infoS(v.logger, logging.filter, v.level, depth, msg, keysAndValues...)
 	}
 }
 
@@ -1540,7 +1994,7 @@ func InfofDepth(depth int, format string, args ...interface{}) {
 // output:
 // >> I1025 00:15:15.525108       1 controller_utils.go:116] "Pod status updated" pod="kubedns" status="ready"
 func InfoS(msg string, keysAndValues ...interface{}) {
-	logging.infoS(logging.logger, logging.filter, 0, msg, keysAndValues...)
+	logging.infoS(logging.logger, logging.filter, 0, 0, msg, keysAndValues...)
 }
 
 // Warning logs to the WARNING and INFO logs.
@@ -0,0 +1,240 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Asynchronous output.
+
+package plog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// OverflowPolicy determines what happens to a log entry when the queue for
+// asynchronous output is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock lets the caller wait until there is space in the
+	// queue. This is the default.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest discards the new log entry.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowDropOldest discards the oldest log entry in the queue to
+	// make space for the new one.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+)
+
+// overflowPolicy represents the setting of the -klog_async_overflow flag.
+type overflowPolicy struct {
+	policy OverflowPolicy
+}
+
+func (o *overflowPolicy) String() string {
+	return string(o.policy)
+}
+
+// Get is part of the flag.Getter interface. It returns an OverflowPolicy.
+func (o *overflowPolicy) Get() interface{} {
+	return o.policy
+}
+
+// Set is part of the flag.Value interface.
+func (o *overflowPolicy) Set(value string) error {
+	switch policy := OverflowPolicy(value); policy {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest:
+		o.policy = policy
+		return nil
+	default:
+		return fmt.Errorf("unknown overflow policy %q, must be one of %s, %s, %s", value, OverflowBlock, OverflowDropNewest, OverflowDropOldest)
+	}
+}
+
+// SetAsyncOutput enables asynchronous output when queueSize is positive.
+// Log entries then get written to stderr and the log files by a background
+// goroutine. Up to queueSize entries can wait in a queue for that, the policy
+// determines what happens when the queue is full. Dropped entries are counted
+// in Stats.Dropped. A queue size of zero restores synchronous output after
+// writing all pending entries. This is the programmatic equivalent of the
+// -klog_async_queue_size and -klog_async_overflow flags.
+//
+// Flush writes all pending entries before returning, Fatal before exiting.
+// Output through a logger set with SetLogger is always synchronous.
+//
+// Writing to stderr, log files and writers set with SetOutput happens
+// without holding the lock that serializes logging calls, so slow output
+// does not slow down the program as long as there is space in the queue.
+func SetAsyncOutput(queueSize int, policy OverflowPolicy) {
+	if queueSize < 0 {
+		panic(fmt.Sprintf("SetAsyncOutput(%d, %q): queue size must not be negative", queueSize, policy))
+	}
+	logging.mu.Lock()
+	if err := logging.asyncOverflow.Set(string(policy)); err != nil {
+		logging.mu.Unlock()
+		panic(fmt.Sprintf("SetAsyncOutput(%d, %q): %v", queueSize, policy, err))
+	}
+	logging.asyncQueueSize = queueSize
+	logging.mu.Unlock()
+
+	if queueSize == 0 {
+		asyncOutput.drain()
+	}
+}
+
+// asyncEntry is a formatted log entry waiting for asynchronous output.
+type asyncEntry struct {
+	s   severity.Severity
+	buf *buffer.Buffer
+
+	// format is the format of the data in buf.
+	format LoggingFormat
+
+	// toStderr is true if the entry only gets written to stderr.
+	toStderr bool
+
+	// alsoToStderr is true if the entry gets written to stderr in
+	// addition to the log files.
+	alsoToStderr bool
+}
+
+// asyncQueue holds log entries for the background goroutine which writes
+// them.
+type asyncQueue struct {
+	l  *loggingT
+	mu sync.Mutex
+	// cond gets signaled whenever entries or done change.
+	cond *sync.Cond
+	// entries are waiting to be written.
+	entries []asyncEntry
+	// spare gets reused for entries after writing them.
+	spare []asyncEntry
+	// added counts all entries that were added to the queue, done those
+	// that were written or dropped after adding them. Each entry gets
+	// counted in done only after all entries that were added before it.
+	added, done uint64
+	// dropped counts entries that were removed from the queue by
+	// OverflowDropOldest. Entries that were taken out of the queue
+	// earlier might still be getting written, so dropped entries only
+	// get counted in done together with the next entries that were
+	// written.
+	dropped uint64
+	// running is true once the background goroutine was started.
+	running bool
+}
+
+var asyncOutput = newAsyncQueue(&logging)
+
+func newAsyncQueue(l *loggingT) *asyncQueue {
+	q := &asyncQueue{l: l}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// put adds a log entry to the queue, applying the policy if the queue
+// already has size entries or more.
+func (q *asyncQueue) put(entry asyncEntry, size int, policy OverflowPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+	for len(q.entries) >= size {
+		switch policy {
+		case OverflowDropNewest:
+			q.drop(entry)
+			return
+		case OverflowDropOldest:
+			q.drop(q.entries[0])
+			q.entries[0] = asyncEntry{}
+			q.entries = q.entries[1:]
+			q.dropped++
+		default:
+			q.cond.Wait()
+		}
+	}
+	q.entries = append(q.entries, entry)
+	q.added++
+	q.cond.Broadcast()
+}
+
+// drop discards an entry instead of writing it.
+// q.mu is held.
+func (q *asyncQueue) drop(entry asyncEntry) {
+	atomic.AddInt64(&Stats.Dropped.lines, 1)
+	atomic.AddInt64(&Stats.Dropped.bytes, int64(entry.buf.Len()))
+	buffer.PutBuffer(entry.buf)
+}
+
+// drain blocks until all entries which were queued before the call are
+// written. Entries that get queued later are not waited for. It must not be
+// called while holding l.mu or l.fileMu.
+func (q *asyncQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for added := q.added; q.done < added; {
+		q.cond.Wait()
+	}
+}
+
+// run writes all entries in the queue, in the order in which they were
+// added, and then waits for more.
+func (q *asyncQueue) run() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for len(q.entries) == 0 {
+			q.cond.Wait()
+		}
+		entries := q.entries
+		q.entries = q.spare[:0]
+		dropped := q.dropped
+		q.dropped = 0
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		for i, entry := range entries {
+			q.l.writeAsync(entry)
+			entries[i] = asyncEntry{}
+		}
+
+		q.mu.Lock()
+		q.spare = entries[:0]
+		q.done += dropped + uint64(len(entries))
+		q.cond.Broadcast()
+	}
+}
+
+// writeAsync writes one entry like output would have done, then releases
+// its buffer. It only locks l.fileMu, so logging calls which need l.mu are
+// not blocked by file I/O.
+func (l *loggingT) writeAsync(entry asyncEntry) {
+	data := entry.buf.Bytes()
+	if entry.toStderr || entry.alsoToStderr {
+		writeStderr(entry.format, data)
+	}
+	if !entry.toStderr {
+		l.fileMu.Lock()
+		if err := l.writeFiles(entry.s, data); err != nil {
+			l.writeFailed(err, entry.format, data, entry.alsoToStderr)
+		}
+		l.fileMu.Unlock()
+	}
+	buffer.PutBuffer(entry.buf)
+}
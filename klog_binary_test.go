@@ -0,0 +1,211 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func TestBinaryFormat(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+	defer func(previous int) { buffer.Pid = previous }(buffer.Pid)
+	buffer.Pid = 1234
+	SetLoggingFormat(LoggingFormatBinary)
+	require.NoError(t, logging.verbosity.Set("2"))
+
+	InfoS("hello", "a", 1, "s", "x\ny", "d", time.Second)
+	V(2).InfoS("verbose", "missing")
+	ErrorS(errors.New("fail"), "oops", "obj", KRef("ns", "name"), "list", []int{1, 2})
+	Infof("multi\nline")
+	NewKlogr().WithName("foo").Info("named")
+
+	var text, json bytes.Buffer
+	reader := binlog.NewReader(strings.NewReader(contents(severity.InfoLog)))
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		record.WriteText(&text)
+		record.WriteJSON(&json)
+	}
+
+	textRe := regexp.MustCompile(`klog_binary_test.go:[0-9]+`)
+	actual := textRe.ReplaceAllString(text.String(), `klog_binary_test.go:NNN`)
+	expected := `I0102 15:04:05.067890    1234 klog_binary_test.go:NNN] "hello" a=1 s=<
+	x
+	y
+ > d="1s"
+I0102 15:04:05.067890    1234 klog_binary_test.go:NNN] "verbose" missing="(MISSING)"
+E0102 15:04:05.067890    1234 klog_binary_test.go:NNN] "oops" err="fail" obj="ns/name" list=[1,2]
+I0102 15:04:05.067890    1234 klog_binary_test.go:NNN] multi
+line
+I0102 15:04:05.067890    1234 klog_binary_test.go:NNN] "named" logger="foo"
+`
+	if actual != expected {
+		t.Errorf("unexpected text output:\n%s\nexpected:\n%s", actual, expected)
+	}
+
+	actual = textRe.ReplaceAllString(json.String(), `klog_binary_test.go:NNN`)
+	expected = `{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":0,"caller":"klog_binary_test.go:NNN","msg":"hello","a":1,"s":"x\ny","d":"1s"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":2,"caller":"klog_binary_test.go:NNN","msg":"verbose","missing":"(MISSING)"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"ERROR","caller":"klog_binary_test.go:NNN","msg":"oops","err":"fail","obj":"ns/name","list":[1,2]}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","caller":"klog_binary_test.go:NNN","msg":"multi\nline"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":0,"caller":"klog_binary_test.go:NNN","msg":"named","logger":"foo"}
+`
+	if actual != expected {
+		t.Errorf("unexpected JSON output:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestBinaryFormatStderr(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.toStderr = true
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+	defer func(previous int) { buffer.Pid = previous }(buffer.Pid)
+	buffer.Pid = 1234
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	require.NoError(t, err)
+	defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+	os.Stderr = stderr
+	SetLoggingFormat(LoggingFormatBinary)
+
+	InfoS("hello", "a", 1)
+
+	data, err := os.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	actual := regexp.MustCompile(`klog_binary_test.go:[0-9]+`).ReplaceAllString(string(data), `klog_binary_test.go:NNN`)
+	expected := `I0102 15:04:05.067890    1234 klog_binary_test.go:NNN] "hello" a=1
+`
+	if actual != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestWriteStderr(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	SetLoggingFormat(LoggingFormatBinary)
+	InfoS("hello")
+	binary := []byte(contents(severity.InfoLog))
+
+	for name, tc := range map[string]struct {
+		format   LoggingFormat
+		data     []byte
+		expected string
+	}{
+		"text-like-binary": {
+			format:   LoggingFormatText,
+			data:     []byte("\x01hello\n"),
+			expected: "\x01hello\n",
+		},
+		"truncated": {
+			format:   LoggingFormatBinary,
+			data:     binary[:len(binary)-1],
+			expected: string(binary[:len(binary)-1]),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+			require.NoError(t, err)
+			defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+			os.Stderr = stderr
+
+			writeStderr(tc.format, tc.data)
+
+			data, err := os.ReadFile(stderr.Name())
+			require.NoError(t, err)
+			if string(data) != tc.expected {
+				t.Errorf("unexpected output:\n%q\nexpected:\n%q", string(data), tc.expected)
+			}
+		})
+	}
+}
+
+func TestSkipHeadersStderr(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.toStderr = true
+	logging.skipHeaders = true
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	require.NoError(t, err)
+	defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+	os.Stderr = stderr
+
+	Info("\x01hello")
+
+	data, err := os.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	if string(data) != "\x01hello\n" {
+		t.Errorf("unexpected output: %q", string(data))
+	}
+}
+
+func TestBinaryFormatFile(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.logFile = filepath.Join(t.TempDir(), "app.log")
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	SetLoggingFormat(LoggingFormatBinary)
+
+	InfoS("hello", "a", 1)
+	Flush()
+
+	file, err := os.Open(logging.logFile)
+	require.NoError(t, err)
+	defer file.Close()
+	reader := binlog.NewReader(file)
+	record, err := reader.Next()
+	require.NoError(t, err)
+	if record.Message != "hello" || len(record.Values) != 1 || record.Values[0].Value != int64(1) {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if header := reader.Header(); header.Host != host || !strings.HasPrefix(header.Binary, "Built with ") {
+		t.Errorf("unexpected file header: %+v", header)
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plog
+
+import (
+	"time"
+
+	"github.com/pohly/plog/v2/internal/verbosity"
+)
+
+// BoostVerbosity temporarily raises the verbosity to at least the given
+// level. The vmodule patterns (same syntax as -vmodule, may be empty) raise
+// it further for the source code that they match. The boost ends when the
+// duration expires or when the returned cancel function is called,
+// whichever comes first. This is useful during incidents, because a high
+// verbosity which is forgotten can fill up the disks.
+//
+// Boosts may overlap. While any is active, the verbosity is the maximum of
+// all boosts and of the -v flag. For each source code location, the vmodule
+// level is the maximum of the first matching pattern in -vmodule and in
+// each boost. Boosts don't change the values of the flags.
+func BoostVerbosity(level Level, vmodule string, duration time.Duration) (cancel func(), err error) {
+	return logging.boosts.Start(&logging.mu, logging.boostsChanged, verbosity.Level(level), vmodule, duration)
+}
+
+// boostsChanged updates the state after a boost started or ended.
+// l.mu is held.
+func (l *loggingT) boostsChanged() {
+	l.setVState(l.verbosity, l.vmodule.filter, true)
+}
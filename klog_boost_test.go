@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func TestBoostVerbosity(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	require.NoError(t, logging.verbosity.Set("1"))
+	require.NoError(t, logging.vmodule.Set("base=2"))
+	check := func(t *testing.T, v, vmodule string, enabled Level) {
+		t.Helper()
+		if actual := logging.verbosity.String(); actual != v {
+			t.Errorf("expected v=%s, got %s", v, actual)
+		}
+		if actual := logging.vmodule.String(); actual != vmodule {
+			t.Errorf("expected vmodule=%q, got %q", vmodule, actual)
+		}
+		if !V(enabled).Enabled() {
+			t.Errorf("V(%d) not enabled", enabled)
+		}
+		if V(enabled + 1).Enabled() {
+			t.Errorf("V(%d) enabled", enabled+1)
+		}
+	}
+
+	// The flags keep their values during boosts.
+	cancel1, err := BoostVerbosity(6, "", time.Hour)
+	require.NoError(t, err)
+	check(t, "1", "base=2", 6)
+	cancel2, err := BoostVerbosity(4, "klog_boost_test=8", time.Hour)
+	require.NoError(t, err)
+	check(t, "1", "base=2", 8)
+
+	// The captured state are the flags.
+	state := CaptureState()
+	require.NoError(t, logging.verbosity.Set("2"))
+	require.NoError(t, logging.vmodule.Set("other=3"))
+	check(t, "2", "other=3", 8)
+
+	cancel2()
+	check(t, "2", "other=3", 6)
+	cancel1()
+	check(t, "2", "other=3", 2)
+
+	// Restoring ends boosts.
+	_, err = BoostVerbosity(7, "", time.Hour)
+	require.NoError(t, err)
+	state.Restore()
+	check(t, "1", "base=2", 1)
+	if level := logging.boosts.Level(); level != 0 {
+		t.Errorf("expected no boosts after Restore, got level %d", level)
+	}
+}
+
+func TestBoostVerbosityVModule(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	require.NoError(t, logging.vmodule.Set("klog_boost_test=5"))
+
+	// A boost does not lower the level of a matching -vmodule pattern.
+	cancel, err := BoostVerbosity(0, "klog_boost_test=2", time.Hour)
+	require.NoError(t, err)
+	defer cancel()
+	if !V(5).Enabled() {
+		t.Error("V(5) not enabled during boost with lower vmodule level")
+	}
+
+	cancel2, err := BoostVerbosity(0, "klog_boost*=7", time.Hour)
+	require.NoError(t, err)
+	defer cancel2()
+	if !V(7).Enabled() {
+		t.Error("V(7) not enabled during boost with higher vmodule level")
+	}
+}
+
+func TestBoostVerbosityExpires(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	_, err := BoostVerbosity(3, "", time.Millisecond)
+	require.NoError(t, err)
+	for start := time.Now(); V(3).Enabled(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("boost did not expire")
+		}
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+// Test that the global logger honors the verbosity of a context.
+func TestContextWithVerbosity(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	require.NoError(t, logging.verbosity.Set("1"))
+
+	ctx := context.Background()
+	if FromContext(ctx).V(2).Enabled() {
+		t.Error("V(2) enabled without verbosity in context")
+	}
+	debugCtx := ContextWithVerbosity(ctx, 4)
+	logger := FromContext(debugCtx).WithName("request").WithValues("id", 1)
+	if !logger.V(4).Enabled() {
+		t.Error("V(4) not enabled with verbosity in context")
+	}
+	if logger.V(5).Enabled() {
+		t.Error("V(5) enabled with verbosity in context")
+	}
+	if V(2).Enabled() {
+		t.Error("V(2) enabled for global logging")
+	}
+	logger.V(4).Info("debug")
+	if !contains(severity.InfoLog, `"debug" logger="request" id=1`) {
+		t.Errorf("missing log entry: %q", contents(severity.InfoLog))
+	}
+
+	// A logger in the context also gets modified.
+	if !FromContext(NewContext(debugCtx, NewKlogr())).V(4).Enabled() {
+		t.Error("V(4) not enabled for logger from context")
+	}
+
+	// Unsupported loggers are returned unchanged.
+	if FromContext(NewContext(debugCtx, logr.Discard())).GetSink() != nil {
+		t.Error("Discard logger should not have been modified")
+	}
+
+	// Without contextual logging, the context is ignored.
+	EnableContextualLogging(false)
+	if ContextWithVerbosity(ctx, 4) != ctx {
+		t.Error("context should not have been modified")
+	}
+	if FromContext(debugCtx).V(4).Enabled() {
+		t.Error("V(4) enabled without contextual logging")
+	}
+}
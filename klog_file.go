@@ -23,14 +23,124 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/pohly/plog/v2/internal/rotation"
+	"github.com/pohly/plog/v2/internal/severity"
 )
 
 // MaxSize is the maximum size of a log file in bytes.
 var MaxSize uint64 = 1024 * 1024 * 1800
 
+// Predefined intervals for SetRotationInterval. They correspond to
+// "hourly" and "daily" in the -klog_rotation_interval flag.
+const (
+	RotateHourly = time.Hour
+	RotateDaily  = 24 * time.Hour
+)
+
+// rotationInterval represents the setting of the -klog_rotation_interval flag.
+type rotationInterval struct {
+	interval time.Duration
+}
+
+func (r *rotationInterval) String() string {
+	// Lock because the type is not atomic.
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	switch r.interval {
+	case 0:
+		return ""
+	case RotateHourly:
+		return "hourly"
+	case RotateDaily:
+		return "daily"
+	default:
+		return r.interval.String()
+	}
+}
+
+// Get is part of the flag.Getter interface. It returns the interval as
+// time.Duration.
+func (r *rotationInterval) Get() interface{} {
+	return r.interval
+}
+
+// Set is part of the flag.Value interface.
+// Syntax: -klog_rotation_interval=hourly|daily|<duration>
+func (r *rotationInterval) Set(value string) error {
+	var interval time.Duration
+	switch value {
+	case "", "none":
+	case "hourly":
+		interval = RotateHourly
+	case "daily":
+		interval = RotateDaily
+	default:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("syntax error: expect hourly, daily or a duration: %v", err)
+		}
+		if v < 0 {
+			return errors.New("negative rotation interval")
+		}
+		interval = v
+	}
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	logging.setRotationInterval(interval)
+	return nil
+}
+
+// SetRotationInterval enables rotation of log files whenever the wall clock
+// crosses a boundary of the given interval, in addition to the size-based
+// rotation. Boundaries are aligned to midnight in local time, so RotateHourly
+// rotates at each full hour and RotateDaily at midnight. Intervals longer than
+// a day are rounded down to whole days. Zero disables time-based rotation.
+//
+// This is the programmatic equivalent of the -klog_rotation_interval flag.
+// It applies to files that are already open as well as to new ones.
+//
+// A single log file set with -log_file only gets rotated by time when
+// -klog_log_file_max_backups is positive, because otherwise each rotation
+// would truncate it.
+func SetRotationInterval(interval time.Duration) {
+	if interval < 0 {
+		panic(fmt.Sprintf("SetRotationInterval(%s): negative interval", interval))
+	}
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	logging.setRotationInterval(interval)
+}
+
+// setRotationInterval changes the rotation interval and recomputes when
+// the currently open files need to be rotated.
+// l.mu and l.fileMu are held.
+func (l *loggingT) setRotationInterval(interval time.Duration) {
+	l.rotationInterval.interval = interval
+	now := timeNow()
+	for s := severity.FatalLog; s >= severity.InfoLog; s-- {
+		if sb, ok := l.file[s].(*syncBuffer); ok {
+			sb.nextRotation = rotation.Next(now, l.timeRotationInterval())
+		}
+	}
+}
+
+// timeRotationInterval returns the interval for time-based rotation, zero if
+// disabled. Rotating the file set with -log_file without keeping a backup
+// would truncate it, so that is not done.
+func (l *loggingT) timeRotationInterval() time.Duration {
+	if l.logFile != "" && l.logFileMaxBackups <= 0 {
+		return 0
+	}
+	return l.rotationInterval.interval
+}
+
 // logDirs lists the candidate directories for new log files.
 var logDirs []string
 
@@ -64,22 +174,212 @@ func shortHostname(hostname string) string {
 	return hostname
 }
 
-// logName returns a new log file name containing tag, with start time t, and
-// the name for the symlink for tag.
-func logName(tag string, t time.Time) (name, link string) {
-	name = fmt.Sprintf("%s.%s.%s.log.%s.%04d%02d%02d-%02d%02d%02d.%d",
-		program,
-		host,
-		getUserName(),
-		tag,
-		t.Year(),
-		t.Month(),
-		t.Day(),
-		t.Hour(),
-		t.Minute(),
-		t.Second(),
-		pid)
-	return name, program + "." + tag
+// Placeholders that may be used in log file name templates.
+const (
+	placeholderProgram   = "{program}"
+	placeholderHost      = "{host}"
+	placeholderUser      = "{user}"
+	placeholderSeverity  = "{severity}"
+	placeholderTimestamp = "{timestamp}"
+	placeholderPid       = "{pid}"
+	placeholderSeq       = "{seq}"
+)
+
+const (
+	// defaultLogNameTemplate produces the traditional
+	// program.host.user.log.TAG.YYYYMMDD-HHMMSS.pid file names.
+	defaultLogNameTemplate = "{program}.{host}.{user}.log.{severity}.{timestamp}.{pid}"
+	// defaultLinkNameTemplate produces the traditional program.TAG
+	// symlink names.
+	defaultLinkNameTemplate = "{program}.{severity}"
+)
+
+// placeholderRe matches all placeholders in a template, valid or not.
+var placeholderRe = regexp.MustCompile(`\{[^{}]*\}`)
+
+// nameTemplate represents the setting of the -klog_log_file_name_template
+// and -klog_log_file_link_template flags.
+type nameTemplate struct {
+	template string
+	// optional is true if the template may be empty.
+	optional bool
+}
+
+func (n *nameTemplate) String() string {
+	// Lock because the type is not atomic.
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	return n.template
+}
+
+// Get is part of the flag.Getter interface.
+func (n *nameTemplate) Get() interface{} {
+	return n.template
+}
+
+// Set is part of the flag.Value interface.
+func (n *nameTemplate) Set(value string) error {
+	if err := validateNameTemplate(value, n.optional); err != nil {
+		return err
+	}
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	// Removing the old symlink would delete the new log file.
+	other := &logging.linkNameTemplate
+	if n == other {
+		other = &logging.logNameTemplate
+	}
+	if value != "" && value == other.template {
+		return fmt.Errorf("template %q must be different for log files and symlinks", value)
+	}
+	n.template = value
+	return nil
+}
+
+// validateNameTemplate checks that a template only uses known placeholders,
+// includes the severity and results in a file name without a directory.
+// Templates for log files must also include the timestamp or the sequence
+// number, otherwise new files would have the same name as old ones.
+func validateNameTemplate(template string, optional bool) error {
+	if template == "" {
+		if optional {
+			return nil
+		}
+		return errors.New("empty template")
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("template %q must not contain a path separator", template)
+	}
+	for _, p := range placeholderRe.FindAllString(template, -1) {
+		switch p {
+		case placeholderProgram, placeholderHost, placeholderUser, placeholderSeverity,
+			placeholderTimestamp, placeholderPid, placeholderSeq:
+		default:
+			return fmt.Errorf("template %q contains unknown placeholder %s", template, p)
+		}
+	}
+	if !strings.Contains(template, placeholderSeverity) {
+		return fmt.Errorf("template %q must contain %s", template, placeholderSeverity)
+	}
+	if !optional && !strings.Contains(template, placeholderTimestamp) && !strings.Contains(template, placeholderSeq) {
+		return fmt.Errorf("template %q must contain %s or %s", template, placeholderTimestamp, placeholderSeq)
+	}
+	return nil
+}
+
+// expandNameTemplate replaces all placeholders in the template.
+func expandNameTemplate(template, tag string, t time.Time, seq int) string {
+	return strings.NewReplacer(
+		placeholderProgram, program,
+		placeholderHost, host,
+		placeholderUser, getUserName(),
+		placeholderSeverity, tag,
+		placeholderTimestamp, fmt.Sprintf("%04d%02d%02d-%02d%02d%02d",
+			t.Year(),
+			t.Month(),
+			t.Day(),
+			t.Hour(),
+			t.Minute(),
+			t.Second()),
+		placeholderPid, strconv.Itoa(pid),
+		placeholderSeq, strconv.Itoa(seq),
+	).Replace(template)
+}
+
+// logName returns a new log file name containing tag, with start time t and
+// sequence number seq, and the name for the symlink for tag. The link is
+// empty if no symlink is wanted.
+// l.fileMu is held.
+func logName(tag string, t time.Time, seq int) (name, link string) {
+	name = expandNameTemplate(logging.logNameTemplate.template, tag, t, seq)
+	if logging.linkNameTemplate.template != "" {
+		link = expandNameTemplate(logging.linkNameTemplate.template, tag, t, seq)
+	}
+	return name, link
+}
+
+// logNameRegexp turns a template into a regular expression that matches
+// file names generated by logName for the current program and the given tag.
+// Host and user name may be different, but other host and user names must
+// not contain dots. Otherwise "app" would also match the files of a program
+// called "app.worker". The sequence number is available as submatch "seq". A
+// suffix for compressed files is also accepted.
+func logNameRegexp(template, tag string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringIndex(template, -1) {
+		re.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		switch template[loc[0]:loc[1]] {
+		case placeholderProgram:
+			re.WriteString(regexp.QuoteMeta(program))
+		case placeholderSeverity:
+			re.WriteString(regexp.QuoteMeta(tag))
+		case placeholderHost:
+			re.WriteString(`[^.]+`)
+		case placeholderUser:
+			// The current user name may contain dots, for example in
+			// the domain on Windows.
+			re.WriteString(`(?:` + regexp.QuoteMeta(getUserName()) + `|[^.]+)`)
+		case placeholderTimestamp:
+			re.WriteString(`[0-9]{8}-[0-9]{6}`)
+		case placeholderPid:
+			re.WriteString(`[0-9]+`)
+		case placeholderSeq:
+			re.WriteString(`(?P<seq>[0-9]+)`)
+		}
+		last = loc[1]
+	}
+	re.WriteString(regexp.QuoteMeta(template[last:]))
+	re.WriteString(`(\.gz)?$`)
+	return regexp.MustCompile(re.String())
+}
+
+// isLogName reports whether name was generated by logName for the
+// current program and the given tag.
+// l.fileMu is held.
+func isLogName(name, tag string) bool {
+	return logNameRegexp(logging.logNameTemplate.template, tag).MatchString(name)
+}
+
+// compressedOriginal returns the name of the uncompressed file for the name
+// of a compressed file, or the empty string if it is not compressed.
+func compressedOriginal(name string) string {
+	for _, suffix := range compressionSuffix {
+		if original := strings.TrimSuffix(name, suffix); original != name {
+			return original
+		}
+	}
+	return ""
+}
+
+// logSeq determines the sequence number for a new log file in dir. It is one
+// higher than the highest number of any existing file for the tag, or the
+// same number when reopening files during startup. Sequence numbers start
+// at 1.
+// l.fileMu is held.
+func logSeq(dir, tag string, startup bool) int {
+	template := logging.logNameTemplate.template
+	if !strings.Contains(template, placeholderSeq) {
+		return 0
+	}
+	re := logNameRegexp(template, tag)
+	seqIndex := re.SubexpIndex("seq")
+	entries, _ := os.ReadDir(dir) // ignore err, creating the file will fail
+	seq := 0
+	for _, entry := range entries {
+		m := re.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		if v, err := strconv.Atoi(m[seqIndex]); err == nil && v > seq {
+			seq = v
+		}
+	}
+	if !startup || seq == 0 {
+		seq++
+	}
+	return seq
 }
 
 var onceLogDirs sync.Once
@@ -92,6 +392,11 @@ var onceLogDirs sync.Once
 // If startup is true, existing files are opened for appending instead of truncated.
 func create(tag string, t time.Time, startup bool) (f *os.File, filename string, err error) {
 	if logging.logFile != "" {
+		if !startup && logging.logFileMaxBackups > 0 {
+			if err := rotation.Backup(logging.logFile, logging.logFileMaxBackups); err != nil {
+				return nil, "", fmt.Errorf("log: unable to back up log: %v", err)
+			}
+		}
 		f, err := openOrCreate(logging.logFile, startup)
 		if err == nil {
 			return f, logging.logFile, nil
@@ -102,15 +407,18 @@ func create(tag string, t time.Time, startup bool) (f *os.File, filename string,
 	if len(logDirs) == 0 {
 		return nil, "", errors.New("log: no log dirs")
 	}
-	name, link := logName(tag, t)
 	var lastErr error
 	for _, dir := range logDirs {
+		name, link := logName(tag, t, logSeq(dir, tag, startup))
 		fname := filepath.Join(dir, name)
 		f, err := openOrCreate(fname, startup)
 		if err == nil {
-			symlink := filepath.Join(dir, link)
-			_ = os.Remove(symlink)        // ignore err
-			_ = os.Symlink(name, symlink) // ignore err
+			if link != "" && link != name {
+				symlink := filepath.Join(dir, link)
+				_ = os.Remove(symlink)        // ignore err
+				_ = os.Symlink(name, symlink) // ignore err
+			}
+			pruneLogFiles(dir, tag, name, logging.retention, t)
 			return f, fname, nil
 		}
 		lastErr = err
@@ -120,11 +428,107 @@ func create(tag string, t time.Time, startup bool) (f *os.File, filename string,
 
 // The startup argument indicates whether this is the initial startup of plog.
 // If startup is true, existing files are opened for appending instead of truncated.
+// Files are always in append mode, so writes continue at the end of the file
+// after an external tool truncated it.
 func openOrCreate(name string, startup bool) (*os.File, error) {
 	if startup {
-		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		f, err := openFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		return f, err
 	}
-	f, err := os.Create(name)
+	f, err := openFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0666)
 	return f, err
 }
+
+var openFile = os.OpenFile // Stubbed out for testing.
+
+// RetentionPolicy determines which old log files are kept in the log
+// directory. Log files are pruned separately for each severity tag each time
+// a new file is created. Only files whose names were generated for the
+// current program are considered, other files in the same directory are
+// never removed. The file that is currently being written is always kept.
+//
+// The zero value of each field disables the corresponding limit.
+type RetentionPolicy struct {
+	// MaxFiles is the maximum number of files per severity, including
+	// the current one.
+	MaxFiles int
+
+	// MaxTotalSizeMB is the maximum total size of all files per
+	// severity. Unit is megabytes.
+	MaxTotalSizeMB uint64
+
+	// MaxAge is the maximum time since the last modification of a file.
+	MaxAge time.Duration
+}
+
+// SetRetentionPolicy sets which old log files are kept. This is the
+// programmatic equivalent of the -klog_retention_max_files,
+// -klog_retention_max_size and -klog_retention_max_age flags. The new policy
+// gets applied the next time that a log file is created.
+//
+// The policy has no effect when logging to a single file with -log_file.
+func SetRetentionPolicy(policy RetentionPolicy) {
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	logging.retention = policy
+}
+
+// pruneLogFiles removes old log files for the tag from dir according to the
+// retention policy. current is the base name of the file which was just
+// created. Files which are being compressed are kept. Temporary files left
+// behind by an interrupted compression get removed. Errors are ignored
+// because they are not worth failing the logging call for.
+// l.fileMu is held.
+func pruneLogFiles(dir, tag, current string, policy RetentionPolicy, now time.Time) {
+	if policy == (RetentionPolicy{}) {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	re := logNameRegexp(logging.logNameTemplate.template, tag)
+	var files []os.FileInfo
+	var totalSize uint64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		if tmp := strings.TrimSuffix(name, ".tmp"); tmp != name {
+			if original := compressedOriginal(tmp); original != "" && re.MatchString(tmp) &&
+				!fileCompressor.busy(filepath.Join(dir, original)) {
+				_ = os.Remove(filepath.Join(dir, name)) // ignore err
+			}
+			continue
+		}
+		if !re.MatchString(name) || fileCompressor.busy(filepath.Join(dir, name)) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if name == current {
+			totalSize += uint64(info.Size())
+			continue
+		}
+		files = append(files, info)
+	}
+
+	// Newest first, those are the ones to keep.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	maxSize := policy.MaxTotalSizeMB * 1024 * 1024
+	for i, info := range files {
+		size := uint64(info.Size())
+		if policy.MaxFiles > 0 && i+1 >= policy.MaxFiles ||
+			maxSize > 0 && totalSize+size > maxSize ||
+			policy.MaxAge > 0 && now.Sub(info.ModTime()) > policy.MaxAge {
+			_ = os.Remove(filepath.Join(dir, info.Name())) // ignore err
+			continue
+		}
+		totalSize += size
+	}
+}
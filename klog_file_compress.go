@@ -0,0 +1,172 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Compression of rotated log files.
+
+package plog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CompressionGzip is the only supported value for SetCompression and the
+// -klog_compression flag besides the empty string, which disables
+// compression.
+const CompressionGzip = "gzip"
+
+// compressionSuffix maps a compression format to the suffix that gets
+// appended to the name of a compressed log file.
+var compressionSuffix = map[string]string{
+	CompressionGzip: ".gz",
+}
+
+// compression represents the setting of the -klog_compression flag.
+type compression string
+
+func (c *compression) String() string {
+	return string(*c)
+}
+
+// Get is part of the flag.Getter interface.
+func (c *compression) Get() interface{} {
+	return string(*c)
+}
+
+// Set is part of the flag.Value interface.
+func (c *compression) Set(value string) error {
+	if _, ok := compressionSuffix[value]; !ok && value != "" {
+		return fmt.Errorf("unsupported compression %q, must be empty or %q", value, CompressionGzip)
+	}
+	*c = compression(value)
+	return nil
+}
+
+// SetCompression enables compression of log files after they were rotated.
+// The only supported format is CompressionGzip. An empty string disables
+// compression. This is the programmatic equivalent of the -klog_compression
+// flag.
+//
+// Compression runs in the background and is not supported when logging to a
+// single file with -log_file. Flush waits for pending compression to finish.
+// Errors are reported on stderr.
+func SetCompression(format string) {
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	if err := logging.compression.Set(format); err != nil {
+		panic(fmt.Sprintf("SetCompression(%q): %v", format, err))
+	}
+}
+
+// compressor keeps track of background compression.
+type compressor struct {
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+	// active contains the paths of the files which are being compressed.
+	active map[string]bool
+}
+
+var fileCompressor compressor
+
+// compress starts compressing the file in the background.
+func (c *compressor) compress(format, path string) {
+	c.mu.Lock()
+	if c.active == nil {
+		c.active = make(map[string]bool)
+	}
+	c.active[path] = true
+	c.mu.Unlock()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.mu.Lock()
+			delete(c.active, path)
+			c.mu.Unlock()
+		}()
+		// The retention policy may have removed the file before
+		// compression started.
+		if err := compressFile(format, path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "plog: compressing log file failed: %v\n", err)
+		}
+	}()
+}
+
+// busy reports whether the file is being compressed.
+func (c *compressor) busy(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active[path]
+}
+
+// wait blocks until all pending compression is done.
+func (c *compressor) wait() {
+	c.wg.Wait()
+}
+
+// compressFile writes a compressed copy of the file under the same name plus
+// a suffix for the format and then removes the original. The copy becomes
+// visible under its final name only once it is complete, so a crash leaves
+// either the original file or the compressed one behind, plus possibly a
+// temporary file, which pruneLogFiles removes. The original modification time is preserved for the
+// retention policy.
+func compressFile(format, path string) (finalErr error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dstPath := path + compressionSuffix[format]
+	tmpPath := dstPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if finalErr != nil {
+			_ = dst.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = info.ModTime()
+	if _, err := io.Copy(zw, src); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%s: %v", tmpPath, err)
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	_ = os.Chtimes(tmpPath, info.ModTime(), info.ModTime()) // ignore err
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
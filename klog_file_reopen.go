@@ -0,0 +1,133 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Support for external log rotation.
+
+package plog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// ReopenFiles flushes all log files and then opens them again under the same
+// name. This is meant to be called after an external tool like logrotate
+// renamed the files, otherwise klog would continue writing to the renamed
+// files. Files which were replaced with a new, empty file get a new header.
+//
+// If reopening a file fails, klog keeps writing to the old one and continues
+// with the remaining files. The first error is returned.
+func ReopenFiles() error {
+	logging.fileMu.Lock()
+	defer logging.fileMu.Unlock()
+	return logging.reopenFiles()
+}
+
+// reopenFiles implements ReopenFiles. Severities may share the same file,
+// for example with -log_file, which then gets reopened only once.
+// l.fileMu is held.
+func (l *loggingT) reopenFiles() error {
+	var firstErr error
+	seen := make(map[*syncBuffer]bool)
+	for s := severity.FatalLog; s >= severity.InfoLog; s-- {
+		if sb, ok := l.file[s].(*syncBuffer); ok && !seen[sb] {
+			seen[sb] = true
+			if err := sb.reopen(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// ReopenFilesOnSignal starts a goroutine which calls ReopenFiles each time
+// the process receives one of the given signals, SIGHUP if none are given.
+// Errors are reported on stderr. The returned function stops the goroutine.
+//
+// This is opt-in because the signal handler replaces the default behavior
+// for the signal, which is to terminate the process in the case of SIGHUP.
+func ReopenFilesOnSignal(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, signals...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				if err := ReopenFiles(); err != nil {
+					fmt.Fprintf(os.Stderr, "plog: reopening log files failed: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// reopen opens the file again under its current name and then closes the
+// old file. If a new file gets created, it starts with a header.
+func (sb *syncBuffer) reopen() error {
+	name := sb.file.Name()
+	f, err := openOrCreate(name, true)
+	if err != nil {
+		return fmt.Errorf("log: unable to reopen log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("log: unable to reopen log: file stat could not get fileinfo: %v", err)
+	}
+	_ = sb.Flush()      // ignore err
+	_ = sb.file.Close() // ignore err
+	sb.file = f
+	sb.Writer.Reset(f)
+	sb.nbytes = uint64(info.Size())
+	sb.retryAt = time.Time{}
+	if sb.nbytes == 0 && !sb.logger.skipLogHeaders {
+		return sb.writeHeader(timeNow())
+	}
+	return nil
+}
+
+// checkTruncation detects whether the file was truncated by an external tool,
+// as done by logrotate with copytruncate. Writing then continues at the new
+// end of the file and the size limit starts to count again from there.
+// Errors are ignored, the next check may succeed.
+// Must be called after flushing.
+func (sb *syncBuffer) checkTruncation() {
+	info, err := sb.file.Stat()
+	if err != nil || uint64(info.Size()) >= sb.nbytes {
+		return
+	}
+	// Files are opened in append mode, so writing already continues at
+	// the new end. The offset is the new size.
+	offset, err := sb.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+	sb.nbytes = uint64(offset)
+}
@@ -0,0 +1,318 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Output formats other than the klog text format.
+
+package plog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pohly/plog/v2/binlog"
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/color"
+	"github.com/pohly/plog/v2/internal/dbg"
+	"github.com/pohly/plog/v2/internal/serialize"
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// LoggingFormat selects how log entries get formatted by plog when no
+// logger was set with SetLogger.
+type LoggingFormat string
+
+const (
+	// LoggingFormatText is the traditional klog text format. This is
+	// the default.
+	LoggingFormatText LoggingFormat = "text"
+
+	// LoggingFormatJSON writes one JSON object per line. It has the
+	// fields "ts" (time stamp in RFC 3339 format with microseconds),
+	// "severity" (INFO, WARNING, ERROR, FATAL), "v" (verbosity of
+	// structured info messages), "caller" (file:line), "msg" and "err"
+	// (only for errors), followed by all key/value pairs. The name of a
+	// logger created with NewKlogr is the "logger" key/value pair.
+	LoggingFormatJSON LoggingFormat = "json"
+
+	// LoggingFormatLogfmt writes one line per log entry with key=value
+	// pairs, without the klog header. The keys "ts", "level", "v",
+	// "caller", "msg" and "err" have the same meaning as in the JSON
+	// format, except that the level is in lower case. Values are quoted
+	// when needed and complex values are serialized as JSON.
+	LoggingFormatLogfmt LoggingFormat = "logfmt"
+
+	// LoggingFormatBinary writes log entries in the compact encoding
+	// implemented by the binlog package. Values are stored with their
+	// type instead of being formatted as text, which is faster and
+	// produces smaller files. The binlog package and the plogcat
+	// command convert such files into text or JSON. Entries which get
+	// written to stderr are always converted into the text format.
+	LoggingFormatBinary LoggingFormat = "binary"
+)
+
+// loggingFormat represents the setting of the -logging_format flag.
+type loggingFormat struct {
+	format LoggingFormat
+}
+
+func (f *loggingFormat) String() string {
+	return string(f.format)
+}
+
+// Get is part of the flag.Getter interface. It returns a LoggingFormat.
+func (f *loggingFormat) Get() interface{} {
+	return f.format
+}
+
+// Set is part of the flag.Value interface.
+func (f *loggingFormat) Set(value string) error {
+	switch format := LoggingFormat(value); format {
+	case LoggingFormatText, LoggingFormatJSON, LoggingFormatLogfmt, LoggingFormatBinary:
+		f.format = format
+		return nil
+	default:
+		return fmt.Errorf("unknown logging format %q, must be one of %s, %s, %s, %s", value, LoggingFormatText, LoggingFormatJSON, LoggingFormatLogfmt, LoggingFormatBinary)
+	}
+}
+
+// SetLoggingFormat changes how log entries get formatted. It applies to log
+// files, stderr and writers set with SetOutput, but not to a logger set with
+// SetLogger. This is the programmatic equivalent of the -logging_format
+// flag.
+func SetLoggingFormat(format LoggingFormat) {
+	logging.lockWithFiles()
+	defer logging.unlockWithFiles()
+	if err := logging.loggingFormat.Set(string(format)); err != nil {
+		panic(fmt.Sprintf("SetLoggingFormat(%q): %v", format, err))
+	}
+}
+
+// ColorMode determines whether plog uses ANSI colors in the text format.
+type ColorMode string
+
+const (
+	// ColorNever disables colors. This is the default.
+	ColorNever ColorMode = color.Never
+
+	// ColorAuto enables colors if the output is a terminal and the
+	// NO_COLOR environment variable is empty.
+	ColorAuto ColorMode = color.Auto
+
+	// ColorAlways enables colors unconditionally.
+	ColorAlways ColorMode = color.Always
+)
+
+// colorMode represents the setting of the -klog_color flag.
+type colorMode struct {
+	mode ColorMode
+	// enabled is determined once when setting the mode.
+	enabled bool
+}
+
+func (c *colorMode) String() string {
+	return string(c.mode)
+}
+
+// Get is part of the flag.Getter interface. It returns a ColorMode.
+func (c *colorMode) Get() interface{} {
+	return c.mode
+}
+
+// Set is part of the flag.Value interface.
+func (c *colorMode) Set(value string) error {
+	switch mode := ColorMode(value); mode {
+	case ColorNever, ColorAuto, ColorAlways:
+		c.mode = mode
+		c.enabled = color.Enabled(value, os.Stderr)
+		return nil
+	default:
+		return fmt.Errorf("unknown color mode %q, must be one of %s, %s, %s", value, ColorNever, ColorAuto, ColorAlways)
+	}
+}
+
+// SetColorMode determines whether log entries which are written only to
+// stderr get colored: the severity letter and keys are highlighted, errors
+// are shown in red and logger names are dimmed. Colors are never used for
+// log files, for entries that are written to stderr and log files, nor for
+// formats other than text. This is the programmatic equivalent of the
+// -klog_color flag.
+func SetColorMode(mode ColorMode) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if err := logging.colorMode.Set(string(mode)); err != nil {
+		panic(fmt.Sprintf("SetColorMode(%q): %v", mode, err))
+	}
+}
+
+// colors returns true if the output gets colored.
+func (l *loggingT) colors() bool {
+	return l.colorMode.enabled && l.toStderr && l.logger == nil && l.loggingFormat.format == LoggingFormatText
+}
+
+// printFormatted is the version of printS for formats other than text.
+func (l *loggingT) printFormatted(err error, s severity.Severity, level Level, depth int, msg string, keysAndValues ...interface{}) {
+	// The header is empty in these formats, we just need file and line.
+	buf, file, line := l.header(s, depth)
+	l.formatEntry(buf, s, file, line, timeNow(), true, s == severity.InfoLog, level, msg, err, keysAndValues)
+	l.output(s, nil, buf, depth, file, line, false)
+}
+
+// textToFormat replaces the buffer with the message of an unstructured log
+// call with an entry in the configured format if needed. The buffer then
+// gets released.
+func (l *loggingT) textToFormat(s severity.Severity, logger *logWriter, file string, line int, buf *buffer.Buffer) *buffer.Buffer {
+	if logger != nil || l.loggingFormat.format == LoggingFormatText {
+		return buf
+	}
+	msg := buf.Bytes()
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	formatted := buffer.GetBuffer()
+	l.formatEntry(formatted, s, file, line, timeNow(), false, false, 0, string(msg), nil, nil)
+	buffer.PutBuffer(buf)
+	return formatted
+}
+
+// formatEntry writes one log entry in the configured format. Only the binary
+// format distinguishes between structured and unstructured entries.
+func (l *loggingT) formatEntry(buf *buffer.Buffer, s severity.Severity, file string, line int, now time.Time, structured, hasLevel bool, level Level, msg string, err error, keysAndValues []interface{}) {
+	switch l.loggingFormat.format {
+	case LoggingFormatLogfmt:
+		l.formatLogfmt(buf, s, file, line, now, hasLevel, level, msg, err, keysAndValues)
+	case LoggingFormatBinary:
+		l.formatBinary(buf, s, file, line, now, structured, hasLevel, level, msg, err, keysAndValues)
+	default:
+		l.formatJSON(buf, s, file, line, now, hasLevel, level, msg, err, keysAndValues)
+	}
+}
+
+// formatLogfmt writes one log entry in logfmt format.
+func (l *loggingT) formatLogfmt(buf *buffer.Buffer, s severity.Severity, file string, line int, now time.Time, hasLevel bool, level Level, msg string, err error, keysAndValues []interface{}) {
+	v := -1
+	if hasLevel {
+		v = int(level)
+	}
+	serialize.LogfmtHeader(&buf.Buffer, now, s, v, file, line, msg)
+	if err != nil {
+		serialize.LogfmtFormat(&buf.Buffer, "err", err)
+	}
+	serialize.LogfmtListFormat(&buf.Buffer, keysAndValues...)
+	buf.WriteByte('\n')
+}
+
+// formatJSON writes one log entry in JSON format.
+func (l *loggingT) formatJSON(buf *buffer.Buffer, s severity.Severity, file string, line int, now time.Time, hasLevel bool, level Level, msg string, err error, keysAndValues []interface{}) {
+	v := -1
+	if hasLevel {
+		v = int(level)
+	}
+	serialize.JSONHeader(&buf.Buffer, now, s, v, file, line, msg)
+	if err != nil {
+		serialize.JSONFormat(&buf.Buffer, "err", serialize.ErrorToString(err))
+	}
+	serialize.JSONListFormat(&buf.Buffer, keysAndValues...)
+	buf.WriteString("}\n")
+}
+
+// formatBinary writes one log entry in the binary format.
+func (l *loggingT) formatBinary(buf *buffer.Buffer, s severity.Severity, file string, line int, now time.Time, structured, hasLevel bool, level Level, msg string, err error, keysAndValues []interface{}) {
+	r := binlog.Record{
+		Time:       now,
+		Severity:   s,
+		Verbosity:  -1,
+		ThreadID:   buffer.CurrentThreadID(l.headerThreadID.threadID()),
+		File:       file,
+		Line:       line,
+		Structured: structured,
+		Message:    msg,
+	}
+	if hasLevel {
+		r.Verbosity = int(level)
+	}
+	if err != nil {
+		r.Values = []binlog.KeyValue{{Key: "err", Value: serialize.ErrorToString(err)}}
+	}
+	binlog.AppendRecord(&buf.Buffer, r, keysAndValues...)
+}
+
+// writeStacks adds a stack trace to a log entry. In the JSON and logfmt
+// formats, it becomes the "stacktrace" field of the entry.
+func (l *loggingT) writeStacks(buf *buffer.Buffer, logger *logWriter, stacks []byte) {
+	format := l.loggingFormat.format
+	if logger != nil {
+		format = LoggingFormatText
+	}
+	switch {
+	case format == LoggingFormatBinary:
+		binlog.AppendText(&buf.Buffer, stacks)
+	case format == LoggingFormatJSON && bytes.HasSuffix(buf.Bytes(), []byte("}\n")):
+		buf.Truncate(buf.Len() - 2)
+		buf.WriteString(`,"stacktrace":`)
+		serialize.JSONString(&buf.Buffer, string(stacks))
+		buf.WriteString("}\n")
+	case format == LoggingFormatLogfmt && bytes.HasSuffix(buf.Bytes(), []byte("\n")):
+		buf.Truncate(buf.Len() - 1)
+		serialize.LogfmtFormat(&buf.Buffer, "stacktrace", string(stacks))
+		buf.WriteByte('\n')
+	default:
+		buf.Write(stacks)
+	}
+}
+
+// fatalStacks returns the stack traces which get written after a fatal log
+// entry, either of the current or of all goroutines. In formats other than
+// text and binary, they become a separate entry.
+func (l *loggingT) fatalStacks(logger *logWriter, file string, line int, all bool) []byte {
+	stacks := dbg.Stacks(all)
+	if logger != nil || l.loggingFormat.format == LoggingFormatText {
+		return stacks
+	}
+	buf := buffer.GetBuffer()
+	defer buffer.PutBuffer(buf)
+	if l.loggingFormat.format != LoggingFormatBinary {
+		l.formatEntry(buf, severity.FatalLog, file, line, timeNow(), true, false, 0, "Stack traces", nil, nil)
+	}
+	l.writeStacks(buf, logger, stacks)
+	return append([]byte(nil), buf.Bytes()...)
+}
+
+// writeStderr writes log output in the given format to stderr. Output in the
+// binary format gets converted into the text format first. If that fails,
+// the raw data gets written instead.
+func writeStderr(format LoggingFormat, data []byte) {
+	if format != LoggingFormatBinary {
+		os.Stderr.Write(data)
+		return
+	}
+	var b bytes.Buffer
+	reader := binlog.NewReader(bytes.NewReader(data))
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Better garbled output than no output at all.
+			os.Stderr.Write(data)
+			return
+		}
+		record.WriteText(&b)
+	}
+	os.Stderr.Write(b.Bytes())
+}
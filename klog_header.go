@@ -0,0 +1,252 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Options for the header of the text format.
+
+package plog
+
+import (
+	"fmt"
+
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/sourcepath"
+)
+
+// TimePrecision determines how many digits of the fractions of a second are
+// shown in the header.
+type TimePrecision string
+
+const (
+	// PrecisionMilliseconds shows three digits.
+	PrecisionMilliseconds TimePrecision = "ms"
+	// PrecisionMicroseconds shows six digits. This is the default.
+	PrecisionMicroseconds TimePrecision = "us"
+	// PrecisionNanoseconds shows nine digits.
+	PrecisionNanoseconds TimePrecision = "ns"
+)
+
+// timePrecision represents the setting of the -klog_header_precision flag.
+type timePrecision struct {
+	precision TimePrecision
+}
+
+func (t *timePrecision) String() string {
+	return string(t.precision)
+}
+
+// Get is part of the flag.Getter interface. It returns a TimePrecision.
+func (t *timePrecision) Get() interface{} {
+	return t.precision
+}
+
+// Set is part of the flag.Value interface.
+func (t *timePrecision) Set(value string) error {
+	switch precision := TimePrecision(value); precision {
+	case PrecisionMilliseconds, PrecisionMicroseconds, PrecisionNanoseconds:
+		t.precision = precision
+		return nil
+	default:
+		return fmt.Errorf("unknown time precision %q, must be one of %s, %s, %s", value, PrecisionMilliseconds, PrecisionMicroseconds, PrecisionNanoseconds)
+	}
+}
+
+// digits returns the number of digits for buffer.HeaderOptions.
+func (t *timePrecision) digits() int {
+	switch t.precision {
+	case PrecisionMilliseconds:
+		return 3
+	case PrecisionNanoseconds:
+		return 9
+	default:
+		return 6
+	}
+}
+
+// HeaderPath determines how the source file is shown in the header.
+type HeaderPath string
+
+const (
+	// HeaderPathBase shows only the file name. This is the default.
+	HeaderPathBase HeaderPath = "base"
+	// HeaderPathDir shows the file name and the directory which contains
+	// it, the same as -add_dir_header.
+	HeaderPathDir HeaderPath = "dir"
+	// HeaderPathModule shows the path relative to the root of the Go
+	// module which contains the file. Files from the standard library
+	// are shown with their import path.
+	HeaderPathModule HeaderPath = "module"
+)
+
+// headerPath represents the setting of the -klog_header_path flag.
+type headerPath struct {
+	path HeaderPath
+}
+
+func (h *headerPath) String() string {
+	return string(h.path)
+}
+
+// Get is part of the flag.Getter interface. It returns a HeaderPath.
+func (h *headerPath) Get() interface{} {
+	return h.path
+}
+
+// Set is part of the flag.Value interface.
+func (h *headerPath) Set(value string) error {
+	switch path := HeaderPath(value); path {
+	case HeaderPathBase, HeaderPathDir, HeaderPathModule:
+		h.path = path
+		return nil
+	default:
+		return fmt.Errorf("unknown header path %q, must be one of %s, %s, %s", value, HeaderPathBase, HeaderPathDir, HeaderPathModule)
+	}
+}
+
+// ThreadIDMode determines what is shown in the thread ID column of the
+// header.
+type ThreadIDMode string
+
+const (
+	// ThreadIDPid shows the process ID. This is the default.
+	ThreadIDPid ThreadIDMode = "pid"
+	// ThreadIDTid shows the ID of the operating system thread. This is
+	// only supported on Linux, other platforms show the process ID.
+	// Goroutines can migrate between threads, so this ID only identifies
+	// the thread which happened to run the goroutine while it was logging.
+	ThreadIDTid ThreadIDMode = "tid"
+	// ThreadIDGoroutine shows the ID of the goroutine.
+	ThreadIDGoroutine ThreadIDMode = "goroutine"
+)
+
+// threadIDMode represents the setting of the -klog_header_thread_id flag.
+type threadIDMode struct {
+	mode ThreadIDMode
+}
+
+func (t *threadIDMode) String() string {
+	return string(t.mode)
+}
+
+// Get is part of the flag.Getter interface. It returns a ThreadIDMode.
+func (t *threadIDMode) Get() interface{} {
+	return t.mode
+}
+
+// Set is part of the flag.Value interface.
+func (t *threadIDMode) Set(value string) error {
+	switch mode := ThreadIDMode(value); mode {
+	case ThreadIDPid, ThreadIDTid, ThreadIDGoroutine:
+		t.mode = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown thread ID mode %q, must be one of %s, %s, %s", value, ThreadIDPid, ThreadIDTid, ThreadIDGoroutine)
+	}
+}
+
+// threadID returns the corresponding value for buffer.HeaderOptions.
+func (t *threadIDMode) threadID() buffer.ThreadID {
+	switch t.mode {
+	case ThreadIDTid:
+		return buffer.ThreadIDOS
+	case ThreadIDGoroutine:
+		return buffer.ThreadIDGoroutine
+	default:
+		return buffer.ThreadIDPid
+	}
+}
+
+// HeaderOptions modify the header of the text format.
+type HeaderOptions struct {
+	// RFC3339 replaces "mmdd hh:mm:ss.uuuuuu" with a time stamp in RFC
+	// 3339 format, which includes the year and the time zone.
+	RFC3339 bool
+
+	// UTC converts the time stamp to UTC instead of local time.
+	UTC bool
+
+	// Precision determines the fractions of a second. The default is
+	// PrecisionMicroseconds.
+	Precision TimePrecision
+
+	// Path determines how the source file is shown. The default is
+	// HeaderPathBase.
+	Path HeaderPath
+
+	// ThreadID determines the content of the thread ID column. The
+	// default is ThreadIDPid.
+	ThreadID ThreadIDMode
+
+	// ThreadIDWidth is the minimum width of the thread ID column. Longer
+	// IDs are not truncated. The default is 7.
+	ThreadIDWidth int
+}
+
+// SetHeaderOptions changes the header of the text format. This is the
+// programmatic equivalent of the -klog_header_rfc3339, -klog_header_utc,
+// -klog_header_precision, -klog_header_path, -klog_header_thread_id and
+// -klog_header_thread_id_width flags.
+func SetHeaderOptions(opts HeaderOptions) {
+	if opts.Precision == "" {
+		opts.Precision = PrecisionMicroseconds
+	}
+	if opts.Path == "" {
+		opts.Path = HeaderPathBase
+	}
+	if opts.ThreadID == "" {
+		opts.ThreadID = ThreadIDPid
+	}
+	if opts.ThreadIDWidth == 0 {
+		opts.ThreadIDWidth = 7
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if err := logging.headerPrecision.Set(string(opts.Precision)); err != nil {
+		panic(fmt.Sprintf("SetHeaderOptions(%+v): %v", opts, err))
+	}
+	if err := logging.headerPath.Set(string(opts.Path)); err != nil {
+		panic(fmt.Sprintf("SetHeaderOptions(%+v): %v", opts, err))
+	}
+	if err := logging.headerThreadID.Set(string(opts.ThreadID)); err != nil {
+		panic(fmt.Sprintf("SetHeaderOptions(%+v): %v", opts, err))
+	}
+	if opts.ThreadIDWidth < 0 {
+		panic(fmt.Sprintf("SetHeaderOptions(%+v): thread ID width must not be negative", opts))
+	}
+	logging.headerThreadIDWidth = opts.ThreadIDWidth
+	logging.headerRFC3339 = opts.RFC3339
+	logging.headerUTC = opts.UTC
+}
+
+// headerOptions returns the options for formatting the header.
+func (l *loggingT) headerOptions() buffer.HeaderOptions {
+	return buffer.HeaderOptions{
+		RFC3339:       l.headerRFC3339,
+		UTC:           l.headerUTC,
+		Precision:     l.headerPrecision.digits(),
+		ThreadID:      l.headerThreadID.threadID(),
+		ThreadIDWidth: l.headerThreadIDWidth,
+	}
+}
+
+// sourcePathMode returns how the source file is shown in the header.
+func (l *loggingT) sourcePathMode() sourcepath.Mode {
+	switch {
+	case l.headerPath.path == HeaderPathModule:
+		return sourcepath.Module
+	case l.headerPath.path == HeaderPathDir || l.addDirHeader:
+		return sourcepath.Dir
+	default:
+		return sourcepath.Base
+	}
+}
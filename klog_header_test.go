@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+func TestHeaderOptions(t *testing.T) {
+	zone := time.FixedZone("CEST", 2*60*60)
+	for name, tc := range map[string]struct {
+		opts     HeaderOptions
+		expected string
+	}{
+		"default": {
+			expected: "I0102 15:04:05.067890    1234 klog_header_test.go:NNN] test\n",
+		},
+		"milliseconds": {
+			opts:     HeaderOptions{Precision: PrecisionMilliseconds},
+			expected: "I0102 15:04:05.067    1234 klog_header_test.go:NNN] test\n",
+		},
+		"nanoseconds": {
+			opts:     HeaderOptions{Precision: PrecisionNanoseconds},
+			expected: "I0102 15:04:05.067890123    1234 klog_header_test.go:NNN] test\n",
+		},
+		"utc": {
+			opts:     HeaderOptions{UTC: true},
+			expected: "I0102 13:04:05.067890    1234 klog_header_test.go:NNN] test\n",
+		},
+		"rfc3339": {
+			opts:     HeaderOptions{RFC3339: true},
+			expected: "I2006-01-02T15:04:05.067890+02:00    1234 klog_header_test.go:NNN] test\n",
+		},
+		"rfc3339-utc-ns": {
+			opts:     HeaderOptions{RFC3339: true, UTC: true, Precision: PrecisionNanoseconds},
+			expected: "I2006-01-02T13:04:05.067890123Z    1234 klog_header_test.go:NNN] test\n",
+		},
+		"dir": {
+			opts:     HeaderOptions{Path: HeaderPathDir},
+			expected: "I0102 15:04:05.067890    1234 DIR/klog_header_test.go:NNN] test\n",
+		},
+		"module": {
+			// The test is in the root of the module.
+			opts:     HeaderOptions{Path: HeaderPathModule},
+			expected: "I0102 15:04:05.067890    1234 klog_header_test.go:NNN] test\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer CaptureState().Restore()
+			setFlags()
+			defer logging.swap(logging.newBuffers())
+			defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+			timeNow = func() time.Time {
+				return time.Date(2006, 1, 2, 15, 4, 5, 67890123, zone)
+			}
+			defer func(previous int) { buffer.Pid = previous }(buffer.Pid)
+			buffer.Pid = 1234
+			SetHeaderOptions(tc.opts)
+
+			Info("test")
+			// The directory depends on where the repository was checked out.
+			actual := regexp.MustCompile(`:[0-9]+\]`).ReplaceAllString(contents(severity.InfoLog), ":NNN]")
+			actual = regexp.MustCompile(` [^ /]+/klog_header_test.go`).ReplaceAllString(actual, " DIR/klog_header_test.go")
+			if actual != tc.expected {
+				t.Errorf("unexpected output:\n%q\nexpected:\n%q", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHeaderThreadID(t *testing.T) {
+	for name, opts := range map[string]HeaderOptions{
+		"pid":       {ThreadIDWidth: 2},
+		"tid":       {ThreadID: ThreadIDTid},
+		"goroutine": {ThreadID: ThreadIDGoroutine, ThreadIDWidth: 12},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer CaptureState().Restore()
+			setFlags()
+			defer logging.swap(logging.newBuffers())
+			defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+			timeNow = func() time.Time {
+				return time.Date(2006, 1, 2, 15, 4, 5, 67890123, time.Local)
+			}
+			defer func(previous int) { buffer.Pid = previous }(buffer.Pid)
+			buffer.Pid = 1234
+			SetHeaderOptions(opts)
+
+			Info("test")
+			actual := contents(severity.InfoLog)
+			width := opts.ThreadIDWidth
+			if width == 0 {
+				width = 7
+			}
+			match := regexp.MustCompile(`^I0102 15:04:05.067890 ( *)([0-9]+) klog_header_test.go:[0-9]+\] test\n$`).FindStringSubmatch(actual)
+			if match == nil {
+				t.Fatalf("unexpected output:\n%q", actual)
+			}
+			if len(match[1])+len(match[2]) < width {
+				t.Errorf("thread ID column should be at least %d characters wide:\n%q", width, actual)
+			}
+			if opts.ThreadID == "" && match[2] != "1234" {
+				t.Errorf("expected pid 1234, got:\n%q", actual)
+			}
+		})
+	}
+}
+
+func TestSetHeaderOptionsInvalid(t *testing.T) {
+	defer CaptureState().Restore()
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid precision")
+		}
+	}()
+	SetHeaderOptions(HeaderOptions{Precision: "s"})
+}
@@ -18,9 +18,12 @@ package plog
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	stdLog "log"
 	"os"
@@ -38,6 +41,7 @@ import (
 
 	"github.com/pohly/plog/v2/internal/buffer"
 	testingclock "github.com/pohly/plog/v2/internal/clock/testing"
+	"github.com/pohly/plog/v2/internal/rotation"
 	"github.com/pohly/plog/v2/internal/severity"
 	"github.com/pohly/plog/v2/internal/test"
 	"github.com/pohly/plog/v2/internal/test/require"
@@ -214,6 +218,124 @@ func TestHeader(t *testing.T) {
 	}
 }
 
+func TestJSONFormat(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+	SetLoggingFormat(LoggingFormatJSON)
+	require.NoError(t, logging.verbosity.Set("2"))
+
+	InfoS("hello", "a", 1, "s", "x\ny")
+	V(2).InfoS("verbose", "missing")
+	ErrorS(errors.New("fail"), "oops", "obj", KRef("ns", "name"))
+	Infof("multi\nline \x1b")
+	NewKlogr().WithName("foo").Info("named")
+
+	callerRe := regexp.MustCompile(`"caller":"klog_test.go:[0-9]+"`)
+	actual := callerRe.ReplaceAllString(contents(severity.InfoLog), `"caller":"klog_test.go:NNN"`)
+	expected := `{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":0,"caller":"klog_test.go:NNN","msg":"hello","a":1,"s":"x\ny"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":2,"caller":"klog_test.go:NNN","msg":"verbose","missing":"(MISSING)"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"ERROR","caller":"klog_test.go:NNN","msg":"oops","err":"fail","obj":"ns/name"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","caller":"klog_test.go:NNN","msg":"multi\nline \u001b"}
+{"ts":"2006-01-02T15:04:05.067890Z","severity":"INFO","v":0,"caller":"klog_test.go:NNN","msg":"named","logger":"foo"}
+`
+	if actual != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", actual, expected)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(actual), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("invalid JSON %q: %v", line, err)
+		}
+	}
+}
+
+func TestJSONFormatControlCharacters(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	SetLoggingFormat(LoggingFormatJSON)
+
+	InfoS("esc\x1b[31m", "str", "a\x00b", "key\x7f\x01", 1, "invalid", "\xff\xfe")
+	InfoS("stringer", "obj", KRef("ns\x1b", "name\x00"))
+	ErrorS(errors.New("err\x1b[0m\xff"), "error", "wrapped", fmt.Errorf("x\x02: %w", errors.New("y")))
+
+	lines := strings.Split(strings.TrimSpace(contents(severity.InfoLog)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got:\n%s", contents(severity.InfoLog))
+	}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("invalid JSON %q: %v", line, err)
+		}
+	}
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+	SetLoggingFormat(LoggingFormatLogfmt)
+
+	InfoS("hello world", "a", 1, "s", "x y")
+	ErrorS(errors.New("fail"), "oops", "obj", KRef("ns", "name"))
+	Infof("multi\nline")
+	NewKlogr().WithName("foo").Info("named")
+
+	callerRe := regexp.MustCompile(`caller=klog_test.go:[0-9]+`)
+	actual := callerRe.ReplaceAllString(contents(severity.InfoLog), `caller=klog_test.go:NNN`)
+	expected := `ts=2006-01-02T15:04:05.067890Z level=info v=0 caller=klog_test.go:NNN msg="hello world" a=1 s="x y"
+ts=2006-01-02T15:04:05.067890Z level=error caller=klog_test.go:NNN msg=oops err=fail obj=ns/name
+ts=2006-01-02T15:04:05.067890Z level=info caller=klog_test.go:NNN msg="multi\nline"
+ts=2006-01-02T15:04:05.067890Z level=info v=0 caller=klog_test.go:NNN msg=named logger=foo
+`
+	if actual != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestColors(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.toStderr = true
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+	defer func(previous int) { buffer.Pid = previous }(buffer.Pid)
+	buffer.Pid = 1234
+	stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+	require.NoError(t, err)
+	defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+	os.Stderr = stderr
+	SetColorMode(ColorAlways)
+
+	ErrorS(errors.New("fail"), "oops", "a", 1)
+	NewKlogr().WithName("foo").Info("named")
+	SetColorMode(ColorNever)
+	InfoS("plain", "a", 1)
+
+	data, err := os.ReadFile(stderr.Name())
+	require.NoError(t, err)
+	lineRe := regexp.MustCompile(`klog_test.go:[0-9]+`)
+	actual := lineRe.ReplaceAllString(string(data), `klog_test.go:NNN`)
+	expected := "\x1b[31mE\x1b[0m0102 15:04:05.067890    1234 klog_test.go:NNN] \"oops\" \x1b[31merr\x1b[0m=\x1b[31m\"fail\"\x1b[0m \x1b[36ma\x1b[0m=1\n" +
+		"\x1b[32mI\x1b[0m0102 15:04:05.067890    1234 klog_test.go:NNN] \"named\" \x1b[36mlogger\x1b[0m=\x1b[2m\"foo\"\x1b[0m\n" +
+		"I0102 15:04:05.067890    1234 klog_test.go:NNN] \"plain\" a=1\n"
+	if actual != expected {
+		t.Errorf("unexpected output:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
 func TestHeaderWithDir(t *testing.T) {
 	defer CaptureState().Restore()
 	setFlags()
@@ -375,6 +497,35 @@ func TestVmoduleOff(t *testing.T) {
 	}
 }
 
+// flushCounter counts calls of Flush and Sync.
+type flushCounter struct {
+	bytes.Buffer
+	flushed, synced int
+}
+
+func (f *flushCounter) Flush() error {
+	f.flushed++
+	return nil
+}
+
+func (f *flushCounter) Sync() error {
+	f.synced++
+	return nil
+}
+
+func TestSetOutputFlush(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	var w flushCounter
+	SetOutput(&w)
+	Info("test")
+	Flush()
+	if w.flushed != 1 || w.synced != 1 {
+		t.Errorf("expected one Flush and Sync call, got %d and %d", w.flushed, w.synced)
+	}
+}
+
 func TestSetOutputDataRace(*testing.T) {
 	defer CaptureState().Restore()
 	setFlags()
@@ -512,6 +663,853 @@ func TestRollover(t *testing.T) {
 	}
 }
 
+func TestRotationInterval(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 59, 58, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	require.NoError(t, logging.rotationInterval.Set("hourly"))
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[severity.InfoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	if err != nil {
+		t.Fatalf("info has initial error: %v", err)
+	}
+	fname0 := info.file.Name()
+
+	now = now.Add(time.Second)
+	Info("x") // Still before the boundary.
+	if fname := info.file.Name(); fname != fname0 {
+		t.Errorf("file rotated before the boundary: %s", fname)
+	}
+
+	now = now.Add(time.Second)
+	Info("x") // Exactly at the boundary.
+	if err != nil {
+		t.Fatalf("error after rotation: %v", err)
+	}
+	if fname := info.file.Name(); fname == fname0 {
+		t.Errorf("info.f.Name did not change: %v", fname0)
+	}
+	if expected := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local); !info.nextRotation.Equal(expected) {
+		t.Errorf("expected next rotation at %s, got %s", expected, info.nextRotation)
+	}
+
+	SetRotationInterval(0)
+	if !info.nextRotation.IsZero() {
+		t.Errorf("time-based rotation not disabled, next rotation at %s", info.nextRotation)
+	}
+}
+
+func TestRotationIntervalLogFileWithoutBackups(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 59, 58, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	logging.logFile = filepath.Join(t.TempDir(), "test.log")
+	logging.logFileMaxBackups = 0
+	require.NoError(t, logging.rotationInterval.Set("hourly"))
+
+	Info("before")
+	info, ok := logging.file[severity.InfoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	if !info.nextRotation.IsZero() {
+		t.Errorf("time-based rotation enabled for -log_file without backups, next rotation at %s", info.nextRotation)
+	}
+
+	now = now.Add(time.Hour)
+	Info("after")
+	Flush()
+	content, err := os.ReadFile(logging.logFile)
+	require.NoError(t, err)
+	if !strings.Contains(string(content), "before") || !strings.Contains(string(content), "after") {
+		t.Errorf("log file got truncated:\n%s", content)
+	}
+}
+
+func TestNextRotation(t *testing.T) {
+	now := time.Date(2024, 3, 10, 10, 20, 30, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		interval time.Duration
+		expected time.Time
+	}{
+		"disabled": {},
+		"hourly": {
+			interval: RotateHourly,
+			expected: time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC),
+		},
+		"daily": {
+			interval: RotateDaily,
+			expected: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		"15m": {
+			interval: 15 * time.Minute,
+			expected: time.Date(2024, 3, 10, 10, 30, 0, 0, time.UTC),
+		},
+		"odd interval capped at midnight": {
+			interval: 7 * time.Hour,
+			expected: time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC),
+		},
+		"weekly": {
+			interval: 7 * RotateDaily,
+			expected: time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual := rotation.Next(now, tc.interval)
+			if !actual.Equal(tc.expected) {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+
+	late := time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC)
+	if actual, expected := rotation.Next(late, 7*time.Hour), time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC); !actual.Equal(expected) {
+		t.Errorf("expected rotation at midnight %s, got %s", expected, actual)
+	}
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	for name, tc := range map[string]struct {
+		policy   RetentionPolicy
+		expected []int // indices of the old files which are kept, newest first
+	}{
+		"unlimited": {
+			expected: []int{0, 1, 2, 3},
+		},
+		"max files": {
+			policy:   RetentionPolicy{MaxFiles: 3},
+			expected: []int{0, 1},
+		},
+		"max size": {
+			policy:   RetentionPolicy{MaxTotalSizeMB: 2},
+			expected: []int{0, 1},
+		},
+		"max age": {
+			policy:   RetentionPolicy{MaxAge: 150 * time.Minute},
+			expected: []int{0, 1},
+		},
+		"combined": {
+			policy:   RetentionPolicy{MaxFiles: 10, MaxAge: 90 * time.Minute},
+			expected: []int{0},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile := func(name string, size int, modTime time.Time) {
+				path := filepath.Join(dir, name)
+				require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0666))
+				require.NoError(t, os.Chtimes(path, modTime, modTime))
+			}
+
+			current, _ := logName("INFO", now, 0)
+			writeFile(current, 1024*1024, now)
+			var old []string
+			for i := 0; i < 4; i++ {
+				modTime := now.Add(-time.Duration(i+1) * time.Hour)
+				name, _ := logName("INFO", modTime, 0)
+				writeFile(name, 512*1024, modTime)
+				old = append(old, name)
+			}
+			// None of these may be touched.
+			warning, _ := logName("WARNING", now.Add(-time.Hour), 0)
+			foreign := []string{
+				warning,
+				"other." + current[len(program)+1:],
+				// A program which shares the prefix.
+				program + ".worker" + current[len(program):],
+				current + ".txt",
+				"README",
+			}
+			for _, name := range foreign {
+				writeFile(name, 1024*1024, now.Add(-100*time.Hour))
+			}
+
+			pruneLogFiles(dir, "INFO", current, tc.policy, now)
+
+			kept := map[string]bool{current: true}
+			for _, name := range foreign {
+				kept[name] = true
+			}
+			for _, i := range tc.expected {
+				kept[old[i]] = true
+			}
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			actual := map[string]bool{}
+			for _, entry := range entries {
+				actual[entry.Name()] = true
+			}
+			if !reflect.DeepEqual(kept, actual) {
+				t.Errorf("expected files:\n%v\ngot:\n%v", kept, actual)
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyCompression(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	dir := t.TempDir()
+	var names []string
+	for i := 0; i < 4; i++ {
+		modTime := now.Add(-time.Duration(i) * time.Hour)
+		name, _ := logName("INFO", modTime, 0)
+		names = append(names, name)
+	}
+	current, compressing, leftover, old := names[0], names[1], names[2], names[3]
+	for _, name := range []string{current, compressing, compressing + ".gz.tmp", leftover + ".gz.tmp", old} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("x"), 0666))
+	}
+	fileCompressor.mu.Lock()
+	fileCompressor.active = map[string]bool{filepath.Join(dir, compressing): true}
+	fileCompressor.mu.Unlock()
+	defer func() {
+		fileCompressor.mu.Lock()
+		fileCompressor.active = nil
+		fileCompressor.mu.Unlock()
+	}()
+
+	pruneLogFiles(dir, "INFO", current, RetentionPolicy{MaxFiles: 1}, now)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	actual := map[string]bool{}
+	for _, entry := range entries {
+		actual[entry.Name()] = true
+	}
+	expected := map[string]bool{current: true, compressing: true, compressing + ".gz.tmp": true}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected files:\n%v\ngot:\n%v", expected, actual)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{t.TempDir()}
+
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	SetRotationInterval(RotateHourly)
+	SetCompression(CompressionGzip)
+
+	Info("first file")
+	info, ok := logging.file[severity.InfoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	fname0 := info.file.Name()
+	now = now.Add(time.Hour)
+	Info("second file")
+	if err != nil {
+		t.Fatalf("error after rotation: %v", err)
+	}
+	Flush()
+
+	if _, err := os.Stat(fname0); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed after compression, got: %v", fname0, err)
+	}
+	f, err := os.Open(fname0 + ".gz")
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	content, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	if !strings.Contains(string(content), "first file") {
+		t.Errorf("compressed file does not contain the first log entry:\n%s", content)
+	}
+	if !isLogName(filepath.Base(fname0)+".gz", "INFO") {
+		t.Errorf("compressed file %s not recognized as log file", fname0+".gz")
+	}
+}
+
+func TestLogFileBackups(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	logging.logFile = filepath.Join(t.TempDir(), "app.log")
+	logging.logFileMaxBackups = 2
+	SetRotationInterval(RotateHourly)
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+
+	for i := 0; i < 4; i++ {
+		Infof("entry #%d", i)
+		now = now.Add(time.Hour)
+	}
+	Flush()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, expected := range map[string]string{
+		logging.logFile:        "entry #3",
+		logging.logFile + ".1": "entry #2",
+		logging.logFile + ".2": "entry #1",
+	} {
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("%s: expected %q, got:\n%s", name, expected, content)
+		}
+	}
+	if _, err := os.Stat(logging.logFile + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more backups than expected: %v", err)
+	}
+}
+
+func TestWriteErrorPolicy(t *testing.T) {
+	for _, policy := range []WriteErrorPolicy{WriteErrorExit, WriteErrorStderr, WriteErrorDrop} {
+		t.Run(string(policy), func(t *testing.T) {
+			defer CaptureState().Restore()
+			setFlags()
+			var exitErr error
+			defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+			logExitFunc = func(e error) {
+				exitErr = e
+			}
+			defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+			now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.Local)
+			timeNow = func() time.Time { return now }
+			defer func() { logging.createRetryAt = time.Time{} }()
+			var handlerErrs []error
+			SetWriteErrorHandler(func(err error) {
+				handlerErrs = append(handlerErrs, err)
+			})
+			SetWriteErrorPolicy(policy)
+			logging.fileRetryInterval = time.Minute
+
+			dir := filepath.Join(t.TempDir(), "missing")
+			logging.logFile = filepath.Join(dir, "app.log")
+			// Erase files created by prior tests.
+			for i := range logging.file {
+				logging.file[i] = nil
+			}
+			failedLines := Stats.Failed.Lines()
+
+			Info("lost #1")
+			if len(handlerErrs) != 1 {
+				t.Fatalf("expected one error for the handler, got: %v", handlerErrs)
+			}
+			if policy == WriteErrorExit {
+				if exitErr == nil {
+					t.Fatal("expected exit")
+				}
+				return
+			}
+			if exitErr != nil {
+				t.Fatalf("unexpected exit: %v", exitErr)
+			}
+
+			// No new attempt before the retry interval has passed.
+			now = now.Add(30 * time.Second)
+			Info("lost #2")
+			if len(handlerErrs) != 1 {
+				t.Errorf("expected no further error for the handler, got: %v", handlerErrs)
+			}
+			if actual := Stats.Failed.Lines() - failedLines; actual != 2 {
+				t.Errorf("expected 2 failed lines, got %d", actual)
+			}
+
+			require.NoError(t, os.Mkdir(dir, 0755))
+			now = now.Add(30 * time.Second)
+			Info("written")
+			Flush()
+			if len(handlerErrs) != 1 {
+				t.Errorf("expected no further error for the handler, got: %v", handlerErrs)
+			}
+			content, err := os.ReadFile(logging.logFile)
+			require.NoError(t, err)
+			if !strings.Contains(string(content), "written") || strings.Contains(string(content), "lost") {
+				t.Errorf("unexpected log file content:\n%s", content)
+			}
+		})
+	}
+}
+
+// blockingWriter blocks the first write until released.
+type blockingWriter struct {
+	bytes.Buffer
+	started, release chan struct{}
+	once             sync.Once
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.started)
+		<-w.release
+	})
+	return w.Buffer.Write(data)
+}
+
+func TestAsyncOutput(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetAsyncOutput(0, OverflowBlock)
+	SetAsyncOutput(1, OverflowBlock)
+
+	for i := 0; i < 100; i++ {
+		Infof("entry #%d", i)
+	}
+	Flush()
+	lines := strings.Split(strings.TrimSpace(contents(severity.InfoLog)), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("expected 100 lines, got %d:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, fmt.Sprintf("] entry #%d", i)) {
+			t.Errorf("line #%d: unexpected content %q", i, line)
+		}
+	}
+}
+
+func TestAsyncOutputSlowWriter(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.toStderr = false
+	defer SetAsyncOutput(0, OverflowBlock)
+	SetAsyncOutput(10, OverflowBlock)
+	w := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+	SetOutput(w)
+
+	Info("first")
+	<-w.started
+	// Logging must not wait for the blocked writer.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Info("second")
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("logging blocked by the writer")
+	}
+	close(w.release)
+	Flush()
+	if actual := w.String(); !strings.Contains(actual, "] second") {
+		t.Errorf("unexpected output:\n%s", actual)
+	}
+}
+
+// slowWriter delays each write.
+type slowWriter struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (w *slowWriter) Write(data []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Buffer.Write(data)
+}
+
+func TestAsyncDrainWhileLogging(t *testing.T) {
+	w := &slowWriter{}
+	l := &loggingT{}
+	for s := range l.file {
+		l.file[s] = &redirectBuffer{w: w}
+	}
+	q := newAsyncQueue(l)
+	put := func(msg string) {
+		buf := buffer.GetBuffer()
+		buf.WriteString(msg + ",")
+		q.put(asyncEntry{s: severity.InfoLog, buf: buf}, 10, OverflowBlock)
+	}
+
+	// The queue never becomes empty while this runs.
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				put("other")
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+		q.drain()
+	}()
+
+	put("before drain")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.drain()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("drain did not return")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if actual := w.String(); !strings.Contains(actual, "before drain,") {
+		t.Errorf("entry not written before drain returned:\n%s", actual)
+	}
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	for policy, expected := range map[OverflowPolicy]string{
+		OverflowBlock:      "entry #0,entry #1,entry #2",
+		OverflowDropNewest: "entry #0,entry #1",
+		OverflowDropOldest: "entry #0,entry #2",
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			w := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+			l := &loggingT{}
+			for s := range l.file {
+				l.file[s] = &redirectBuffer{w: w}
+			}
+			q := newAsyncQueue(l)
+			put := func(msg string) {
+				buf := buffer.GetBuffer()
+				buf.WriteString(msg + ",")
+				q.put(asyncEntry{s: severity.InfoLog, buf: buf}, 1, policy)
+			}
+			dropped := Stats.Dropped.Lines()
+
+			// The first entry blocks the background goroutine, the
+			// second one fills the queue.
+			put("entry #0")
+			<-w.started
+			put("entry #1")
+			if policy == OverflowBlock {
+				// Has to wait until the background goroutine
+				// continues.
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					close(w.release)
+				}()
+			}
+			put("entry #2")
+			if policy != OverflowBlock {
+				close(w.release)
+			}
+			q.drain()
+
+			if actual := strings.TrimSuffix(w.String(), ","); actual != expected {
+				t.Errorf("expected output %q, got %q", expected, actual)
+			}
+			if actual, expected := Stats.Dropped.Lines()-dropped, int64(3-len(strings.Split(expected, ","))); actual != expected {
+				t.Errorf("expected %d dropped lines, got %d", expected, actual)
+			}
+		})
+	}
+}
+
+func TestLogNameTemplate(t *testing.T) {
+	defer CaptureState().Restore()
+	now := time.Date(2024, 3, 10, 10, 20, 30, 0, time.Local)
+
+	name, link := logName("INFO", now, 0)
+	expected := fmt.Sprintf("%s.%s.%s.log.INFO.20240310-102030.%d", program, host, getUserName(), pid)
+	if name != expected {
+		t.Errorf("expected default name %q, got %q", expected, name)
+	}
+	if link != program+".INFO" {
+		t.Errorf("expected default link %q, got %q", program+".INFO", link)
+	}
+	if !isLogName(name, "INFO") || !isLogName(name+".gz", "INFO") {
+		t.Errorf("%q not recognized as log file", name)
+	}
+	if isLogName(name, "ERROR") || isLogName("x"+name, "INFO") {
+		t.Errorf("%q recognized as wrong log file", name)
+	}
+	if other := program + ".worker" + name[len(program):]; isLogName(other, "INFO") {
+		t.Errorf("%q of another program recognized as log file", other)
+	}
+	if other := fmt.Sprintf("%s.otherhost.otheruser.log.INFO.20240310-102030.%d", program, pid); !isLogName(other, "INFO") {
+		t.Errorf("%q from another host and user not recognized as log file", other)
+	}
+
+	require.NoError(t, logging.logNameTemplate.Set("{severity}-{program}-{seq}.txt"))
+	require.NoError(t, logging.linkNameTemplate.Set(""))
+	name, link = logName("WARNING", now, 42)
+	if expected := "WARNING-" + program + "-42.txt"; name != expected {
+		t.Errorf("expected name %q, got %q", expected, name)
+	}
+	if link != "" {
+		t.Errorf("expected no link, got %q", link)
+	}
+
+	for _, template := range []string{
+		"",
+		"{program}.log",
+		"{program}.{severity}.{unknown}",
+		"logs/{program}.{severity}",
+		"{program}.{severity}.{pid}",
+	} {
+		if err := logging.logNameTemplate.Set(template); err == nil {
+			t.Errorf("expected error for template %q", template)
+		}
+	}
+
+	// The same template for log files and symlinks is rejected, in both
+	// orders.
+	require.NoError(t, logging.linkNameTemplate.Set("{program}.{severity}.{seq}"))
+	if err := logging.logNameTemplate.Set("{program}.{severity}.{seq}"); err == nil {
+		t.Error("expected error for log file template equal to link template")
+	}
+	require.NoError(t, logging.linkNameTemplate.Set(""))
+	require.NoError(t, logging.logNameTemplate.Set("{program}.{severity}.{seq}"))
+	if err := logging.linkNameTemplate.Set("{program}.{severity}.{seq}"); err == nil {
+		t.Error("expected error for link template equal to log file template")
+	}
+	// Without a timestamp or sequence number, the link template is okay.
+	require.NoError(t, logging.linkNameTemplate.Set("{program}.{severity}"))
+}
+
+func TestLogNameTemplateSeq(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	dir := t.TempDir()
+	logDirs = []string{dir}
+
+	require.NoError(t, logging.logNameTemplate.Set("{program}.{severity}.{seq}.log"))
+	require.NoError(t, logging.linkNameTemplate.Set("{program}.{severity}.log"))
+	SetRotationInterval(RotateHourly)
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+
+	Info("first")
+	now = now.Add(time.Hour)
+	Info("second")
+	Flush()
+	// Reopening appends to the latest file.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	Info("third")
+	Flush()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, expected := range map[string][]string{
+		program + ".INFO.1.log": {"first"},
+		program + ".INFO.2.log": {"second", "third"},
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		for _, e := range expected {
+			if !strings.Contains(string(content), e) {
+				t.Errorf("%s: expected %q, got:\n%s", name, e, content)
+			}
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if target, err := os.Readlink(filepath.Join(dir, program+".INFO.log")); err != nil || target != program+".INFO.2.log" {
+			t.Errorf("expected symlink to current file, got %q, %v", target, err)
+		}
+	}
+}
+
+func TestReopenFiles(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	logging.logFile = filepath.Join(t.TempDir(), "app.log")
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+
+	Info("before rotation")
+	Flush()
+	rotated := logging.logFile + ".rotated"
+	require.NoError(t, os.Rename(logging.logFile, rotated))
+	Info("still in old file")
+	require.NoError(t, ReopenFiles())
+	Info("after rotation")
+	Flush()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(rotated)
+	require.NoError(t, err)
+	if !strings.Contains(string(content), "before rotation") || !strings.Contains(string(content), "still in old file") {
+		t.Errorf("unexpected content of rotated file:\n%s", content)
+	}
+	content, err = os.ReadFile(logging.logFile)
+	require.NoError(t, err)
+	if !strings.HasPrefix(string(content), "Log file created at:") {
+		t.Errorf("missing header in new file:\n%s", content)
+	}
+	if !strings.Contains(string(content), "after rotation") || strings.Contains(string(content), "before rotation") {
+		t.Errorf("unexpected content of new file:\n%s", content)
+	}
+}
+
+func TestReopenFilesOnce(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	logging.logFile = filepath.Join(t.TempDir(), "app.log")
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+	Info("info")
+	Error("error")
+	Flush()
+
+	defer func(previous func(string, int, os.FileMode) (*os.File, error)) { openFile = previous }(openFile)
+	opened := 0
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		opened++
+		return os.OpenFile(name, flag, perm)
+	}
+	require.NoError(t, ReopenFiles())
+	if opened != 1 {
+		t.Errorf("expected the log file to be reopened once, got %d", opened)
+	}
+}
+
+func TestDetectTruncation(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	logging.logFile = filepath.Join(t.TempDir(), "app.log")
+	logging.detectTruncation = true
+	// Erase files created by prior tests.
+	for i := range logging.file {
+		logging.file[i] = nil
+	}
+
+	Info("before truncation")
+	Flush()
+	require.NoError(t, os.Truncate(logging.logFile, 0))
+	Flush()
+	info := logging.file[severity.InfoLog].(*syncBuffer)
+	if info.nbytes != 0 {
+		t.Errorf("expected file size to be reset, got %d", info.nbytes)
+	}
+	Info("after truncation")
+	Flush()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := os.ReadFile(logging.logFile)
+	require.NoError(t, err)
+	if bytes.IndexByte(content, 0) >= 0 {
+		t.Errorf("file has a hole:\n%q", content)
+	}
+	if !strings.Contains(string(content), "after truncation") {
+		t.Errorf("unexpected file content:\n%s", content)
+	}
+
+	// A file created by rotation, with pending output in the buffer
+	// while the file gets truncated.
+	logging.mu.Lock()
+	require.NoError(t, info.rotateFile(timeNow(), false))
+	logging.mu.Unlock()
+	Info("after rotation")
+	Flush()
+	Info("buffered during truncation")
+	require.NoError(t, os.Truncate(logging.logFile, 0))
+	Flush()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err = os.ReadFile(logging.logFile)
+	require.NoError(t, err)
+	if bytes.IndexByte(content, 0) >= 0 {
+		t.Errorf("rotated file has a hole:\n%q", content)
+	}
+	if !strings.Contains(string(content), "buffered during truncation") {
+		t.Errorf("unexpected rotated file content:\n%s", content)
+	}
+	if info.nbytes != uint64(len(content)) {
+		t.Errorf("expected file size %d, got %d", len(content), info.nbytes)
+	}
+}
+
+func TestCompressFileError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing")
+	if err := compressFile(CompressionGzip, path); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if _, err := os.Stat(path + ".gz.tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file not removed: %v", err)
+	}
+}
+
 func TestOpenAppendOnStart(t *testing.T) {
 	const (
 		x string = "xxxxxxxxxx"
@@ -619,6 +1617,70 @@ func TestLogBacktraceAt(t *testing.T) {
 	}
 }
 
+func TestStacksInFormats(t *testing.T) {
+	for _, format := range []LoggingFormat{LoggingFormatJSON, LoggingFormatLogfmt} {
+		t.Run(string(format), func(t *testing.T) {
+			defer CaptureState().Restore()
+			setFlags()
+			defer logging.swap(logging.newBuffers())
+			SetLoggingFormat(format)
+			defer func(previous func(int)) { OsExit = previous }(OsExit)
+			var exitCode int
+			OsExit = func(code int) { exitCode = code }
+			defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+			stderr, err := os.CreateTemp(t.TempDir(), "stderr")
+			require.NoError(t, err)
+			defer func(previous *os.File) { os.Stderr = previous }(os.Stderr)
+			os.Stderr = stderr
+
+			// Each entry must be a single line with the stack trace in a field.
+			checkEntries := func(what, output string) {
+				t.Helper()
+				lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+				for _, line := range lines {
+					var trace string
+					if format == LoggingFormatJSON {
+						var entry map[string]interface{}
+						if err := json.Unmarshal([]byte(line), &entry); err != nil {
+							t.Errorf("%s: invalid JSON %q: %v", what, line, err)
+						}
+						trace, _ = entry["stacktrace"].(string)
+					} else if !strings.HasPrefix(line, "ts=") {
+						t.Errorf("%s: not a logfmt entry: %q", what, line)
+					} else if i := strings.Index(line, " stacktrace="); i >= 0 {
+						trace, err = strconv.Unquote(line[i+len(" stacktrace="):])
+						if err != nil {
+							t.Errorf("%s: invalid stacktrace field in %q: %v", what, line, err)
+						}
+					}
+					if trace != "" && !strings.Contains(trace, "goroutine ") {
+						t.Errorf("%s: unexpected stack trace %q", what, trace)
+					}
+				}
+				if !strings.Contains(output, "stacktrace") {
+					t.Errorf("%s: no stack trace in output:\n%s", what, output)
+				}
+			}
+
+			_, file, line, _ := runtime.Caller(0)
+			require.NoError(t, logging.traceLocation.Set(fmt.Sprintf("%s:%d", filepath.Base(file), line+2)))
+			Info("we want a stack trace here")
+			checkEntries("backtrace", contents(severity.InfoLog))
+
+			require.NoError(t, logging.traceLocation.Set(""))
+			logging.swap(logging.newBuffers())
+			Fatal("fatal")
+			if exitCode != 255 {
+				t.Errorf("expected exit code 255, got %d", exitCode)
+			}
+			checkEntries("fatal log", contents(severity.FatalLog))
+			output, err := os.ReadFile(stderr.Name())
+			require.NoError(t, err)
+			checkEntries("stderr", string(output))
+		})
+	}
+}
+
 func BenchmarkHeader(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		buf, _, _ := logging.header(severity.InfoLog, 0)
@@ -895,6 +1957,46 @@ func TestCommandLine(t *testing.T) {
     	If true, adds the file directory to the header of the log messages
   -alsologtostderr
     	log to standard error as well as files (no effect when -logtostderr=true)
+  -klog_async_overflow value
+    	Determines what happens when the queue for asynchronous output is full: block (wait for space), drop_newest or drop_oldest (no effect when -klog_async_queue_size=0) (default block)
+  -klog_async_queue_size int
+    	If positive, log output is written to stderr and log files by a background goroutine, with up to this many log entries waiting in a queue. Flush and Fatal write all pending entries (no effect when a logger was set with SetLogger).
+  -klog_color value
+    	Determines whether log entries which are only written to stderr get colored when using the text format: never, auto (if stderr is a terminal and NO_COLOR is empty) or always (default never)
+  -klog_compression value
+    	If non-empty, rotated log files are compressed in the background. The only supported format is gzip (no effect when -logtostderr=true or -log_file is set).
+  -klog_detect_truncation
+    	If true, detect when a log file gets truncated by an external tool like logrotate with copytruncate and continue writing at the new end of the file (no effect when -logtostderr=true)
+  -klog_file_retry_interval duration
+    	Defines how long to wait before trying again to create or write a log file after an error (no effect when -klog_write_error_policy=exit) (default 10s)
+  -klog_header_path value
+    	Determines how the source file is shown in the header: base (file name), dir (file name and directory, the same as -add_dir_header) or module (path relative to the root of the Go module) (default base)
+  -klog_header_precision value
+    	Determines the fractions of a second in the header: ms, us or ns (default us)
+  -klog_header_rfc3339
+    	If true, the header contains the time stamp in RFC 3339 format, with year and time zone
+  -klog_header_thread_id value
+    	Determines the content of the thread ID column in the header: pid (process ID), tid (operating system thread ID, only on Linux) or goroutine (goroutine ID) (default pid)
+  -klog_header_thread_id_width int
+    	Minimum width of the thread ID column in the header, longer IDs are not truncated (default 7)
+  -klog_header_utc
+    	If true, the time stamp in the header is in UTC instead of local time
+  -klog_log_file_link_template value
+    	Defines the names of the symlinks to the current log files in the log directory, using the same placeholders as -klog_log_file_name_template. If empty, no symlinks are created (no effect when -logtostderr=true or -log_file is set). (default {program}.{severity})
+  -klog_log_file_max_backups int
+    	Defines how many numbered backups (<log_file>.1, <log_file>.2, ...) are kept when the log file set with -log_file gets rotated (no effect when -logtostderr=true). If the value is 0, the log file is truncated instead.
+  -klog_log_file_name_template value
+    	Defines the names of log files in the log directory. Supported placeholders are {program}, {host}, {user}, {severity}, {timestamp}, {pid} and {seq}, {severity} and one of {timestamp} or {seq} are required (no effect when -logtostderr=true or -log_file is set). (default {program}.{host}.{user}.log.{severity}.{timestamp}.{pid})
+  -klog_retention_max_age duration
+    	Defines how long old log files are kept in the log directory (no effect when -logtostderr=true or -log_file is set). If the value is 0, the age is unlimited.
+  -klog_retention_max_files int
+    	Defines how many log files per severity are kept in the log directory, including the current one (no effect when -logtostderr=true or -log_file is set). If the value is 0, the number of files is unlimited.
+  -klog_retention_max_size uint
+    	Defines the maximum total size of all log files per severity in the log directory (no effect when -logtostderr=true or -log_file is set). Unit is megabytes. If the value is 0, the total size is unlimited.
+  -klog_rotation_interval value
+    	If non-empty, log files are also rotated when the wall clock crosses an interval boundary: hourly, daily, or a duration like 30m. Boundaries are aligned to local midnight (no effect when -logtostderr=true, or when -log_file is set and -klog_log_file_max_backups=0).
+  -klog_write_error_policy value
+    	Determines what happens when a log file cannot be created or written: exit, stderr (write to standard error instead) or drop (no effect when -logtostderr=true) (default exit)
   -log_backtrace_at value
     	when logging hits line file:N, emit a stack trace
   -log_dir string
@@ -903,6 +2005,8 @@ func TestCommandLine(t *testing.T) {
     	If non-empty, use this log file (no effect when -logtostderr=true)
   -log_file_max_size uint
     	Defines the maximum size a log file can grow to (no effect when -logtostderr=true). Unit is megabytes. If the value is 0, the maximum file size is unlimited. (default 1800)
+  -logging_format value
+    	Sets the format of log entries: text (the klog text format), json (one JSON object per line), logfmt (key=value pairs) or binary (compact encoding for log files, see the binlog package) (no effect when a logger was set with SetLogger) (default text)
   -logtostderr
     	log to standard error instead of files (default true)
   -one_output
@@ -915,8 +2019,10 @@ func TestCommandLine(t *testing.T) {
     	logs at or above this threshold go to stderr when writing to files and stderr (no effect when -logtostderr=true or -alsologtostderr=true) (default 2)
   -v value
     	number for the log level verbosity
+  -vlogger value
+    	comma-separated list of name=N settings for logger-filtered logging: a name matches loggers created with WithName, with nested names separated by dots, and the loggers derived from them; elements may use glob patterns
   -vmodule value
-    	comma-separated list of pattern=N settings for file-filtered logging
+    	comma-separated list of pattern=N settings for file-filtered logging (patterns match file names, package paths or directories with an optional /... suffix, or func:<function name>)
 `
 
 	var output bytes.Buffer
@@ -1063,6 +2169,7 @@ func TestInfoS(t *testing.T) {
 	defer CaptureState().Restore()
 	setFlags()
 	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
 	timeNow = func() time.Time {
 		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
 	}
@@ -1120,6 +2227,7 @@ func TestVInfoS(t *testing.T) {
 	defer CaptureState().Restore()
 	setFlags()
 	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
 	timeNow = func() time.Time {
 		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
 	}
@@ -1201,6 +2309,7 @@ func TestErrorS(t *testing.T) {
 	defer CaptureState().Restore()
 	setFlags()
 	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
 	timeNow = func() time.Time {
 		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
 	}
@@ -1906,12 +3015,14 @@ var existedFlag = map[string]struct{}{
 	"log_backtrace_at":  {},
 	"log_file":          {},
 	"log_file_max_size": {},
+	"logging_format":    {},
 	"logtostderr":       {},
 	"one_output":        {},
 	"skip_headers":      {},
 	"skip_log_headers":  {},
 	"stderrthreshold":   {},
 	"v":                 {},
+	"vlogger":           {},
 	"vmodule":           {},
 }
 
@@ -2126,6 +3237,7 @@ func TestCaptureState(t *testing.T) {
 		// All of these are non-standard values.
 		"v":                 "10",
 		"vmodule":           "abc=2",
+		"vlogger":           "abc=3",
 		"log_dir":           "/tmp",
 		"log_file_max_size": "10",
 		"logtostderr":       "false",
@@ -2136,6 +3248,32 @@ func TestCaptureState(t *testing.T) {
 		"skip_log_headers":  "true",
 		"stderrthreshold":   "1",
 		"log_backtrace_at":  "foobar.go:100",
+
+		"klog_rotation_interval":   "hourly",
+		"klog_retention_max_files": "5",
+		"klog_retention_max_size":  "100",
+		"klog_retention_max_age":   "24h",
+		"klog_compression":         "gzip",
+
+		"klog_log_file_max_backups":   "3",
+		"klog_log_file_name_template": "{program}.{severity}.{seq}.log",
+		"klog_log_file_link_template": "",
+		"klog_detect_truncation":      "true",
+		"klog_write_error_policy":     "drop",
+		"klog_file_retry_interval":    "1m0s",
+
+		"klog_async_queue_size": "100",
+		"klog_async_overflow":   "drop_oldest",
+		"logging_format":        "json",
+		"klog_color":            "always",
+
+		"klog_header_rfc3339":   "true",
+		"klog_header_utc":       "true",
+		"klog_header_precision": "ns",
+		"klog_header_path":      "module",
+
+		"klog_header_thread_id":       "goroutine",
+		"klog_header_thread_id_width": "10",
 	} {
 		f := fs.Lookup(name)
 		if f == nil {
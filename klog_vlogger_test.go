@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+// Test that -vlogger enables logging for named loggers.
+func TestVLogger(t *testing.T) {
+	defer CaptureState().Restore()
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	require.NoError(t, logging.vlogger.Set("controller=2"))
+
+	logger := NewKlogr()
+	controller := logger.WithName("controller")
+	child := controller.WithName("leader-election").WithValues("a", 1)
+	if logger.V(1).Enabled() {
+		t.Error("V(1) enabled without name")
+	}
+	if !controller.V(2).Enabled() {
+		t.Error("V(2) not enabled for controller")
+	}
+	if controller.V(3).Enabled() {
+		t.Error("V(3) enabled for controller")
+	}
+	if !child.V(2).Enabled() {
+		t.Error("V(2) not enabled for child of controller")
+	}
+	if V(1).Enabled() {
+		t.Error("V(1) enabled for global logging")
+	}
+	child.V(2).Info("test")
+	if !contains(severity.InfoLog, `"test" logger="controller.leader-election" a=1`) {
+		t.Errorf("missing log entry: %q", contents(severity.InfoLog))
+	}
+
+	// Changing the flag takes effect for existing loggers.
+	require.NoError(t, logging.vlogger.Set("other=2"))
+	if controller.V(2).Enabled() {
+		t.Error("V(2) still enabled for controller")
+	}
+	if expected, actual := "other=2", logging.vlogger.String(); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+// Test that computing the level for a new logger name does not wait for
+// logging.mu, which is held while writing log output.
+func TestVLoggerWithoutLock(t *testing.T) {
+	defer CaptureState().Restore()
+	require.NoError(t, logging.vlogger.Set("controller=2"))
+	controller := NewKlogr().WithName("controller")
+
+	enabled := make(chan bool)
+	logging.mu.Lock()
+	go func() {
+		enabled <- controller.V(2).Enabled()
+	}()
+	select {
+	case e := <-enabled:
+		if !e {
+			t.Error("V(2) not enabled for controller")
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("V(2).Enabled blocked while logging.mu was locked")
+	}
+	logging.mu.Unlock()
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plog
+
+import (
+	"testing"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+type vmoduleReceiver struct{}
+
+func (*vmoduleReceiver) enabled(level Level) bool {
+	return V(level).Enabled()
+}
+
+// Test that vmodule patterns for packages, directories and functions work
+// as advertised.
+func TestVmodulePatterns(t *testing.T) {
+	for pattern, expected := range map[string]bool{
+		"github.com/pohly/plog/v2=2":                true,
+		"github.com/pohly/plog/...=2":               true,
+		"github.com/pohly/plog/v2/internal/...=2":   false,
+		"klog_vmodule_test=2":                       true,
+		"*/klog_vmodule_test=2":                     true,
+		"func:v2.vmoduleReceiver.enabled=2":         true,
+		"func:v2.vmoduleReceiver.*=2":               true,
+		"func:github.com/pohly/plog/v2.*.enabled=2": true,
+		"func:v2.TestVmodulePatterns=2":             false,
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			defer CaptureState().Restore()
+			setFlags()
+			require.NoError(t, logging.vmodule.Set(pattern))
+			if actual := new(vmoduleReceiver).enabled(2); actual != expected {
+				t.Errorf("expected enabled %v, got %v", expected, actual)
+			}
+			if new(vmoduleReceiver).enabled(3) {
+				t.Error("V enabled for 3")
+			}
+		})
+	}
+}
+
+func TestVmoduleSyntax(t *testing.T) {
+	defer CaptureState().Restore()
+	err := logging.vmodule.Set("pkg/.../file=2")
+	if err == nil || err.Error() != "syntax error: ... is only supported as last element of a vmodule path pattern" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/go-logr/logr"
 
 	"github.com/pohly/plog/v2/internal/serialize"
+	"github.com/pohly/plog/v2/internal/verbosity"
 )
 
 const (
@@ -44,6 +45,14 @@ type klogger struct {
 	// WithName.
 	hasPrefix bool
 
+	// name is the logger name and caches its -vlogger level. Nil if
+	// WithName was not called.
+	name *verbosity.LoggerName
+
+	// forcedVerbosity is the level set with WithVerbosity. All levels up
+	// to it are enabled.
+	forcedVerbosity Level
+
 	values []interface{}
 	groups string
 }
@@ -55,11 +64,20 @@ func (l *klogger) Init(info logr.RuntimeInfo) {
 func (l *klogger) Info(level int, msg string, kvList ...interface{}) {
 	merged := serialize.MergeKVs(l.values, kvList)
 	// Skip this function.
-	VDepth(l.callDepth+1, Level(level)).InfoSDepth(l.callDepth+1, msg, merged...)
+	l.verbose(l.callDepth+1, Level(level)).InfoSDepth(l.callDepth+1, msg, merged...)
 }
 
 func (l *klogger) Enabled(level int) bool {
-	return VDepth(l.callDepth+1, Level(level)).Enabled()
+	return l.verbose(l.callDepth+1, Level(level)).Enabled()
+}
+
+// verbose is VDepth with additional support for -vlogger.
+func (l *klogger) verbose(depth int, level Level) Verbose {
+	if level <= l.forcedVerbosity ||
+		l.name != nil && logging.loggerLevel(l.name) >= level {
+		return newVerbose(level, true)
+	}
+	return VDepth(depth+1, level)
 }
 
 func (l *klogger) Error(err error, msg string, kvList ...interface{}) {
@@ -80,6 +98,7 @@ func (l klogger) WithName(name string) logr.LogSink {
 		prefix, _ := v[1].(string)
 		v[1] = prefix + "." + name
 		l.values = v
+		l.name = verbosity.NewLoggerName(prefix + "." + name)
 	} else {
 		// Preprend new key/value pair.
 		v := make([]interface{}, 0, 2+len(l.values))
@@ -87,6 +106,7 @@ func (l klogger) WithName(name string) logr.LogSink {
 		v = append(v, l.values...)
 		l.values = v
 		l.hasPrefix = true
+		l.name = verbosity.NewLoggerName(name)
 	}
 	return &l
 }
@@ -101,5 +121,11 @@ func (l klogger) WithCallDepth(depth int) logr.LogSink {
 	return &l
 }
 
+func (l klogger) WithVerbosity(level int) logr.LogSink {
+	l.forcedVerbosity = Level(level)
+	return &l
+}
+
 var _ logr.LogSink = &klogger{}
 var _ logr.CallDepthLogSink = &klogger{}
+var _ VerbositySink = &klogger{}
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"strconv"
 
+	"github.com/pohly/plog/v2/internal/buffer"
 	"github.com/pohly/plog/v2/internal/serialize"
 	"github.com/pohly/plog/v2/internal/verbosity"
 )
@@ -57,6 +58,7 @@ type configOptions struct {
 	vmoduleFlagName   string
 	verbosityDefault  int
 	bufferLogs        bool
+	headerOptions     buffer.HeaderOptions
 }
 
 // AnyToString overrides the default formatter for values that are not
@@ -105,6 +107,45 @@ func BufferLogs(enabled bool) ConfigOption {
 	}
 }
 
+// ThreadIDMode determines whether the header contains a thread ID column and
+// what is shown there.
+type ThreadIDMode string
+
+const (
+	// ThreadIDNone omits the column. This is the default.
+	ThreadIDNone ThreadIDMode = ""
+
+	// ThreadIDTid shows the ID of the operating system thread. This is
+	// only supported on Linux, other platforms show the process ID.
+	ThreadIDTid ThreadIDMode = "tid"
+
+	// ThreadIDGoroutine shows the ID of the goroutine.
+	ThreadIDGoroutine ThreadIDMode = "goroutine"
+)
+
+// HeaderThreadID overrides the default ThreadIDNone. This is useful to tell
+// apart log entries from concurrent goroutines.
+func HeaderThreadID(mode ThreadIDMode) ConfigOption {
+	return func(co *configOptions) {
+		switch mode {
+		case ThreadIDTid:
+			co.headerOptions.ThreadID = buffer.ThreadIDOS
+		case ThreadIDGoroutine:
+			co.headerOptions.ThreadID = buffer.ThreadIDGoroutine
+		default:
+			co.headerOptions.ThreadID = buffer.ThreadIDPid
+		}
+	}
+}
+
+// HeaderThreadIDWidth overrides the default minimum width of 7 for the thread
+// ID column. Longer IDs are not truncated.
+func HeaderThreadIDWidth(width int) ConfigOption {
+	return func(co *configOptions) {
+		co.headerOptions.ThreadIDWidth = width
+	}
+}
+
 // NewConfig returns a configuration with recommended defaults and optional
 // modifications. Command line flags are not bound to any FlagSet yet.
 func NewConfig(opts ...ConfigOption) *Config {
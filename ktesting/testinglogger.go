@@ -311,7 +311,7 @@ func (l tlogger) log(what LogType, msg string, level int, buf *buffer.Buffer, er
 	if what == LogError {
 		s = severity.ErrorLog
 	}
-	args := []interface{}{buf.SprintHeader(s, time.Now())}
+	args := []interface{}{buf.SprintHeaderWithOptions(s, time.Now(), l.shared.config.co.headerOptions)}
 	if l.prefix != "" {
 		args = append(args, l.prefix+":")
 	}
@@ -253,3 +253,26 @@ testinglogger_test.go:%d] "complex info message" logger="TestStop/Sub leaked gor
 		t.Errorf("testing logger should not have captured any output, got instead:\n%s", captured)
 	}
 }
+
+func TestHeaderThreadID(t *testing.T) {
+	for mode, re := range map[ktesting.ThreadIDMode]*regexp.Regexp{
+		ktesting.ThreadIDNone:      regexp.MustCompile(`^I[[:digit:]]{4} [[:digit:]:.]{15}\] hello\n$`),
+		ktesting.ThreadIDTid:       regexp.MustCompile(`^I[[:digit:]]{4} [[:digit:]:.]{15} ( +[[:digit:]]+)\] hello\n$`),
+		ktesting.ThreadIDGoroutine: regexp.MustCompile(`^I[[:digit:]]{4} [[:digit:]:.]{15} ( +[[:digit:]]+)\] hello\n$`),
+	} {
+		t.Run(string(mode), func(t *testing.T) {
+			var buffer logToBuf
+			config := ktesting.NewConfig(ktesting.HeaderThreadID(mode), ktesting.HeaderThreadIDWidth(10))
+			ktesting.NewLogger(&buffer, config).Info("hello")
+			actual := buffer.String()
+			match := re.FindStringSubmatch(actual)
+			if match == nil {
+				t.Fatalf("unexpected output:\n%q", actual)
+			}
+			// The ID gets padded to the configured width.
+			if len(match) > 1 && len(match[1]) != 10 {
+				t.Errorf("expected thread ID column of width 10, got %q", match[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logfile_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pohly/plog/v2/logfile"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func ExampleNew() {
+	dir, err := os.MkdirTemp("", "logfile")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	// Rotate once the file reaches 10MB, keeping three backups.
+	writer, err := logfile.New(path, logfile.MaxSize(10*1024*1024), logfile.MaxBackups(3), logfile.SkipHeader(true))
+	if err != nil {
+		panic(err)
+	}
+	config := textlogger.NewConfig(textlogger.Output(writer))
+	logger := textlogger.NewLogger(config)
+	logger.Info("hello world")
+	if err := writer.Close(); err != nil {
+		panic(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(strings.Contains(string(content), `"hello world"`))
+
+	// Output:
+	// true
+}
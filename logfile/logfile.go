@@ -0,0 +1,291 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logfile provides a writer for a log file with the same rotation and
+// header support as the file output of plog. It can be used wherever an
+// io.Writer is accepted, for example with textlogger.Output or plog.SetOutput.
+package logfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/rotation"
+)
+
+// Writer writes to a log file and rotates it when it becomes too large or
+// the wall clock crosses an interval boundary. When rotating, the file is
+// either truncated or renamed to a numbered backup.
+//
+// Output is buffered. Flush or Sync must be called to make sure that it gets
+// written. A Writer is safe for concurrent use.
+type Writer struct {
+	path   string
+	config config
+
+	mu     sync.Mutex
+	closed bool
+	// file is nil after a failed rotation. The next Write then tries
+	// to open it again.
+	file         *os.File
+	buf          *bufio.Writer
+	nbytes       uint64
+	nextRotation time.Time
+}
+
+type config struct {
+	maxSize          uint64
+	rotationInterval time.Duration
+	maxBackups       int
+	symlink          string
+	skipHeader       bool
+	bufferSize       int
+}
+
+// Option implements functional parameters for New.
+type Option func(*config)
+
+// MaxSize defines the size in bytes at which the log file gets rotated. Zero,
+// the default, disables size-based rotation.
+func MaxSize(size uint64) Option {
+	return func(c *config) {
+		c.maxSize = size
+	}
+}
+
+// RotationInterval enables rotation whenever the wall clock crosses an
+// interval boundary. Boundaries are aligned to local midnight, the same
+// way as for plog.SetRotationInterval.
+func RotationInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.rotationInterval = interval
+	}
+}
+
+// MaxBackups defines how many numbered backups (<path>.1, <path>.2, ...) are
+// kept when rotating. With zero, the default, the log file gets truncated
+// instead.
+func MaxBackups(n int) Option {
+	return func(c *config) {
+		c.maxBackups = n
+	}
+}
+
+// Symlink creates or replaces a symlink with the given name which points to
+// the log file. Errors are ignored.
+func Symlink(name string) Option {
+	return func(c *config) {
+		c.symlink = name
+	}
+}
+
+// SkipHeader disables writing a header with information about the program
+// at the start of each log file.
+func SkipHeader(skip bool) Option {
+	return func(c *config) {
+		c.skipHeader = skip
+	}
+}
+
+// BufferSize changes the size of the buffer for output which is not
+// written yet. The default is 256KB, the same as for the file output of
+// plog.
+func BufferSize(size int) Option {
+	return func(c *config) {
+		c.bufferSize = size
+	}
+}
+
+// timeNow can be replaced by tests.
+var timeNow = time.Now
+
+// host is the name of the machine in the file header.
+var host = func() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknownhost"
+	}
+	// Cut off the domain name, like plog does.
+	if i := strings.Index(h, "."); i >= 0 {
+		h = h[:i]
+	}
+	return h
+}()
+
+var errClosed = errors.New("log file is closed")
+
+// New opens the log file for appending, creating it if needed.
+func New(path string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		path: path,
+		config: config{
+			bufferSize: 256 * 1024,
+		},
+	}
+	for _, opt := range opts {
+		opt(&w.config)
+	}
+	if err := w.open(timeNow(), true); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write is part of the io.Writer interface. It rotates the log file before
+// writing if the data would make it too large or the current interval has
+// ended.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errClosed
+	}
+	now := timeNow()
+	if w.file == nil {
+		// Appending ensures that nothing gets lost when the previous
+		// rotation failed before backing up the file. If it is still
+		// too large, it gets rotated again below.
+		if err := w.open(now, true); err != nil {
+			return 0, err
+		}
+	}
+	if w.config.maxSize > 0 && w.nbytes+uint64(len(p)) >= w.config.maxSize ||
+		!w.nextRotation.IsZero() && !now.Before(w.nextRotation) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.buf.Write(p)
+	w.nbytes += uint64(n)
+	return n, err
+}
+
+// Flush writes buffered output to the log file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errClosed
+	}
+	if w.file == nil {
+		// Nothing buffered.
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// Sync writes buffered output to the log file and then commits the file
+// content to stable storage.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errClosed
+	}
+	if w.file == nil {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Close flushes buffered output and closes the log file. Writing is not
+// possible afterwards.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return errClosed
+	}
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.buf.Flush()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+// rotate replaces the current log file with a new, empty one. If that fails,
+// w.file is nil afterwards and the next Write tries again.
+// w.mu is held.
+func (w *Writer) rotate(now time.Time) error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	_ = w.file.Close() // ignore err
+	w.file = nil
+	if w.config.maxBackups > 0 {
+		if err := rotation.Backup(w.path, w.config.maxBackups); err != nil {
+			return fmt.Errorf("log: unable to back up log: %v", err)
+		}
+	}
+	return w.open(now, false)
+}
+
+// open opens the log file, either for appending or truncating it, and
+// writes the header.
+// w.mu is held, if needed.
+func (w *Writer) open(now time.Time, appendMode bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(w.path, flags, 0666)
+	if err != nil {
+		return fmt.Errorf("log: unable to create log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("log: unable to create log: file stat could not get fileinfo: %v", err)
+	}
+	w.file = file
+	w.nbytes = uint64(info.Size())
+	if w.buf == nil {
+		w.buf = bufio.NewWriterSize(file, w.config.bufferSize)
+	} else {
+		w.buf.Reset(file)
+	}
+	w.nextRotation = rotation.Next(now, w.config.rotationInterval)
+	if w.config.symlink != "" {
+		target := w.path
+		if filepath.Dir(w.config.symlink) == filepath.Dir(w.path) {
+			target = filepath.Base(w.path)
+		}
+		_ = os.Remove(w.config.symlink)          // ignore err
+		_ = os.Symlink(target, w.config.symlink) // ignore err
+	}
+	if w.config.skipHeader {
+		return nil
+	}
+	n, err := w.buf.Write(rotation.Header(now, host))
+	w.nbytes += uint64(n)
+	return err
+}
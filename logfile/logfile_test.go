@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	content := readFile(t, path)
+	if !strings.HasPrefix(content, "Log file created at: ") || !strings.HasSuffix(content, "msg\nhello\n") {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+
+	if _, err := w.Write([]byte("more\n")); err == nil {
+		t.Error("expected error after Close")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2024, 3, 10, 10, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	w, err := New(path, SkipHeader(true), MaxSize(10), RotationInterval(time.Hour), MaxBackups(2))
+	require.NoError(t, err)
+
+	write := func(data string) {
+		t.Helper()
+		_, err := w.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	write("a\n")
+	// Exceeds the size limit.
+	write("bbbbbbbb\n")
+	// Crosses the interval boundary.
+	now = now.Add(time.Hour)
+	write("c\n")
+	require.NoError(t, w.Sync())
+
+	for name, expected := range map[string]string{
+		path:        "c\n",
+		path + ".1": "bbbbbbbb\n",
+		path + ".2": "a\n",
+	} {
+		if actual := readFile(t, name); actual != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, actual)
+		}
+	}
+	require.NoError(t, w.Close())
+}
+
+func TestTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("old\n"), 0666))
+	w, err := New(path, SkipHeader(true), MaxSize(10))
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	if actual, expected := readFile(t, path), "old\nnew\n"; actual != expected {
+		t.Errorf("expected %q after appending, got %q", expected, actual)
+	}
+
+	_, err = w.Write([]byte("truncated\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	if actual, expected := readFile(t, path), "truncated\n"; actual != expected {
+		t.Errorf("expected %q after rotation, got %q", expected, actual)
+	}
+}
+
+func TestRotationFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files cannot be removed on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := New(path, SkipHeader(true), MaxSize(10))
+	require.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("old\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+
+	// Creating the new file fails while a directory is in the way.
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Mkdir(path, 0777))
+	if _, err := w.Write([]byte("failed\n...\n")); err == nil {
+		t.Fatal("expected error when rotation fails")
+	}
+	require.NoError(t, w.Flush())
+
+	// The next Write tries again.
+	require.NoError(t, os.Remove(path))
+	_, err = w.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	if actual, expected := readFile(t, path), "new\n"; actual != expected {
+		t.Errorf("expected %q after recovering, got %q", expected, actual)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	link := filepath.Join(dir, "current")
+	w, err := New(path, Symlink(link))
+	require.NoError(t, err)
+	defer w.Close()
+
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	if target != "app.log" {
+		t.Errorf("expected symlink to app.log, got %q", target)
+	}
+}
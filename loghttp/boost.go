@@ -0,0 +1,179 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loghttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var timeNow = time.Now // Stubbed out for testing.
+
+type boostHandler struct {
+	boost  func(level int, vmodule string, duration time.Duration) (cancel func(), err error)
+	config config
+
+	mu     sync.Mutex
+	nextID int
+	active map[int]*activeBoost
+}
+
+// activeBoost is the JSON representation of a boost, plus what is needed
+// to end it.
+type activeBoost struct {
+	ID      int       `json:"id"`
+	V       int       `json:"v"`
+	VModule string    `json:"vmodule"`
+	Expires time.Time `json:"expires"`
+
+	cancel func()
+	timer  *time.Timer
+}
+
+// NewBoostHandler creates a handler for temporary verbosity boosts through
+// settings.Boost. Requests fail with status 501 when that is nil.
+func NewBoostHandler(settings Settings, opts ...Option) http.Handler {
+	h := &boostHandler{
+		boost:  settings.Boost,
+		active: make(map[int]*activeBoost),
+	}
+	for _, opt := range opts {
+		opt(&h.config)
+	}
+	return h
+}
+
+func (h *boostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.boost == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "verbosity boosts are not supported"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, h.list())
+	case http.MethodPut, http.MethodPost:
+		b, err := h.start(w, r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+	case http.MethodDelete:
+		status, err := h.cancel(r)
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, h.list())
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": fmt.Sprintf("method %s not allowed", r.Method)})
+	}
+}
+
+// list returns the active boosts, sorted by ID.
+func (h *boostHandler) list() []*activeBoost {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	boosts := make([]*activeBoost, 0, len(h.active))
+	for _, b := range h.active {
+		boosts = append(boosts, b)
+	}
+	sort.Slice(boosts, func(i, j int) bool { return boosts[i].ID < boosts[j].ID })
+	return boosts
+}
+
+func (h *boostHandler) start(w http.ResponseWriter, r *http.Request) (*activeBoost, error) {
+	values, err := parseBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	b := &activeBoost{}
+	var duration time.Duration
+	for key, value := range values {
+		switch key {
+		case "v":
+			b.V, err = strconv.Atoi(value)
+		case "vmodule":
+			b.VModule = value
+		case "duration":
+			duration, err = time.ParseDuration(value)
+		default:
+			err = errors.New("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if duration == 0 {
+		return nil, errors.New("duration: must be set")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b.cancel, err = h.boost(b.V, b.VModule, duration)
+	if err != nil {
+		return nil, err
+	}
+	h.nextID++
+	b.ID = h.nextID
+	b.Expires = timeNow().Add(duration)
+	h.active[b.ID] = b
+	b.timer = time.AfterFunc(duration, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.active[b.ID] == b {
+			delete(h.active, b.ID)
+			h.config.auditLogger().Info("Verbosity boost expired via HTTP", "id", b.ID)
+		}
+	})
+	h.config.auditLogger().Info("Started verbosity boost via HTTP", "id", b.ID, "v", b.V, "vmodule", b.VModule, "duration", duration, "remoteAddr", r.RemoteAddr)
+	return b, nil
+}
+
+// cancel ends one or all boosts and returns the HTTP status for an error.
+func (h *boostHandler) cancel(r *http.Request) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var boosts []*activeBoost
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("id: %w", err)
+		}
+		b, ok := h.active[id]
+		if !ok {
+			return http.StatusNotFound, fmt.Errorf("id: no active boost %d", id)
+		}
+		boosts = append(boosts, b)
+	} else {
+		for _, b := range h.active {
+			boosts = append(boosts, b)
+		}
+		sort.Slice(boosts, func(i, j int) bool { return boosts[i].ID < boosts[j].ID })
+	}
+	for _, b := range boosts {
+		b.timer.Stop()
+		b.cancel()
+		delete(h.active, b.ID)
+		h.config.auditLogger().Info("Canceled verbosity boost via HTTP", "id", b.ID, "remoteAddr", r.RemoteAddr)
+	}
+	return 0, nil
+}
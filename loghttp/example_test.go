@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loghttp_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/loghttp"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func ExampleNewHandler() {
+	config := textlogger.NewConfig()
+	mux := http.NewServeMux()
+	// The audit log is discarded here. By default it goes to
+	// plog.Background().
+	mux.Handle("/debug/logging", loghttp.NewHandler(loghttp.TextLogger(config), loghttp.Logger(logr.Discard())))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	request, _ := http.NewRequest(http.MethodPut, server.URL+"/debug/logging", strings.NewReader(`{"v":4,"vmodule":"controller=5"}`))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	fmt.Print(string(body))
+	fmt.Printf("verbosity: %s\n", config.Verbosity())
+
+	// Output:
+	// {"v":"4","vlogger":"","vmodule":"controller=5"}
+	// verbosity: 4
+}
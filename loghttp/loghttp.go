@@ -0,0 +1,294 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loghttp provides an HTTP handler for inspecting and changing the
+// verbosity settings at runtime, either those of plog or those of a
+// textlogger.Config.
+//
+// GET returns the current settings as a JSON object with string values:
+//
+//	{"stderrthreshold":"2","v":"0","vlogger":"","vmodule":"controller=4"}
+//
+// PUT and POST change some or all of them. The request body is either a JSON
+// object with the same keys, where numbers are also accepted, or form data
+// as sent by "curl -d v=4". The values have the same syntax as the
+// corresponding command line flags. The response is the same as for GET.
+// When a value is invalid, nothing gets changed and the response has status
+// 400 with the error in a JSON object:
+//
+//	{"error":"v: strconv.ParseInt: parsing \"x\": invalid syntax"}
+//
+// NewBoostHandler provides a second endpoint for temporary verbosity boosts,
+// which end automatically. POST and PUT start a boost:
+//
+//	{"v":6,"vmodule":"controller=8","duration":"15m"}
+//
+// GET lists the boosts which were started through the handler and are still
+// active, DELETE cancels all of them or, with an "id" query parameter, just
+// one.
+//
+// Each change is logged as an audit line. The handlers do no
+// authentication. They should only be made available through a server which
+// restricts access.
+package loghttp
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+// maxBodySize limits the size of a request body.
+const maxBodySize = 64 * 1024
+
+// Settings contains the values that the handler exposes. Nil values are not
+// supported by the logger and get omitted.
+type Settings struct {
+	// Verbosity is the value of -v.
+	Verbosity flag.Value
+	// VModule is the value of -vmodule.
+	VModule flag.Value
+	// VLogger is the value of -vlogger.
+	VLogger flag.Value
+	// StderrThreshold is the value of -stderrthreshold.
+	StderrThreshold flag.Value
+	// Boost starts a temporary verbosity boost, see NewBoostHandler.
+	Boost func(level int, vmodule string, duration time.Duration) (cancel func(), err error)
+}
+
+// Global returns the settings of plog. They are the same values which get
+// registered by plog.InitFlags.
+func Global() Settings {
+	fs := flag.NewFlagSet("plog", flag.ContinueOnError)
+	plog.InitFlags(fs)
+	return Settings{
+		Verbosity:       fs.Lookup("v").Value,
+		VModule:         fs.Lookup("vmodule").Value,
+		VLogger:         fs.Lookup("vlogger").Value,
+		StderrThreshold: fs.Lookup("stderrthreshold").Value,
+		Boost: func(level int, vmodule string, duration time.Duration) (func(), error) {
+			return plog.BoostVerbosity(plog.Level(level), vmodule, duration)
+		},
+	}
+}
+
+// TextLogger returns the settings of a textlogger configuration. It has no
+// stderr threshold.
+func TextLogger(c *textlogger.Config) Settings {
+	return Settings{
+		Verbosity: c.Verbosity(),
+		VModule:   c.VModule(),
+		VLogger:   c.VLogger(),
+		Boost:     c.BoostVerbosity,
+	}
+}
+
+type config struct {
+	logger *plog.Logger
+}
+
+// Option implements functional parameters for NewHandler.
+type Option func(*config)
+
+// Logger overrides the default plog.Background() for the audit log.
+func Logger(logger plog.Logger) Option {
+	return func(c *config) {
+		c.logger = &logger
+	}
+}
+
+func (c config) auditLogger() plog.Logger {
+	if c.logger != nil {
+		return *c.logger
+	}
+	return plog.Background()
+}
+
+// setting is one value with the key used for it in JSON.
+type setting struct {
+	key   string
+	value flag.Value
+}
+
+type handler struct {
+	settings []setting
+	config   config
+
+	// mu serializes changes, which makes it possible to revert them
+	// consistently.
+	mu sync.Mutex
+}
+
+// NewHandler creates a handler for the settings.
+func NewHandler(settings Settings, opts ...Option) http.Handler {
+	h := &handler{}
+	for _, opt := range opts {
+		opt(&h.config)
+	}
+	for _, s := range []setting{
+		{key: "v", value: settings.Verbosity},
+		{key: "vmodule", value: settings.VModule},
+		{key: "vlogger", value: settings.VLogger},
+		{key: "stderrthreshold", value: settings.StderrThreshold},
+	} {
+		if s.value != nil {
+			h.settings = append(h.settings, s)
+		}
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.writeSettings(w)
+	case http.MethodPut, http.MethodPost:
+		values, err := h.parse(w, r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := h.change(r, values); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		h.writeSettings(w)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": fmt.Sprintf("method %s not allowed", r.Method)})
+	}
+}
+
+func (h *handler) writeSettings(w http.ResponseWriter) {
+	current := make(map[string]string, len(h.settings))
+	for _, s := range h.settings {
+		current[s.key] = s.value.String()
+	}
+	writeJSON(w, http.StatusOK, current)
+}
+
+// parse returns the new values from the request body.
+func (h *handler) parse(w http.ResponseWriter, r *http.Request) (map[string]string, error) {
+	values, err := parseBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no settings in request")
+	}
+	for key := range values {
+		if h.lookup(key) == nil {
+			return nil, fmt.Errorf("%s: unknown or unsupported setting", key)
+		}
+	}
+	return values, nil
+}
+
+// parseBody returns the key/value pairs from a request body with JSON or
+// form data.
+func parseBody(w http.ResponseWriter, r *http.Request) (map[string]string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	values := make(map[string]string)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("parse form: %w", err)
+		}
+		for key, v := range r.PostForm {
+			if len(v) != 1 {
+				return nil, fmt.Errorf("%s: expected exactly one value, got %d", key, len(v))
+			}
+			values[key] = v[0]
+		}
+		return values, nil
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode JSON: %w", err)
+	}
+	for key, v := range body {
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case json.Number:
+			values[key] = v.String()
+		default:
+			return nil, fmt.Errorf("%s: expected string or number, got %T", key, v)
+		}
+	}
+	return values, nil
+}
+
+func (h *handler) lookup(key string) flag.Value {
+	for _, s := range h.settings {
+		if s.key == key {
+			return s.value
+		}
+	}
+	return nil
+}
+
+// change applies the new values in the order of h.settings. If one of them
+// is invalid, the ones which were already changed get reverted. The values
+// of the flags don't include verbosity boosts, so reverting restores
+// exactly the previous settings.
+func (h *handler) change(r *http.Request, values map[string]string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	type change struct {
+		setting
+		old, new string
+	}
+	var changes []change
+	for _, s := range h.settings {
+		value, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		old := s.value.String()
+		if err := s.value.Set(value); err != nil {
+			for i := len(changes) - 1; i >= 0; i-- {
+				// Cannot fail because the old value was valid.
+				_ = changes[i].value.Set(changes[i].old)
+			}
+			return fmt.Errorf("%s: %w", s.key, err)
+		}
+		changes = append(changes, change{setting: s, old: old, new: s.value.String()})
+	}
+
+	logger := h.config.auditLogger()
+	for _, c := range changes {
+		logger.Info("Changed log setting via HTTP", "setting", c.key, "old", c.old, "new", c.new, "remoteAddr", r.RemoteAddr)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	// The data is simple enough that encoding cannot fail and
+	// write errors cannot be reported anymore.
+	_ = json.NewEncoder(w).Encode(v)
+}
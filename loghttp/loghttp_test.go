@@ -0,0 +1,206 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loghttp
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func TestHandler(t *testing.T) {
+	for name, tc := range map[string]struct {
+		method      string
+		contentType string
+		body        string
+		status      int
+		response    string
+		audit       []string
+	}{
+		"get": {
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			response: `{"v":"1","vlogger":"","vmodule":""}`,
+		},
+		"put-json": {
+			method:   http.MethodPut,
+			body:     `{"v":3,"vmodule":"foo=2"}`,
+			status:   http.StatusOK,
+			response: `{"v":"3","vlogger":"","vmodule":"foo=2"}`,
+			audit: []string{
+				`"Changed log setting via HTTP" setting="v" old="1" new="3" remoteAddr="192.0.2.1:1234"`,
+				`"Changed log setting via HTTP" setting="vmodule" old="" new="foo=2" remoteAddr="192.0.2.1:1234"`,
+			},
+		},
+		"post-form": {
+			method:      http.MethodPost,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "vlogger=controller%3D4",
+			status:      http.StatusOK,
+			response:    `{"v":"1","vlogger":"controller=4","vmodule":""}`,
+			audit: []string{
+				`"Changed log setting via HTTP" setting="vlogger" old="" new="controller=4" remoteAddr="192.0.2.1:1234"`,
+			},
+		},
+		"invalid-value": {
+			// v gets changed first and then reverted.
+			method:   http.MethodPut,
+			body:     `{"v":"5","vmodule":"foo=x"}`,
+			status:   http.StatusBadRequest,
+			response: `{"error":"vmodule: syntax error: expect comma-separated list of filename=N"}`,
+		},
+		"unsupported": {
+			method:   http.MethodPut,
+			body:     `{"stderrthreshold":"ERROR"}`,
+			status:   http.StatusBadRequest,
+			response: `{"error":"stderrthreshold: unknown or unsupported setting"}`,
+		},
+		"wrong-type": {
+			method:   http.MethodPut,
+			body:     `{"v":true}`,
+			status:   http.StatusBadRequest,
+			response: `{"error":"v: expected string or number, got bool"}`,
+		},
+		"empty": {
+			method:   http.MethodPut,
+			body:     `{}`,
+			status:   http.StatusBadRequest,
+			response: `{"error":"no settings in request"}`,
+		},
+		"invalid-json": {
+			method:   http.MethodPut,
+			body:     `{`,
+			status:   http.StatusBadRequest,
+			response: `{"error":"decode JSON: unexpected EOF"}`,
+		},
+		"delete": {
+			method:   http.MethodDelete,
+			status:   http.StatusMethodNotAllowed,
+			response: `{"error":"method DELETE not allowed"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := textlogger.NewConfig(textlogger.Verbosity(1))
+			var audit bytes.Buffer
+			logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(&audit)))
+			handler := NewHandler(TextLogger(config), Logger(logger))
+
+			request := httptest.NewRequest(tc.method, "/debug/logging", strings.NewReader(tc.body))
+			request.RemoteAddr = "192.0.2.1:1234"
+			if tc.contentType != "" {
+				request.Header.Set("Content-Type", tc.contentType)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, recorder.Code)
+			}
+			if actual := strings.TrimSuffix(recorder.Body.String(), "\n"); actual != tc.response {
+				t.Errorf("expected response:\n%s\ngot:\n%s", tc.response, actual)
+			}
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSuffix(audit.String(), "\n"), "\n") {
+				if line == "" {
+					continue
+				}
+				// Strip the header.
+				lines = append(lines, line[strings.Index(line, "] ")+2:])
+			}
+			if strings.Join(lines, "\n") != strings.Join(tc.audit, "\n") {
+				t.Errorf("expected audit log:\n%s\ngot:\n%s", strings.Join(tc.audit, "\n"), audit.String())
+			}
+			if tc.status != http.StatusOK && config.Verbosity().String() != "1" {
+				t.Errorf("verbosity should not have changed, got %s", config.Verbosity().String())
+			}
+		})
+	}
+}
+
+func TestGlobal(t *testing.T) {
+	defer plog.CaptureState().Restore()
+	var audit bytes.Buffer
+	logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(&audit)))
+	handler := NewHandler(Global(), Logger(logger))
+
+	request := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"v":"4","stderrthreshold":"WARNING"}`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if !plog.V(4).Enabled() || plog.V(5).Enabled() {
+		t.Error("verbosity not changed to 4")
+	}
+	if expected, actual := `{"stderrthreshold":"1","v":"4","vlogger":"","vmodule":""}`+"\n", recorder.Body.String(); actual != expected {
+		t.Errorf("expected response %q, got %q", expected, actual)
+	}
+	if count := strings.Count(audit.String(), "Changed log setting"); count != 2 {
+		t.Errorf("expected two audit lines, got:\n%s", audit.String())
+	}
+}
+
+func TestChangeDuringBoost(t *testing.T) {
+	for name, settings := range map[string]func() Settings{
+		"textlogger": func() Settings {
+			return TextLogger(textlogger.NewConfig(textlogger.Verbosity(1)))
+		},
+		"global": func() Settings {
+			s := Global()
+			_ = s.Verbosity.Set("1")
+			return s
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer plog.CaptureState().Restore()
+			settings := settings()
+			var audit bytes.Buffer
+			logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(&audit)))
+			handler := NewHandler(settings, Logger(logger))
+			cancel, err := settings.Boost(6, "", time.Hour)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			put := func(body string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+				return recorder
+			}
+			if recorder := put(`{"v":"2","vmodule":"bad"}`); recorder.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, recorder.Code, recorder.Body.String())
+			}
+			if recorder := put(`{"v":"3"}`); recorder.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+			}
+			if !strings.Contains(audit.String(), `setting="v" old="1" new="3"`) {
+				t.Errorf("audit log should contain the value without the boost:\n%s", audit.String())
+			}
+			cancel()
+			if actual := settings.Verbosity.String(); actual != "3" {
+				t.Errorf("expected v=3 after the boost, got %s", actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp_test
+
+import (
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/otlp"
+)
+
+func ExampleNewHTTPExporter() {
+	exporter := otlp.NewHTTPExporter("http://localhost:4318/v1/logs",
+		otlp.ServiceName("my-app"),
+		otlp.ResourceAttributes("k8s.namespace.name", "default"),
+	)
+	defer func() {
+		if err := exporter.Close(); err != nil {
+			panic(err)
+		}
+	}()
+	plog.SetLoggerWithOptions(exporter.Logger(), plog.FlushLogger(exporter.Flush))
+	defer plog.ClearLogger()
+
+	// Becomes a record with trace ID and the attribute "pod".
+	plog.InfoS("pod started", "pod", "default/nginx", "trace_id", "4bf92f3577b34da6a3ce929d0e0e4736")
+}
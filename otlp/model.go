@@ -0,0 +1,201 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/go-logr/logr"
+)
+
+// The types below mirror the OTLP protobuf messages for logs with the
+// field names of the JSON encoding. 64 bit integers are strings in that
+// encoding, trace and span IDs are hex strings.
+
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         string     `json:"timeUnixNano"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber"`
+	SeverityText         string     `json:"severityText"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string      `json:"stringValue,omitempty"`
+	BoolValue   *bool        `json:"boolValue,omitempty"`
+	IntValue    *string      `json:"intValue,omitempty"`
+	DoubleValue *float64     `json:"doubleValue,omitempty"`
+	BytesValue  []byte       `json:"bytesValue,omitempty"`
+	ArrayValue  *arrayValue  `json:"arrayValue,omitempty"`
+	KvlistValue *kvlistValue `json:"kvlistValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type kvlistValue struct {
+	Values []keyValue `json:"values"`
+}
+
+// Severity numbers as defined by the log data model.
+const (
+	severityDebug = 5
+	severityInfo  = 9
+	severityError = 17
+)
+
+func stringValue(s string) anyValue {
+	return anyValue{StringValue: &s}
+}
+
+func intValue(i int64) anyValue {
+	s := strconv.FormatInt(i, 10)
+	return anyValue{IntValue: &s}
+}
+
+// maxDepth limits the recursion when converting nested values.
+const maxDepth = 10
+
+// toValue converts an arbitrary Go value.
+func toValue(v interface{}, depth int) anyValue {
+	switch v := v.(type) {
+	case nil:
+		return anyValue{}
+	case string:
+		return stringValue(v)
+	case bool:
+		return anyValue{BoolValue: &v}
+	case []byte:
+		if v == nil {
+			v = []byte{}
+		}
+		return anyValue{BytesValue: v}
+	case error:
+		return stringValue(v.Error())
+	case fmt.Stringer:
+		return stringValue(v.String())
+	case logr.Marshaler:
+		return toValue(v.MarshalLog(), depth)
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intValue(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := value.Uint()
+		if u > math.MaxInt64 {
+			return stringValue(strconv.FormatUint(u, 10))
+		}
+		return intValue(int64(u))
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			// Not supported by JSON.
+			return stringValue(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+		return anyValue{DoubleValue: &f}
+	}
+	if depth >= maxDepth {
+		return stringValue(fmt.Sprintf("%+v", v))
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		values := make([]anyValue, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, toValue(value.Index(i).Interface(), depth+1))
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+	case reflect.Map:
+		values := make([]keyValue, 0, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			values = append(values, keyValue{Key: fmt.Sprint(iter.Key().Interface()), Value: toValue(iter.Value().Interface(), depth+1)})
+		}
+		// Map iteration order is random.
+		sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+		return anyValue{KvlistValue: &kvlistValue{Values: values}}
+	case reflect.Pointer:
+		if value.IsNil() {
+			return anyValue{}
+		}
+		return toValue(value.Elem().Interface(), depth+1)
+	}
+	return stringValue(fmt.Sprintf("%+v", v))
+}
+
+// missingValue is used when there is no value for a key, the same as in
+// the text output.
+const missingValue = "(MISSING)"
+
+// toAttributes converts key/value pairs. If a key is used more than once,
+// the last value is used.
+func toAttributes(keysAndValues []interface{}) []keyValue {
+	var attributes []keyValue
+	index := map[string]int{}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		var value interface{} = missingValue
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		kv := keyValue{Key: key, Value: toValue(value, 0)}
+		if j, ok := index[key]; ok {
+			attributes[j] = kv
+			continue
+		}
+		index[key] = len(attributes)
+		attributes = append(attributes, kv)
+	}
+	return attributes
+}
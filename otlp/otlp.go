@@ -0,0 +1,363 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp converts log entries into the OpenTelemetry log data model and
+// exports them in batches, encoded as OTLP/JSON. The records get sent to an
+// OTLP/HTTP endpoint or written to a file.
+//
+// The logger returned by Exporter.Logger can be used directly or be
+// installed as backend for plog:
+//
+//	exporter := otlp.NewHTTPExporter("http://localhost:4318/v1/logs", otlp.ServiceName("my-app"))
+//	defer exporter.Close()
+//	plog.SetLoggerWithOptions(exporter.Logger(), plog.FlushLogger(exporter.Flush))
+//
+// Each record has the time stamp, a severity number and text, the message as
+// body and the key/value pairs as attributes. Well-known attributes are
+// "logger" (the logger name), "exception.message" (the error passed to
+// Error), "code.filepath" and "code.lineno" (the caller). Values of the keys
+// "trace_id" and "span_id" (also "traceID", "traceId", "spanID" and "spanId")
+// are stored as trace and span ID of the record if they are valid hex
+// strings.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Exporter collects log records and exports them in batches. It is safe for
+// concurrent use.
+type Exporter struct {
+	config config
+	send   func(body []byte) error
+
+	mu      sync.Mutex
+	records []logRecord
+	// dropped is the total number of records which were dropped because
+	// the queue was full, unreported the number since the last export.
+	dropped    int64
+	unreported int64
+
+	// exportMu ensures that batches get exported in order.
+	exportMu sync.Mutex
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+type config struct {
+	serviceName        string
+	resourceAttributes []interface{}
+	batchSize          int
+	maxQueueSize       int
+	flushInterval      time.Duration
+	headers            http.Header
+	client             *http.Client
+	errorHandler       func(error)
+	verbosity          int
+}
+
+// Option implements functional parameters for NewHTTPExporter and
+// NewFileExporter.
+type Option func(*config)
+
+// ServiceName sets the service.name resource attribute. The default is the
+// base name of the program.
+func ServiceName(name string) Option {
+	return func(c *config) {
+		c.serviceName = name
+	}
+}
+
+// ResourceAttributes adds key/value pairs which describe the resource, for
+// example "host.name" or "k8s.pod.name".
+func ResourceAttributes(keysAndValues ...interface{}) Option {
+	return func(c *config) {
+		c.resourceAttributes = append(c.resourceAttributes, keysAndValues...)
+	}
+}
+
+// BatchSize overrides the default of 512 records that get collected before
+// exporting them. It is also the maximum number of records per export
+// request.
+func BatchSize(size int) Option {
+	return func(c *config) {
+		c.batchSize = size
+	}
+}
+
+// MaxQueueSize overrides the default of 8192 records that may be waiting for
+// export. Further records are dropped until the next export, which then
+// reports the number of dropped records to the error handler. Zero removes
+// the limit.
+func MaxQueueSize(size int) Option {
+	return func(c *config) {
+		c.maxQueueSize = size
+	}
+}
+
+// FlushInterval overrides the default of five seconds after which collected
+// records get exported even if the batch is not full yet. Zero disables
+// periodic exporting.
+func FlushInterval(interval time.Duration) Option {
+	return func(c *config) {
+		c.flushInterval = interval
+	}
+}
+
+// Header adds an HTTP header to each export request, for example for
+// authentication.
+func Header(key, value string) Option {
+	return func(c *config) {
+		c.headers.Add(key, value)
+	}
+}
+
+// HTTPClient overrides the default client, which is like http.DefaultClient
+// with a timeout of ten seconds for each export request.
+func HTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// ErrorHandler overrides the default handling of export errors, which is to
+// print them to stderr. Records which could not be exported are dropped.
+func ErrorHandler(handler func(error)) Option {
+	return func(c *config) {
+		c.errorHandler = handler
+	}
+}
+
+// Verbosity sets the maximum level of info messages which are exported
+// when the logger gets called directly. By default, all levels are enabled
+// because plog already checks the verbosity before invoking the logger
+// installed with SetLoggerWithOptions.
+func Verbosity(level int) Option {
+	return func(c *config) {
+		c.verbosity = level
+	}
+}
+
+// timeNow can be replaced by tests.
+var timeNow = time.Now
+
+// NewHTTPExporter creates an exporter which sends records to an OTLP/HTTP
+// endpoint like http://localhost:4318/v1/logs, using the JSON encoding.
+func NewHTTPExporter(endpoint string, opts ...Option) *Exporter {
+	e := newExporter(opts)
+	e.send = func(body []byte) error {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for key, values := range e.config.headers {
+			req.Header[key] = values
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := e.config.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body) // ignore err
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected response status %q", resp.Status)
+		}
+		return nil
+	}
+	e.start()
+	return e
+}
+
+// NewFileExporter creates an exporter which writes one export request per
+// line, the format that the OpenTelemetry collector reads with the otlpjsonfile
+// receiver. The caller is responsible for closing the writer after closing
+// the exporter.
+func NewFileExporter(w io.Writer, opts ...Option) *Exporter {
+	e := newExporter(opts)
+	e.send = func(body []byte) error {
+		_, err := w.Write(append(body, '\n'))
+		return err
+	}
+	e.start()
+	return e
+}
+
+func newExporter(opts []Option) *Exporter {
+	e := &Exporter{
+		config: config{
+			serviceName:   programName(),
+			batchSize:     512,
+			maxQueueSize:  8192,
+			flushInterval: 5 * time.Second,
+			headers:       http.Header{},
+			client:        &http.Client{Timeout: 10 * time.Second},
+			errorHandler: func(err error) {
+				fmt.Fprintf(os.Stderr, "otlp: exporting log records failed: %v\n", err)
+			},
+			verbosity: math.MaxInt32,
+		},
+		kick: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&e.config)
+	}
+	return e
+}
+
+// start launches the background goroutine which exports full batches and,
+// if enabled, exports periodically.
+func (e *Exporter) start() {
+	go func() {
+		defer close(e.done)
+		var tick <-chan time.Time
+		if e.config.flushInterval > 0 {
+			ticker := time.NewTicker(e.config.flushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-e.kick:
+			case <-tick:
+			}
+			e.Flush()
+		}
+	}()
+}
+
+// add queues one record and triggers an export when the batch is full. The
+// record is dropped when the queue is full.
+func (e *Exporter) add(record logRecord) {
+	e.mu.Lock()
+	if e.config.maxQueueSize > 0 && len(e.records) >= e.config.maxQueueSize {
+		e.dropped++
+		e.unreported++
+	} else {
+		e.records = append(e.records, record)
+	}
+	full := len(e.records) >= e.config.batchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush exports all collected records. Errors are passed to the error
+// handler, only the first one if there are several batches. Flush can be
+// used with plog.FlushLogger.
+func (e *Exporter) Flush() {
+	if err := e.flush(); err != nil {
+		e.config.errorHandler(err)
+	}
+}
+
+func (e *Exporter) flush() error {
+	e.exportMu.Lock()
+	defer e.exportMu.Unlock()
+
+	e.mu.Lock()
+	records := e.records
+	e.records = nil
+	unreported := e.unreported
+	e.unreported = 0
+	e.mu.Unlock()
+
+	var firstErr error
+	if unreported > 0 {
+		firstErr = fmt.Errorf("dropped %d log records because the queue was full", unreported)
+	}
+	for len(records) > 0 {
+		size := len(records)
+		if e.config.batchSize > 0 && size > e.config.batchSize {
+			size = e.config.batchSize
+		}
+		err := e.export(records[:size])
+		if firstErr == nil {
+			firstErr = err
+		}
+		records = records[size:]
+	}
+	return firstErr
+}
+
+// export sends one batch.
+func (e *Exporter) export(records []logRecord) error {
+	body, err := json.Marshal(e.request(records))
+	if err != nil {
+		return err
+	}
+	return e.send(body)
+}
+
+// Dropped returns the number of records which were dropped because the queue
+// was full.
+func (e *Exporter) Dropped() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Close stops periodic exporting and exports all remaining records. The
+// exporter must not be used anymore afterwards.
+func (e *Exporter) Close() error {
+	close(e.stop)
+	<-e.done
+	return e.flush()
+}
+
+// scopeName identifies this package as the instrumentation scope.
+const scopeName = "github.com/pohly/plog/v2/otlp"
+
+func (e *Exporter) request(records []logRecord) exportRequest {
+	attributes := []keyValue{{Key: "service.name", Value: stringValue(e.config.serviceName)}}
+	attributes = append(attributes, toAttributes(e.config.resourceAttributes)...)
+	return exportRequest{
+		ResourceLogs: []resourceLogs{{
+			Resource: resource{Attributes: attributes},
+			ScopeLogs: []scopeLogs{{
+				Scope:      scope{Name: scopeName},
+				LogRecords: records,
+			}},
+		}},
+	}
+}
+
+func programName() string {
+	name := os.Args[0]
+	for i := len(name) - 1; i >= 0; i-- {
+		if os.IsPathSeparator(name[i]) {
+			return name[i+1:]
+		}
+	}
+	return name
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/internal/test/require"
+)
+
+func fixedTime(t *testing.T) {
+	t.Cleanup(func() { timeNow = time.Now })
+	timeNow = func() time.Time {
+		return time.Unix(1136214245, 67890000)
+	}
+}
+
+// collector is an OTLP/HTTP endpoint which stores the request bodies.
+type collector struct {
+	mu       sync.Mutex
+	requests []string
+	status   int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/logs" ||
+		r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+		return
+	}
+	c.requests = append(c.requests, string(body))
+}
+
+func (c *collector) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+// normalize replaces the line number of the caller and indents the JSON.
+func normalize(t *testing.T, data string) string {
+	t.Helper()
+	data = regexp.MustCompile(`"code.lineno","value":\{"intValue":"[0-9]+"`).ReplaceAllString(data, `"code.lineno","value":{"intValue":"NNN"`)
+	data = regexp.MustCompile(`"stringValue":"[^"]*/otlp_test.go"`).ReplaceAllString(data, `"stringValue":"otlp_test.go"`)
+	var out bytes.Buffer
+	require.NoError(t, json.Indent(&out, []byte(data), "", "  "))
+	return out.String()
+}
+
+func TestHTTPExporter(t *testing.T) {
+	fixedTime(t)
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	exporter := NewHTTPExporter(server.URL+"/v1/logs",
+		ServiceName("app"),
+		ResourceAttributes("host.name", "node-1"),
+		Header("Authorization", "Bearer token"),
+		BatchSize(2),
+		FlushInterval(0),
+	)
+	logger := exporter.Logger()
+	logger.WithName("a").WithName("b").Info("hello", "count", 1, "trace_id", "4BF92F3577B34DA6A3CE929D0E0E4736", "span_id", "00f067aa0ba902b7")
+	logger.V(2).Error(errors.New("fail"), "oops", "list", []int{1, 2}, "map", map[string]bool{"y": false, "x": true})
+	logger.V(5).Info("debug", "count", 1, "count", 2)
+	require.NoError(t, exporter.Close())
+
+	requests := c.get()
+	if len(requests) != 2 {
+		t.Fatalf("expected two export requests, got %d: %q", len(requests), requests)
+	}
+	expected := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"app"}},{"key":"host.name","value":{"stringValue":"node-1"}}]},"scopeLogs":[{"scope":{"name":"github.com/pohly/plog/v2/otlp"},"logRecords":[` +
+		`{"timeUnixNano":"1136214245067890000","observedTimeUnixNano":"1136214245067890000","severityNumber":9,"severityText":"INFO","body":{"stringValue":"hello"},"attributes":[{"key":"logger","value":{"stringValue":"a.b"}},{"key":"code.filepath","value":{"stringValue":"otlp_test.go"}},{"key":"code.lineno","value":{"intValue":"NNN"}},{"key":"count","value":{"intValue":"1"}}],"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7"},` +
+		`{"timeUnixNano":"1136214245067890000","observedTimeUnixNano":"1136214245067890000","severityNumber":17,"severityText":"ERROR","body":{"stringValue":"oops"},"attributes":[{"key":"exception.message","value":{"stringValue":"fail"}},{"key":"code.filepath","value":{"stringValue":"otlp_test.go"}},{"key":"code.lineno","value":{"intValue":"NNN"}},{"key":"list","value":{"arrayValue":{"values":[{"intValue":"1"},{"intValue":"2"}]}}},{"key":"map","value":{"kvlistValue":{"values":[{"key":"x","value":{"boolValue":true}},{"key":"y","value":{"boolValue":false}}]}}}]}` +
+		`]}]}]}`
+	if actual, expected := normalize(t, requests[0]), normalize(t, expected); actual != expected {
+		t.Errorf("unexpected first request:\n%s\nexpected:\n%s", actual, expected)
+	}
+	expected = `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"app"}},{"key":"host.name","value":{"stringValue":"node-1"}}]},"scopeLogs":[{"scope":{"name":"github.com/pohly/plog/v2/otlp"},"logRecords":[` +
+		`{"timeUnixNano":"1136214245067890000","observedTimeUnixNano":"1136214245067890000","severityNumber":5,"severityText":"DEBUG","body":{"stringValue":"debug"},"attributes":[{"key":"code.filepath","value":{"stringValue":"otlp_test.go"}},{"key":"code.lineno","value":{"intValue":"NNN"}},{"key":"count","value":{"intValue":"2"}}]}` +
+		`]}]}]}`
+	if actual, expected := normalize(t, requests[1]), normalize(t, expected); actual != expected {
+		t.Errorf("unexpected second request:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	c := &collector{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	var errs []error
+	exporter := NewHTTPExporter(server.URL+"/v1/logs",
+		Header("Authorization", "Bearer token"),
+		FlushInterval(0),
+		ErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	exporter.Logger().Info("hello")
+	exporter.Flush()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "503 Service Unavailable") {
+		t.Errorf("expected one error about the status, got: %v", errs)
+	}
+	// The record was dropped.
+	require.NoError(t, exporter.Close())
+}
+
+func TestFileExporter(t *testing.T) {
+	fixedTime(t)
+	var buffer bytes.Buffer
+	exporter := NewFileExporter(&buffer, ServiceName("app"), FlushInterval(0))
+	exporter.Logger().Info("one")
+	exporter.Flush()
+	exporter.Logger().Info("two")
+	require.NoError(t, exporter.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two lines, got:\n%s", buffer.String())
+	}
+	for i, msg := range []string{"one", "two"} {
+		var request exportRequest
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &request))
+		body := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0].Body.StringValue
+		if body == nil || *body != msg {
+			t.Errorf("expected %q in line #%d, got:\n%s", msg, i, lines[i])
+		}
+	}
+}
+
+func TestMaxQueueSize(t *testing.T) {
+	var buffer bytes.Buffer
+	var errs []error
+	exporter := NewFileExporter(&buffer, FlushInterval(0), BatchSize(10), MaxQueueSize(2),
+		ErrorHandler(func(err error) { errs = append(errs, err) }),
+	)
+	for i := 0; i < 5; i++ {
+		exporter.Logger().Info("hello")
+	}
+	if dropped := exporter.Dropped(); dropped != 3 {
+		t.Errorf("expected 3 dropped records, got %d", dropped)
+	}
+	exporter.Flush()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "dropped 3 log records") {
+		t.Errorf("expected one error about dropped records, got: %v", errs)
+	}
+
+	// There is space again after exporting.
+	exporter.Logger().Info("hello")
+	require.NoError(t, exporter.Close())
+	if dropped := exporter.Dropped(); dropped != 3 {
+		t.Errorf("expected still 3 dropped records, got %d", dropped)
+	}
+	if actual := strings.Count(buffer.String(), `"body":{"stringValue":"hello"}`); actual != 3 {
+		t.Errorf("expected 3 exported records, got %d:\n%s", actual, buffer.String())
+	}
+}
+
+func TestDefaultClientTimeout(t *testing.T) {
+	e := newExporter(nil)
+	if e.config.client.Timeout <= 0 {
+		t.Error("default HTTP client has no timeout")
+	}
+}
+
+func TestPlogBackend(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	exporter := NewHTTPExporter(server.URL+"/v1/logs", Header("Authorization", "Bearer token"), FlushInterval(0))
+	defer exporter.Close()
+	plog.SetLoggerWithOptions(exporter.Logger(), plog.FlushLogger(exporter.Flush))
+	defer plog.ClearLogger()
+
+	plog.InfoS("structured", "a", 1)
+	plog.Info("unstructured")
+	plog.Flush()
+
+	requests := c.get()
+	if len(requests) != 1 {
+		t.Fatalf("expected one export request, got %d: %q", len(requests), requests)
+	}
+	var request exportRequest
+	require.NoError(t, json.Unmarshal([]byte(requests[0]), &request))
+	records := request.ResourceLogs[0].ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("expected two records, got: %s", requests[0])
+	}
+	for i, msg := range []string{"structured", "unstructured"} {
+		if body := records[i].Body.StringValue; body == nil || *body != msg {
+			t.Errorf("expected %q in record #%d, got: %s", msg, i, requests[0])
+		}
+		// The caller must be this test, not some plog code.
+		if file := records[i].Attributes[0].Value.StringValue; file == nil || !strings.HasSuffix(*file, "/otlp_test.go") {
+			t.Errorf("expected otlp_test.go as caller of record #%d, got: %s", i, requests[0])
+		}
+	}
+}
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestToValue(t *testing.T) {
+	var nilPointer *int
+	one := 1
+	for name, tc := range map[string]struct {
+		value    interface{}
+		expected string
+	}{
+		"nil":      {value: nil, expected: `{}`},
+		"string":   {value: "hello", expected: `{"stringValue":"hello"}`},
+		"uint":     {value: uint64(math.MaxUint64), expected: `{"stringValue":"18446744073709551615"}`},
+		"float":    {value: 1.5, expected: `{"doubleValue":1.5}`},
+		"nan":      {value: math.NaN(), expected: `{"stringValue":"NaN"}`},
+		"bytes":    {value: []byte("hi"), expected: `{"bytesValue":"aGk="}`},
+		"stringer": {value: stringer{}, expected: `{"stringValue":"stringer"}`},
+		"pointer":  {value: &one, expected: `{"intValue":"1"}`},
+		"nil-ptr":  {value: nilPointer, expected: `{}`},
+		"struct":   {value: struct{ A int }{A: 1}, expected: `{"stringValue":"{A:1}"}`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual, err := json.Marshal(toValue(tc.value, 0))
+			require.NoError(t, err)
+			if string(actual) != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// Logger returns a logger which adds log records to the exporter.
+func (e *Exporter) Logger() logr.Logger {
+	return logr.New(&sink{exporter: e})
+}
+
+type sink struct {
+	exporter  *Exporter
+	name      string
+	values    []interface{}
+	callDepth int
+}
+
+var _ logr.LogSink = &sink{}
+var _ logr.CallDepthLogSink = &sink{}
+
+func (s *sink) Init(info logr.RuntimeInfo) {
+	s.callDepth = info.CallDepth
+}
+
+func (s *sink) Enabled(level int) bool {
+	return level <= s.exporter.config.verbosity
+}
+
+func (s *sink) Info(level int, msg string, keysAndValues ...interface{}) {
+	// Skip Info and logr.Logger.Info.
+	_, file, line, _ := runtime.Caller(s.callDepth + 1)
+	severity, text := severityInfo, "INFO"
+	if level > 0 {
+		severity, text = severityInfo-level, "DEBUG"
+		if severity < severityDebug {
+			severity = severityDebug
+		}
+	}
+	s.exporter.add(s.record(file, line, severity, text, nil, msg, keysAndValues))
+}
+
+func (s *sink) Error(err error, msg string, keysAndValues ...interface{}) {
+	_, file, line, _ := runtime.Caller(s.callDepth + 1)
+	s.exporter.add(s.record(file, line, severityError, "ERROR", err, msg, keysAndValues))
+}
+
+// record converts a log call into a record of the log data model.
+func (s *sink) record(file string, line int, severity int, text string, err error, msg string, keysAndValues []interface{}) logRecord {
+	now := strconv.FormatInt(timeNow().UnixNano(), 10)
+	record := logRecord{
+		TimeUnixNano:         now,
+		ObservedTimeUnixNano: now,
+		SeverityNumber:       severity,
+		SeverityText:         text,
+		Body:                 stringValue(msg),
+	}
+	kvs := make([]interface{}, 0, 8+len(s.values)+len(keysAndValues))
+	if s.name != "" {
+		kvs = append(kvs, "logger", s.name)
+	}
+	if err != nil {
+		kvs = append(kvs, "exception.message", err.Error())
+	}
+	if file != "" {
+		kvs = append(kvs, "code.filepath", file, "code.lineno", line)
+	}
+	kvs = append(kvs, s.values...)
+	kvs = append(kvs, keysAndValues...)
+
+	attributes := toAttributes(kvs)
+	filtered := attributes[:0]
+	for _, kv := range attributes {
+		switch kv.Key {
+		case "trace_id", "traceID", "traceId":
+			if id := hexID(kv.Value, 16); id != "" {
+				record.TraceID = id
+				continue
+			}
+		case "span_id", "spanID", "spanId":
+			if id := hexID(kv.Value, 8); id != "" {
+				record.SpanID = id
+				continue
+			}
+		}
+		filtered = append(filtered, kv)
+	}
+	record.Attributes = filtered
+	return record
+}
+
+// hexID returns the value in lower case if it is a string with the hex
+// encoding of a non-zero ID with the given number of bytes, otherwise the
+// empty string.
+func hexID(value anyValue, size int) string {
+	if value.StringValue == nil || len(*value.StringValue) != 2*size {
+		return ""
+	}
+	id := strings.ToLower(*value.StringValue)
+	zero := true
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			zero = false
+		default:
+			return ""
+		}
+	}
+	if zero {
+		return ""
+	}
+	return id
+}
+
+func (s *sink) WithName(name string) logr.LogSink {
+	clone := *s
+	if s.name != "" {
+		clone.name = s.name + "." + name
+	} else {
+		clone.name = name
+	}
+	return &clone
+}
+
+func (s *sink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	clone := *s
+	clone.values = append(clone.values[:len(clone.values):len(clone.values)], keysAndValues...)
+	return &clone
+}
+
+func (s *sink) WithCallDepth(depth int) logr.LogSink {
+	clone := *s
+	clone.callDepth += depth
+	return &clone
+}
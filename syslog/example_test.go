@@ -0,0 +1,37 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog_test
+
+import (
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/syslog"
+)
+
+func ExampleDial() {
+	// Connect to the local syslog daemon.
+	writer, err := syslog.Dial("", "", syslog.Facility(3))
+	if err != nil {
+		panic(err)
+	}
+	defer writer.Close()
+
+	// All log entries get written to the INFO output, with the severity
+	// letter that identifies the actual severity.
+	plog.LogToStderr(false)
+	plog.SetOutputBySeverity("INFO", writer)
+	plog.InfoS("hello world", "answer", 42)
+}
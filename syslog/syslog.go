@@ -0,0 +1,380 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package syslog provides a writer which sends log entries in the klog text
+// format to a syslog daemon as RFC 5424 messages. It can be used wherever an
+// io.Writer is accepted, for example with plog.SetOutput,
+// plog.SetOutputBySeverity or textlogger.Output.
+//
+// Each call to Write must contain exactly one log entry, which is how plog
+// and textlogger write their output. The severity letter of the klog header
+// gets mapped to the syslog severity, the message becomes the MSG part and
+// the key/value pairs become SD-PARAMs, together with the "caller". The time
+// stamp of the message is the one from the klog header, in local time unless
+// the header includes the time zone (-klog_header_rfc3339). Entries without
+// header get the current time.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// Writer sends log entries to a syslog daemon. Datagram sockets get one
+// message per packet, stream sockets use octet counting as defined in RFC
+// 6587. A Writer is safe for concurrent use.
+type Writer struct {
+	network string
+	address string
+	config  config
+
+	mu   sync.Mutex
+	conn net.Conn
+	// stream is true if messages need octet counting.
+	stream bool
+}
+
+type config struct {
+	facility int
+	hostname string
+	appName  string
+	sdID     string
+	maxSize  int
+}
+
+// Option implements functional parameters for Dial.
+type Option func(*config)
+
+// Facility overrides the default facility 1 (user-level messages). Other
+// common values are 3 (system daemons) and 16 to 23 (local use 0 to 7).
+func Facility(facility int) Option {
+	return func(c *config) {
+		c.facility = facility
+	}
+}
+
+// Hostname overrides the name of the local machine in the HOSTNAME field.
+func Hostname(name string) Option {
+	return func(c *config) {
+		c.hostname = name
+	}
+}
+
+// AppName overrides the base name of the program in the APP-NAME field.
+func AppName(name string) Option {
+	return func(c *config) {
+		c.appName = name
+	}
+}
+
+// StructuredDataID overrides the default "plog@32473" as SD-ID of the
+// element which contains the key/value pairs. 32473 is the private
+// enterprise number reserved for documentation, so programs should use the
+// number of their own organization.
+func StructuredDataID(id string) Option {
+	return func(c *config) {
+		c.sdID = id
+	}
+}
+
+// MaxSize overrides the default maximum size of 2048 bytes per message,
+// the size that all receivers should support according to RFC 5424. If a
+// message is too large, SD-PARAMs get dropped from the end until it fits.
+// If that is not enough, the MSG part gets truncated. Zero disables the
+// limit.
+func MaxSize(size int) Option {
+	return func(c *config) {
+		c.maxSize = size
+	}
+}
+
+// timeNow can be replaced by tests.
+var timeNow = time.Now
+
+// localPaths are the sockets which are tried for the local syslog daemon.
+var localPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Dial connects to a syslog daemon. The network and address have the same
+// meaning as for net.Dial. If the network is empty, the local syslog daemon
+// is used.
+func Dial(network, address string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		network: network,
+		address: address,
+		config: config{
+			facility: 1,
+			hostname: hostname(),
+			appName:  filepath.Base(os.Args[0]),
+			sdID:     "plog@32473",
+			maxSize:  2048,
+		},
+	}
+	for _, opt := range opts {
+		opt(&w.config)
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return h
+}
+
+var errClosed = errors.New("syslog writer is closed")
+
+// Write is part of the io.Writer interface. It sends one log entry. If
+// sending fails, it reconnects once and tries again.
+func (w *Writer) Write(p []byte) (int, error) {
+	msg := w.format(textparser.Parse(p))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return 0, errClosed
+	}
+	if err := w.send(msg); err != nil {
+		_ = w.conn.Close() // ignore err
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+		if err := w.send(msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the connection. Writing is not possible afterwards.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return errClosed
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// connect establishes a new connection.
+// w.mu is held, if needed.
+func (w *Writer) connect() error {
+	if w.network != "" {
+		conn, err := net.Dial(w.network, w.address)
+		if err != nil {
+			return fmt.Errorf("syslog: unable to connect: %v", err)
+		}
+		w.conn = conn
+		w.stream = isStream(w.network)
+		return nil
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range localPaths {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				w.conn = conn
+				w.stream = isStream(network)
+				return nil
+			}
+		}
+	}
+	return errors.New("syslog: unable to connect to the local syslog daemon")
+}
+
+func isStream(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	default:
+		return true
+	}
+}
+
+// send writes one message with the framing required by the connection.
+// w.mu is held.
+func (w *Writer) send(msg []byte) error {
+	if w.stream {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	_, err := w.conn.Write(msg)
+	return err
+}
+
+// syslogSeverity maps plog severities to syslog severities.
+var syslogSeverity = [...]int{
+	textparser.SeverityInfo:    6, // informational
+	textparser.SeverityWarning: 4, // warning
+	textparser.SeverityError:   3, // error
+	textparser.SeverityFatal:   2, // critical
+}
+
+// utf8BOM marks the MSG part as UTF-8. It is only needed for non-ASCII
+// messages.
+const utf8BOM = "\xef\xbb\xbf"
+
+// format creates an RFC 5424 message for the entry.
+func (w *Writer) format(r textparser.Record) []byte {
+	var b bytes.Buffer
+	b.WriteByte('<')
+	b.WriteString(strconv.Itoa(w.config.facility*8 + syslogSeverity[r.Severity]))
+	b.WriteString(">1 ")
+	now := r.Time
+	if !r.HasHeader || now.IsZero() {
+		now = timeNow()
+	}
+	b.WriteString(now.Format("2006-01-02T15:04:05.000000Z07:00"))
+	b.WriteByte(' ')
+	writeHeaderField(&b, w.config.hostname, 255)
+	b.WriteByte(' ')
+	writeHeaderField(&b, w.config.appName, 48)
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(os.Getpid()))
+	b.WriteString(" - ")
+
+	// Each SD-PARAM gets formatted separately so that they can be
+	// dropped from the end when the message is too large.
+	var params []string
+	if r.HasHeader {
+		params = append(params, formatParam("caller", r.File+":"+strconv.Itoa(r.Line)))
+	}
+	for _, kv := range r.Values {
+		params = append(params, formatParam(kv.Key, kv.Value))
+	}
+	msg := r.Message
+	prefix := ""
+	if msg != "" {
+		prefix = " "
+		for i := 0; i < len(msg); i++ {
+			if msg[i] >= utf8.RuneSelf {
+				prefix = " " + utf8BOM
+				break
+			}
+		}
+	}
+
+	if maxSize := w.config.maxSize; maxSize > 0 {
+		size := b.Len() + sdLen(w.config.sdID, params) + len(prefix) + len(msg)
+		for size > maxSize && len(params) > 0 {
+			params = params[:len(params)-1]
+			size = b.Len() + sdLen(w.config.sdID, params) + len(prefix) + len(msg)
+		}
+		if size > maxSize {
+			msg = truncate(msg, len(msg)-(size-maxSize))
+		}
+	}
+
+	if len(params) == 0 {
+		b.WriteByte('-')
+	} else {
+		b.WriteByte('[')
+		b.WriteString(w.config.sdID)
+		for _, param := range params {
+			b.WriteString(param)
+		}
+		b.WriteByte(']')
+	}
+	if msg != "" {
+		b.WriteString(prefix)
+		b.WriteString(msg)
+	}
+	return b.Bytes()
+}
+
+// sdLen returns the size of the STRUCTURED-DATA part.
+func sdLen(id string, params []string) int {
+	if len(params) == 0 {
+		return 1
+	}
+	size := len(id) + 2
+	for _, param := range params {
+		size += len(param)
+	}
+	return size
+}
+
+// truncate cuts off the string after at most size bytes without splitting
+// a UTF-8 character.
+func truncate(s string, size int) string {
+	if size <= 0 {
+		return ""
+	}
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size]
+}
+
+// writeHeaderField writes a header field which must consist of printable
+// US-ASCII characters. Other characters get replaced with an underscore and
+// an empty field with the NILVALUE.
+func writeHeaderField(b *bytes.Buffer, value string, maxLen int) {
+	if value == "" {
+		b.WriteByte('-')
+		return
+	}
+	for i := 0; i < len(value) && i < maxLen; i++ {
+		c := value[i]
+		if c < '!' || c > '~' {
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+}
+
+// formatParam formats one SD-PARAM with a leading space. Characters which
+// are not allowed in the name get replaced with an underscore, the name is
+// limited to 32 characters.
+func formatParam(name, value string) string {
+	var b strings.Builder
+	b.WriteByte(' ')
+	if name == "" {
+		b.WriteByte('_')
+	}
+	for i := 0; i < len(name) && i < 32; i++ {
+		c := name[i]
+		if c < '!' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+	b.WriteString(`="`)
+	for _, r := range strings.ToValidUTF8(value, string(utf8.RuneError)) {
+		switch r {
+		case '"', '\\', ']':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pohly/plog/v2"
+	"github.com/pohly/plog/v2/internal/test/require"
+	"github.com/pohly/plog/v2/textlogger"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+func fixedTime(t *testing.T) {
+	t.Cleanup(func() { timeNow = time.Now })
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	fixedTime(t)
+	header := func(pri int) string {
+		return "<" + strconv.Itoa(pri) + ">1 2006-01-02T15:04:05.067890Z host app " + strconv.Itoa(os.Getpid()) + " - "
+	}
+	for name, tc := range map[string]struct {
+		opts     []Option
+		text     string
+		expected string
+	}{
+		"info": {
+			text:     `I0102 15:04:05.067890    1234 main.go:42] "hello" a=1` + "\n",
+			expected: header(14) + `[plog@32473 caller="main.go:42" a="1"] hello`,
+		},
+		"error": {
+			opts:     []Option{Facility(16), StructuredDataID("app@12345")},
+			text:     `E0102 15:04:05.067890    1234 main.go:42] "oops" err="fail"` + "\n",
+			expected: header(16*8+3) + `[app@12345 caller="main.go:42" err="fail"] oops`,
+		},
+		"escaping": {
+			text:     `W0102 15:04:05.067890    1234 main.go:42] "hello" my]key="a\"b\\c]d"` + "\n",
+			expected: header(12) + `[plog@32473 caller="main.go:42" my_key="a\"b\\c\]d"] hello`,
+		},
+		"utf-8": {
+			text:     `I0102 15:04:05.067890    1234 main.go:42] "grüße"` + "\n",
+			expected: header(14) + `[plog@32473 caller="main.go:42"] ` + utf8BOM + "grüße",
+		},
+		"no-sd": {
+			text:     "hello\n",
+			expected: header(14) + "- hello",
+		},
+		"drop-params": {
+			opts:     []Option{MaxSize(len(header(14)) + len(`[plog@32473 caller="main.go:42"] hello`))},
+			text:     `I0102 15:04:05.067890    1234 main.go:42] "hello" a=1 b=2` + "\n",
+			expected: header(14) + `[plog@32473 caller="main.go:42"] hello`,
+		},
+		"truncate-msg": {
+			opts:     []Option{MaxSize(len(header(14)) + len(`- `+utf8BOM+"grü") - 1)},
+			text:     `I0102 15:04:05.067890    1234 main.go:42] "grüße" a=1` + "\n",
+			expected: header(14) + "- " + utf8BOM + "gr",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := &Writer{config: config{
+				facility: 1,
+				hostname: "host",
+				appName:  "app",
+				sdID:     "plog@32473",
+				maxSize:  2048,
+			}}
+			for _, opt := range tc.opts {
+				opt(&w.config)
+			}
+			actual := string(w.format(textparser.Parse([]byte(tc.text), textparser.Year(2006), textparser.Location(time.UTC))))
+			if actual != tc.expected {
+				t.Errorf("unexpected message:\n%q\nexpected:\n%q", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestUnixgram(t *testing.T) {
+	fixedTime(t)
+	// The path of a unix domain socket must be short.
+	dir, err := os.MkdirTemp("", "syslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	defer server.Close()
+
+	w, err := Dial("unixgram", path, Hostname("host"), AppName("app"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	// The time stamp comes from the header, not from the time of sending.
+	// The year of the header is assumed to be the current one.
+	ts := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	logger := textlogger.NewLogger(textlogger.NewConfig(textlogger.Output(w), textlogger.FixedTime(ts)))
+	logger.WithName("foo").Error(errors.New("fail"), "oops", "a", 1)
+	logger.Info("hello")
+
+	re := regexp.MustCompile(`syslog_test.go:[0-9]+`)
+	buffer := make([]byte, 4096)
+	for _, expected := range []string{
+		`<11>1 %s host app %d - [plog@32473 caller="syslog_test.go:NNN" err="fail" logger="foo" a="1"] oops`,
+		`<14>1 %s host app %d - [plog@32473 caller="syslog_test.go:NNN"] hello`,
+	} {
+		n, err := server.Read(buffer)
+		require.NoError(t, err)
+		actual := re.ReplaceAllString(string(buffer[:n]), "syslog_test.go:NNN")
+		if expected := fmt.Sprintf(expected, ts.Local().Format("2006-01-02T15:04:05.000000Z07:00"), os.Getpid()); actual != expected {
+			t.Errorf("unexpected message:\n%s\nexpected:\n%s", actual, expected)
+		}
+	}
+}
+
+func TestTCP(t *testing.T) {
+	fixedTime(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	messages := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			// Octet counting: MSG-LEN SP SYSLOG-MSG
+			size, err := r.ReadString(' ')
+			if err != nil {
+				close(messages)
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSuffix(size, " "))
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				close(messages)
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+
+	w, err := Dial("tcp", listener.Addr().String(), Hostname("host"), AppName("app"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	state := plog.CaptureState()
+	defer state.Restore()
+	plog.LogToStderr(false)
+	plog.SetOutputBySeverity("INFO", w)
+	start := time.Now().Truncate(time.Microsecond)
+	plog.InfoS("hello", "a", 1)
+	plog.Warning("careful")
+	end := time.Now()
+
+	re := regexp.MustCompile(`syslog_test.go:[0-9]+`)
+	tsRe := regexp.MustCompile(`^(<[0-9]+>1) ([^ ]+)`)
+	for _, expected := range []string{
+		`<14>1 TS host app %d - [plog@32473 caller="syslog_test.go:NNN" a="1"] hello`,
+		`<12>1 TS host app %d - [plog@32473 caller="syslog_test.go:NNN"] careful`,
+	} {
+		actual := re.ReplaceAllString(<-messages, "syslog_test.go:NNN")
+		// The time stamp comes from the header, not from timeNow.
+		if m := tsRe.FindStringSubmatch(actual); m != nil {
+			ts, err := time.Parse(time.RFC3339Nano, m[2])
+			require.NoError(t, err)
+			if ts.Before(start) || ts.After(end) {
+				t.Errorf("time stamp %s not between %s and %s", ts, start, end)
+			}
+			actual = tsRe.ReplaceAllString(actual, "$1 TS")
+		}
+		if expected := fmt.Sprintf(expected, os.Getpid()); actual != expected {
+			t.Errorf("unexpected message:\n%s\nexpected:\n%s", actual, expected)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package textlogger_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	internal "github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func TestColors(t *testing.T) {
+	ts, _ := time.Parse(time.RFC3339, "2000-12-24T12:30:40Z")
+	for mode, expected := range map[textlogger.ColorMode]string{
+		textlogger.ColorNever:  `E1224 12:30:40.000000     123 color_test.go:NNN] "An error" err="fake error" logger="example" a=1` + "\n",
+		textlogger.ColorAuto:   `E1224 12:30:40.000000     123 color_test.go:NNN] "An error" err="fake error" logger="example" a=1` + "\n",
+		textlogger.ColorAlways: "\x1b[31mE\x1b[0m1224 12:30:40.000000     123 color_test.go:NNN] \"An error\" \x1b[31merr\x1b[0m=\x1b[31m\"fake error\"\x1b[0m \x1b[36mlogger\x1b[0m=\x1b[2m\"example\"\x1b[0m \x1b[36ma\x1b[0m=1\n",
+	} {
+		t.Run(string(mode), func(t *testing.T) {
+			internal.Pid = 123
+			var buffer bytes.Buffer
+			config := textlogger.NewConfig(
+				textlogger.FixedTime(ts),
+				textlogger.Colors(mode),
+				// Not a terminal, so ColorAuto disables colors.
+				textlogger.Output(&buffer),
+			)
+			logger := textlogger.NewLogger(config)
+			logger.WithName("example").Error(errors.New("fake error"), "An error", "a", 1)
+
+			actual := regexp.MustCompile(`color_test.go:[0-9]+`).ReplaceAllString(buffer.String(), "color_test.go:NNN")
+			if actual != expected {
+				t.Errorf("unexpected output:\n%q\nexpected:\n%q", actual, expected)
+			}
+		})
+	}
+}
@@ -48,3 +48,26 @@ func ExampleConfig_Verbosity() {
 	// I...] "initial verbosity" v="1"
 	// I...] "now you see me"
 }
+
+func ExampleConfig_VLogger() {
+	var buffer bytes.Buffer
+	config := textlogger.NewConfig(textlogger.Output(&buffer))
+	if err := config.VLogger().Set("controller=2,*.cache=3"); err != nil {
+		panic(err)
+	}
+	logger := textlogger.NewLogger(config)
+	controller := logger.WithName("controller")
+
+	logger.V(2).Info("not shown, no name")
+	controller.V(2).Info("shown for controller")
+	controller.WithName("leader-election").V(2).Info("shown for children of controller")
+	controller.V(3).Info("not shown, level too high")
+	logger.WithName("store").WithName("cache").V(3).Info("shown for store.cache")
+
+	fmt.Print(headerRe.ReplaceAllString(buffer.String(), "${1}...] "))
+
+	// Output:
+	// I...] "shown for controller" logger="controller"
+	// I...] "shown for children of controller" logger="controller.leader-election"
+	// I...] "shown for store.cache" logger="store.cache"
+}
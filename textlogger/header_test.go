@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package textlogger_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	internal "github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/textlogger"
+)
+
+func TestHeader(t *testing.T) {
+	ts := time.Date(2000, 12, 24, 12, 30, 40, 123456789, time.FixedZone("CET", 60*60))
+	for name, tc := range map[string]struct {
+		opts     []textlogger.ConfigOption
+		expected string
+	}{
+		"default": {
+			expected: `I1224 12:30:40.123456     123 header_test.go:NNN] "hello"` + "\n",
+		},
+		"rfc3339": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderRFC3339(true)},
+			expected: `I2000-12-24T12:30:40.123456+01:00     123 header_test.go:NNN] "hello"` + "\n",
+		},
+		"rfc3339-utc-ms": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderRFC3339(true), textlogger.HeaderUTC(true), textlogger.HeaderPrecision(textlogger.PrecisionMilliseconds)},
+			expected: `I2000-12-24T11:30:40.123Z     123 header_test.go:NNN] "hello"` + "\n",
+		},
+		"ns": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderPrecision(textlogger.PrecisionNanoseconds)},
+			expected: `I1224 12:30:40.123456789     123 header_test.go:NNN] "hello"` + "\n",
+		},
+		"dir": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderPath(textlogger.PathDir)},
+			expected: `I1224 12:30:40.123456     123 textlogger/header_test.go:NNN] "hello"` + "\n",
+		},
+		"module": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderPath(textlogger.PathModule)},
+			expected: `I1224 12:30:40.123456     123 textlogger/header_test.go:NNN] "hello"` + "\n",
+		},
+		"module-with-backtrace": {
+			// Without the function name, the base name is used.
+			opts: []textlogger.ConfigOption{
+				textlogger.HeaderPath(textlogger.PathModule),
+				textlogger.Backtrace(func(int) (string, int) { return "/src/pkg/file.go", 42 }),
+			},
+			expected: `I1224 12:30:40.123456     123 file.go:42] "hello"` + "\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			internal.Pid = 123
+			var buffer bytes.Buffer
+			opts := append([]textlogger.ConfigOption{textlogger.FixedTime(ts), textlogger.Output(&buffer)}, tc.opts...)
+			logger := textlogger.NewLogger(textlogger.NewConfig(opts...))
+			logger.Info("hello")
+
+			actual := regexp.MustCompile(`header_test.go:[0-9]+`).ReplaceAllString(buffer.String(), "header_test.go:NNN")
+			if actual != tc.expected {
+				t.Errorf("unexpected output:\n%q\nexpected:\n%q", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestHeaderThreadID(t *testing.T) {
+	ts := time.Date(2000, 12, 24, 12, 30, 40, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		opts     []textlogger.ConfigOption
+		expected *regexp.Regexp
+	}{
+		"pid": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderThreadIDWidth(3)},
+			expected: regexp.MustCompile(`^I1224 12:30:40.000000 123 header_test.go:[0-9]+\] "hello"\n$`),
+		},
+		"tid": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderThreadID(textlogger.ThreadIDTid)},
+			expected: regexp.MustCompile(`^I1224 12:30:40.000000 [ 0-9]{7,} header_test.go:[0-9]+\] "hello"\n$`),
+		},
+		"goroutine": {
+			opts:     []textlogger.ConfigOption{textlogger.HeaderThreadID(textlogger.ThreadIDGoroutine), textlogger.HeaderThreadIDWidth(12)},
+			expected: regexp.MustCompile(`^I1224 12:30:40.000000 {4,}[0-9]+ header_test.go:[0-9]+\] "hello"\n$`),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			internal.Pid = 123
+			var buffer bytes.Buffer
+			opts := append([]textlogger.ConfigOption{textlogger.FixedTime(ts), textlogger.Output(&buffer)}, tc.opts...)
+			logger := textlogger.NewLogger(textlogger.NewConfig(opts...))
+			logger.Info("hello")
+
+			if actual := buffer.String(); !tc.expected.MatchString(actual) {
+				t.Errorf("unexpected output:\n%q", actual)
+			}
+		})
+	}
+}
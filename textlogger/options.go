@@ -23,6 +23,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/color"
+	"github.com/pohly/plog/v2/internal/sourcepath"
 	"github.com/pohly/plog/v2/internal/verbosity"
 )
 
@@ -34,6 +37,8 @@ import (
 type Config struct {
 	vstate *verbosity.VState
 	co     configOptions
+	// colors is determined by NewConfig based on the color mode.
+	colors bool
 }
 
 // Verbosity returns a value instance that can be used to query (via String) or
@@ -50,16 +55,43 @@ func (c *Config) VModule() flag.Value {
 	return c.vstate.VModule()
 }
 
+// VLogger returns a value instance that can be used to query (via String) or
+// modify (via Set) the per-logger verbosity levels. This is thread-safe and
+// can be done at runtime.
+//
+// The syntax is a comma-separated list of name=N. A name matches the name
+// of a logger as set with WithName, where the elements added by nested
+// WithName calls are separated by dots. It also matches all loggers derived
+// from a matching logger. Each element may use filepath.Match patterns.
+// For example, "controller=4,*.cache=3" enables V(4) in a logger named
+// "controller" and in "controller.leader-election", and V(3) in
+// "store.cache".
+func (c *Config) VLogger() flag.Value {
+	return c.vstate.VLogger()
+}
+
+// BoostVerbosity temporarily raises the verbosity in the same way as
+// plog.BoostVerbosity, on top of Verbosity and VModule. The vmodule
+// patterns use the same syntax as VModule and may be empty.
+func (c *Config) BoostVerbosity(level int, vmodule string, duration time.Duration) (cancel func(), err error) {
+	return c.vstate.Boost(verbosity.Level(level), vmodule, duration)
+}
+
 // ConfigOption implements functional parameters for NewConfig.
 type ConfigOption func(co *configOptions)
 
 type configOptions struct {
 	verbosityFlagName string
 	vmoduleFlagName   string
+	vloggerFlagName   string
 	verbosityDefault  int
 	fixedTime         *time.Time
 	unwind            func(int) (string, int)
 	output            io.Writer
+	format            Format
+	colorMode         ColorMode
+	headerOptions     buffer.HeaderOptions
+	pathMode          PathMode
 }
 
 // VerbosityFlagName overrides the default -v for the verbosity level.
@@ -78,6 +110,14 @@ func VModuleFlagName(name string) ConfigOption {
 	}
 }
 
+// VLoggerFlagName overrides the default -vlogger for the per-logger
+// verbosity levels.
+func VLoggerFlagName(name string) ConfigOption {
+	return func(co *configOptions) {
+		co.vloggerFlagName = name
+	}
+}
+
 // Verbosity overrides the default verbosity level of 0.
 // See https://github.com/kubernetes/community/blob/9406b4352fe2d5810cb21cc3cb059ce5886de157/contributors/devel/sig-instrumentation/logging.md#logging-conventions
 // for log level conventions in Kubernetes.
@@ -87,13 +127,172 @@ func Verbosity(level int) ConfigOption {
 	}
 }
 
-// Output overrides stderr as the output stream.
+// Output overrides stderr as the output stream. Use a logfile.Writer
+// for writing to a log file with rotation. The caller is responsible for
+// flushing and closing it.
 func Output(output io.Writer) ConfigOption {
 	return func(co *configOptions) {
 		co.output = output
 	}
 }
 
+// Format selects how a text logger formats log entries.
+type Format string
+
+const (
+	// FormatText is the klog text format. This is the default.
+	FormatText Format = "text"
+
+	// FormatLogfmt writes one line per log entry with key=value pairs,
+	// without the klog header. The well-known keys are "ts" (time stamp in
+	// RFC 3339 format with microseconds), "level" (info, warning, error,
+	// fatal), "v" (verbosity of info messages), "caller" (file:line),
+	// "msg", "err" and "logger" (the logger name). Values are quoted when
+	// needed and complex values are serialized as JSON.
+	FormatLogfmt Format = "logfmt"
+)
+
+// OutputFormat overrides the default FormatText.
+func OutputFormat(format Format) ConfigOption {
+	return func(co *configOptions) {
+		co.format = format
+	}
+}
+
+// ColorMode determines whether a text logger uses ANSI colors.
+type ColorMode string
+
+const (
+	// ColorNever disables colors. This is the default.
+	ColorNever ColorMode = color.Never
+
+	// ColorAuto enables colors if the output is a terminal and the
+	// NO_COLOR environment variable is empty.
+	ColorAuto ColorMode = color.Auto
+
+	// ColorAlways enables colors unconditionally.
+	ColorAlways ColorMode = color.Always
+)
+
+// Colors overrides the default ColorNever. When enabled, the severity letter
+// and keys are highlighted, errors are shown in red and logger names are
+// dimmed. Colors are only used in FormatText.
+func Colors(mode ColorMode) ConfigOption {
+	return func(co *configOptions) {
+		co.colorMode = mode
+	}
+}
+
+// TimePrecision determines how many digits of the fractions of a second are
+// shown in the header.
+type TimePrecision string
+
+const (
+	// PrecisionMilliseconds shows three digits.
+	PrecisionMilliseconds TimePrecision = "ms"
+
+	// PrecisionMicroseconds shows six digits. This is the default.
+	PrecisionMicroseconds TimePrecision = "us"
+
+	// PrecisionNanoseconds shows nine digits.
+	PrecisionNanoseconds TimePrecision = "ns"
+)
+
+// HeaderRFC3339 replaces "mmdd hh:mm:ss.uuuuuu" in the header of FormatText
+// with a time stamp in RFC 3339 format, which includes the year and the time
+// zone.
+func HeaderRFC3339(enabled bool) ConfigOption {
+	return func(co *configOptions) {
+		co.headerOptions.RFC3339 = enabled
+	}
+}
+
+// HeaderUTC converts the time stamp in the header of FormatText to UTC
+// instead of local time.
+func HeaderUTC(enabled bool) ConfigOption {
+	return func(co *configOptions) {
+		co.headerOptions.UTC = enabled
+	}
+}
+
+// HeaderPrecision overrides the default PrecisionMicroseconds for the time
+// stamp in the header of FormatText.
+func HeaderPrecision(precision TimePrecision) ConfigOption {
+	return func(co *configOptions) {
+		switch precision {
+		case PrecisionMilliseconds:
+			co.headerOptions.Precision = 3
+		case PrecisionNanoseconds:
+			co.headerOptions.Precision = 9
+		default:
+			co.headerOptions.Precision = 6
+		}
+	}
+}
+
+// PathMode determines how the source file of the call site is shown.
+type PathMode string
+
+const (
+	// PathBase shows only the file name. This is the default.
+	PathBase PathMode = "base"
+
+	// PathDir shows the file name and the directory which contains it.
+	PathDir PathMode = "dir"
+
+	// PathModule shows the path relative to the root of the Go module
+	// which contains the file. Files from the standard library are shown
+	// with their import path. This needs the function name of the call
+	// site and therefore falls back to PathBase when Backtrace is used.
+	PathModule PathMode = "module"
+)
+
+// HeaderPath overrides the default PathBase.
+func HeaderPath(mode PathMode) ConfigOption {
+	return func(co *configOptions) {
+		co.pathMode = mode
+	}
+}
+
+// ThreadIDMode determines what is shown in the thread ID column of the
+// header.
+type ThreadIDMode string
+
+const (
+	// ThreadIDPid shows the process ID. This is the default.
+	ThreadIDPid ThreadIDMode = "pid"
+
+	// ThreadIDTid shows the ID of the operating system thread. This is
+	// only supported on Linux, other platforms show the process ID.
+	ThreadIDTid ThreadIDMode = "tid"
+
+	// ThreadIDGoroutine shows the ID of the goroutine.
+	ThreadIDGoroutine ThreadIDMode = "goroutine"
+)
+
+// HeaderThreadID overrides the default ThreadIDPid for the header of
+// FormatText.
+func HeaderThreadID(mode ThreadIDMode) ConfigOption {
+	return func(co *configOptions) {
+		switch mode {
+		case ThreadIDTid:
+			co.headerOptions.ThreadID = buffer.ThreadIDOS
+		case ThreadIDGoroutine:
+			co.headerOptions.ThreadID = buffer.ThreadIDGoroutine
+		default:
+			co.headerOptions.ThreadID = buffer.ThreadIDPid
+		}
+	}
+}
+
+// HeaderThreadIDWidth overrides the default minimum width of 7 for the thread
+// ID column in the header of FormatText. Longer IDs are not truncated.
+func HeaderThreadIDWidth(width int) ConfigOption {
+	return func(co *configOptions) {
+		co.headerOptions.ThreadIDWidth = width
+	}
+}
+
 // FixedTime overrides the actual time with a fixed time. Useful only for testing.
 //
 // # Experimental
@@ -121,6 +320,18 @@ func Backtrace(unwind func(skip int) (filename string, line int)) ConfigOption {
 	}
 }
 
+// sourcePathMode returns how the source file is shown.
+func (c *Config) sourcePathMode() sourcepath.Mode {
+	switch c.co.pathMode {
+	case PathDir:
+		return sourcepath.Dir
+	case PathModule:
+		return sourcepath.Module
+	default:
+		return sourcepath.Base
+	}
+}
+
 // NewConfig returns a configuration with recommended defaults and optional
 // modifications. Command line flags are not bound to any FlagSet yet.
 func NewConfig(opts ...ConfigOption) *Config {
@@ -129,14 +340,18 @@ func NewConfig(opts ...ConfigOption) *Config {
 		co: configOptions{
 			verbosityFlagName: "v",
 			vmoduleFlagName:   "vmodule",
+			vloggerFlagName:   "vlogger",
 			verbosityDefault:  0,
-			unwind:            runtimeBacktrace,
 			output:            os.Stderr,
+			format:            FormatText,
+			colorMode:         ColorNever,
+			pathMode:          PathBase,
 		},
 	}
 	for _, opt := range opts {
 		opt(&c.co)
 	}
+	c.colors = c.co.format == FormatText && color.Enabled(string(c.co.colorMode), c.co.output)
 
 	// Cannot fail for this input.
 	_ = c.Verbosity().Set(strconv.FormatInt(int64(c.co.verbosityDefault), 10))
@@ -151,4 +366,5 @@ func NewConfig(opts ...ConfigOption) *Config {
 func (c *Config) AddFlags(fs *flag.FlagSet) {
 	fs.Var(c.Verbosity(), c.co.verbosityFlagName, "number for the log level verbosity of the testing logger")
 	fs.Var(c.VModule(), c.co.vmoduleFlagName, "comma-separated list of pattern=N log level settings for files matching the patterns")
+	fs.Var(c.VLogger(), c.co.vloggerFlagName, "comma-separated list of name=N log level settings for loggers matching the names, see Config.VLogger")
 }
@@ -24,14 +24,15 @@ package textlogger
 import (
 	"runtime"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 
 	"github.com/pohly/plog/v2/internal/buffer"
+	"github.com/pohly/plog/v2/internal/color"
 	"github.com/pohly/plog/v2/internal/serialize"
 	"github.com/pohly/plog/v2/internal/severity"
+	"github.com/pohly/plog/v2/internal/sourcepath"
 	"github.com/pohly/plog/v2/internal/verbosity"
 )
 
@@ -47,8 +48,8 @@ const (
 
 // NewLogger constructs a new logger.
 //
-// Verbosity can be modified at any time through the Config.V and
-// Config.VModule API.
+// Verbosity can be modified at any time through the Config.V,
+// Config.VModule and Config.VLogger API.
 func NewLogger(c *Config) logr.Logger {
 	return logr.New(&tlogger{
 		values: nil,
@@ -64,6 +65,14 @@ type tlogger struct {
 	// WithName.
 	hasPrefix bool
 
+	// name is the logger name and caches its -vlogger level. Nil if
+	// WithName was not called.
+	name *verbosity.LoggerName
+
+	// forcedVerbosity is the level set with WithVerbosity. All levels up
+	// to it are enabled.
+	forcedVerbosity int
+
 	values []interface{}
 	groups string
 	config *Config
@@ -80,58 +89,88 @@ func (l *tlogger) WithCallDepth(depth int) logr.LogSink {
 }
 
 func (l *tlogger) Enabled(level int) bool {
+	if level <= l.forcedVerbosity {
+		return true
+	}
+	if l.name != nil && l.config.vstate.LoggerLevel(l.name) >= verbosity.Level(level) {
+		return true
+	}
 	return l.config.vstate.Enabled(verbosity.Level(level), 1+l.callDepth)
 }
 
-func (l *tlogger) Info(_ int, msg string, kvList ...interface{}) {
-	l.print(nil, severity.InfoLog, msg, kvList)
+func (l *tlogger) Info(level int, msg string, kvList ...interface{}) {
+	l.print(nil, severity.InfoLog, level, msg, kvList)
 }
 
 func (l *tlogger) Error(err error, msg string, kvList ...interface{}) {
-	l.print(err, severity.ErrorLog, msg, kvList)
+	l.print(err, severity.ErrorLog, -1, msg, kvList)
 }
 
-func (l *tlogger) print(err error, s severity.Severity, msg string, kvList []interface{}) {
+// print determines the caller and then logs the entry. v is the verbosity of
+// an info message, -1 if not applicable.
+func (l *tlogger) print(err error, s severity.Severity, v int, msg string, kvList []interface{}) {
 	// Determine caller.
 	// +1 for this frame, +1 for Info/Error.
 	skip := l.callDepth + 2
-	file, line := l.config.co.unwind(skip)
+	var function, file string
+	var line int
+	if l.config.co.unwind != nil {
+		file, line = l.config.co.unwind(skip)
+	} else if pc, f, n, ok := runtime.Caller(skip); ok {
+		file, line = f, n
+		if l.config.co.pathMode == PathModule {
+			if fn := runtime.FuncForPC(pc); fn != nil {
+				function = fn.Name()
+			}
+		}
+	}
 	if file == "" {
 		file = "???"
 		line = 1
-	} else if slash := strings.LastIndex(file, "/"); slash >= 0 {
-		file = file[slash+1:]
+	} else {
+		file = sourcepath.Shorten(function, file, l.config.sourcePathMode())
 	}
-	l.printWithInfos(file, line, time.Now(), err, s, msg, kvList)
+	l.printEntry(file, line, time.Now(), err, s, v, msg, kvList)
 }
 
-func runtimeBacktrace(skip int) (string, int) {
-	_, file, line, ok := runtime.Caller(skip + 1)
-	if !ok {
-		return "", 0
-	}
-	return file, line
+func (l *tlogger) printWithInfos(file string, line int, now time.Time, err error, s severity.Severity, msg string, kvList []interface{}) {
+	l.printEntry(file, line, now, err, s, -1, msg, kvList)
 }
 
-func (l *tlogger) printWithInfos(file string, line int, now time.Time, err error, s severity.Severity, msg string, kvList []interface{}) {
+func (l *tlogger) printEntry(file string, line int, now time.Time, err error, s severity.Severity, v int, msg string, kvList []interface{}) {
 	// Only create a new buffer if we don't have one cached.
 	b := buffer.GetBuffer()
 	defer buffer.PutBuffer(b)
 
-	// Format header.
 	if l.config.co.fixedTime != nil {
 		now = *l.config.co.fixedTime
 	}
-	b.FormatHeader(s, file, line, now)
+	if l.config.co.format == FormatLogfmt {
+		serialize.LogfmtHeader(&b.Buffer, now, s, v, file, line, msg)
+		if err != nil {
+			serialize.LogfmtFormat(&b.Buffer, "err", err)
+		}
+		serialize.LogfmtListFormat(&b.Buffer, serialize.MergeKVs(l.values, kvList)...)
+		b.WriteByte('\n')
+		_, _ = l.config.co.output.Write(b.Bytes())
+		return
+	}
+
+	// Format header.
+	b.FormatHeaderWithOptions(s, file, line, now, l.config.co.headerOptions)
+	if l.config.colors {
+		color.Severity(&b.Buffer, 0, s)
+	}
 
 	// The message is always quoted, even if it contains line breaks.
 	// If developers want multi-line output, they should use a small, fixed
 	// message and put the multi-line output into a value.
 	b.WriteString(strconv.Quote(msg))
+	formatter := serialize.Formatter{Colors: l.config.colors}
 	if err != nil {
-		serialize.KVFormat(&b.Buffer, "err", err)
+		formatter.KVListFormat(&b.Buffer, "err", err)
 	}
-	serialize.MergeAndFormatKVs(&b.Buffer, l.values, kvList)
+	formatter.MergeAndFormatKVs(&b.Buffer, l.values, kvList)
 	if b.Len() == 0 || b.Bytes()[b.Len()-1] != '\n' {
 		b.WriteByte('\n')
 	}
@@ -156,6 +195,7 @@ func (l *tlogger) WithName(name string) logr.LogSink {
 		prefix, _ := v[1].(string)
 		v[1] = prefix + "." + name
 		clone.values = v
+		clone.name = verbosity.NewLoggerName(prefix + "." + name)
 	} else {
 		// Preprend new key/value pair.
 		v := make([]interface{}, 0, 2+len(l.values))
@@ -163,10 +203,21 @@ func (l *tlogger) WithName(name string) logr.LogSink {
 		v = append(v, l.values...)
 		clone.values = v
 		clone.hasPrefix = true
+		clone.name = verbosity.NewLoggerName(name)
 	}
 	return &clone
 }
 
+// WithVerbosity returns a new LogSink which is enabled for all levels up to
+// and including the given one. It implements plog.VerbositySink, which is
+// used by plog.FromContext for contexts created with
+// plog.ContextWithVerbosity.
+func (l *tlogger) WithVerbosity(level int) logr.LogSink {
+	clone := *l
+	clone.forcedVerbosity = level
+	return &clone
+}
+
 func (l *tlogger) WithValues(kvList ...interface{}) logr.LogSink {
 	clone := *l
 	clone.values = serialize.WithValues(l.values, kvList)
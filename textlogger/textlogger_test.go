@@ -72,6 +72,30 @@ func ExampleNewLogger() {
 	// I1224 12:30:40.000000     123 textlogger_test.go:65] "hello world"
 }
 
+func ExampleOutputFormat() {
+	ts, _ := time.Parse(time.RFC3339, "2000-12-24T12:30:40Z")
+	config := textlogger.NewConfig(
+		textlogger.FixedTime(ts), // To get consistent output for each run.
+		textlogger.Verbosity(4),
+		textlogger.OutputFormat(textlogger.FormatLogfmt),
+		textlogger.Output(os.Stdout),
+	)
+	logger := textlogger.NewLogger(config)
+
+	logger.V(4).Info("A debug message")
+	logger.Error(errors.New("fake error"), "An error")
+	logger.WithName("example").WithValues("int", 42).Info("With values",
+		"duration", time.Second,
+		"text", "multi\nline",
+		"coordinates", coordinatesMarshaler{x: 100, y: 200},
+	)
+
+	// Output:
+	// ts=2000-12-24T12:30:40.000000Z level=info v=4 caller=textlogger_test.go:85 msg="A debug message"
+	// ts=2000-12-24T12:30:40.000000Z level=error caller=textlogger_test.go:86 msg="An error" err="fake error"
+	// ts=2000-12-24T12:30:40.000000Z level=info v=0 caller=textlogger_test.go:87 msg="With values" logger=example int=42 duration=1s text="multi\nline" coordinates="{\"X\":100,\"Y\":200}"
+}
+
 func someHelper(logger plog.Logger, msg string) {
 	logger.WithCallDepth(1).Info(msg)
 }
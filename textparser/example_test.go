@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package textparser_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pohly/plog/v2/textparser"
+)
+
+func ExampleReader() {
+	log := `I0102 15:04:05.067890    1234 main.go:42] "starting" version="1.2.3" workers=4
+E0102 15:04:06.000000    1234 worker.go:10] "request failed" err="timeout" logger="worker" config=<
+	retries: 3
+	backoff: 1s
+ >
+W0102 15:04:07.500000    1234 main.go:50] disk almost full
+`
+	reader := textparser.NewReader(strings.NewReader(log), textparser.Year(2006))
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Printf("error: %v\n", err)
+			return
+		}
+		fmt.Printf("%s %s %s:%d %q\n", record.Time.Format("2006-01-02T15:04:05"), record.Severity, record.File, record.Line, record.Message)
+		for _, kv := range record.Values {
+			fmt.Printf("    %s: %q\n", kv.Key, kv.Value)
+		}
+	}
+
+	// Output:
+	// 2006-01-02T15:04:05 INFO main.go:42 "starting"
+	//     version: "1.2.3"
+	//     workers: "4"
+	// 2006-01-02T15:04:06 ERROR worker.go:10 "request failed"
+	//     err: "timeout"
+	//     logger: "worker"
+	//     config: "retries: 3\nbackoff: 1s"
+	// 2006-01-02T15:04:07 WARNING main.go:50 "disk almost full"
+}
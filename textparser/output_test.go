@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package textparser_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/pohly/plog/v2/test"
+	"github.com/pohly/plog/v2/textlogger"
+	"github.com/pohly/plog/v2/textparser"
+)
+
+// roundTrip parses each log entry and writes it again. The output must be the
+// same as without it.
+type roundTrip struct {
+	out io.Writer
+}
+
+func (r roundTrip) Write(p []byte) (int, error) {
+	record := textparser.Parse(p)
+	if _, err := io.WriteString(r.out, record.String()+"\n"); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newLogger(out io.Writer, v int, vmodule string) logr.Logger {
+	config := textlogger.NewConfig(
+		textlogger.Verbosity(v),
+		textlogger.Output(roundTrip{out: out}),
+	)
+	if err := config.VModule().Set(vmodule); err != nil {
+		panic(err)
+	}
+	return textlogger.NewLogger(config)
+}
+
+func TestRoundTrip(t *testing.T) {
+	test.InitKlog(t)
+	t.Run("direct", func(t *testing.T) {
+		test.Output(t, test.OutputConfig{NewLogger: newLogger, SupportsVModule: true})
+	})
+	t.Run("klog-backend", func(t *testing.T) {
+		test.Output(t, test.OutputConfig{NewLogger: newLogger, AsBackend: true})
+	})
+}
@@ -0,0 +1,594 @@
+// Copyright 2024 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package textparser turns log entries in the klog text format back into
+// structured records.
+//
+// An entry starts with a header like
+//
+//	I0102 15:04:05.067890    1234 main.go:42] "message" key="value" count=1
+//
+// The time stamp may also be in RFC 3339 format and have millisecond or
+// nanosecond precision, as configured with plog.SetHeaderOptions. After the
+// header follows either a quoted message and key/value pairs (structured
+// logging with InfoS, ErrorS or a logr.Logger) or arbitrary text (Info,
+// Infof, etc.). Values are quoted strings, multi-line strings
+//
+//	key=<
+//		line 1
+//		line 2
+//	 >
+//
+// or unquoted text, typically JSON or a number.
+//
+// The format is not fully reversible. Multi-line strings lose a trailing line
+// break, byte slices look like strings, and an unstructured message which
+// happens to look like a quoted message with key/value pairs gets parsed as
+// structured.
+//
+// The syslog and journald packages use this parser for the entries which
+// they receive through Write.
+package textparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pohly/plog/v2/internal/severity"
+)
+
+// Severity of a log entry. Its String method returns INFO, WARNING, ERROR
+// or FATAL.
+type Severity = severity.Severity
+
+// The severities in increasing order.
+const (
+	SeverityInfo    = severity.InfoLog
+	SeverityWarning = severity.WarningLog
+	SeverityError   = severity.ErrorLog
+	SeverityFatal   = severity.FatalLog
+)
+
+// Record is one parsed log entry.
+type Record struct {
+	// HasHeader is false for entries without header, for example
+	// when logging with -skip_headers. Then Severity is SeverityInfo
+	// and Time, ThreadID, File and Line are not set.
+	HasHeader bool
+
+	Severity Severity
+	Time     time.Time
+	// ThreadID is the number in the header after the time stamp.
+	ThreadID int
+	File     string
+	Line     int
+
+	// Message is the unquoted message of a structured entry or the
+	// entire text after the header of an unstructured one.
+	Message string
+
+	// Structured is true if the message was quoted and followed only by
+	// key/value pairs.
+	Structured bool
+
+	// Values contains the key/value pairs of a structured entry in the
+	// order in which they were logged. This includes "err" for errors
+	// and "logger" for the logger name.
+	Values []KeyValue
+}
+
+// Get returns the value of the last pair with the key.
+func (r Record) Get(key string) (KeyValue, bool) {
+	for i := len(r.Values) - 1; i >= 0; i-- {
+		if r.Values[i].Key == key {
+			return r.Values[i], true
+		}
+	}
+	return KeyValue{}, false
+}
+
+// Kind describes how a value was written.
+type Kind int
+
+const (
+	// KindString is a quoted string.
+	KindString Kind = iota
+	// KindMultiLine is a string which contains line breaks.
+	KindMultiLine
+	// KindRaw is unquoted text, usually JSON.
+	KindRaw
+)
+
+// KeyValue is one key/value pair.
+type KeyValue struct {
+	Key  string
+	Kind Kind
+	// Value is the unquoted string for KindString and KindMultiLine and
+	// the text as it was written for KindRaw.
+	Value string
+}
+
+// Interface returns the string for KindString and KindMultiLine. For KindRaw
+// it decodes the value as JSON, with json.Number for numbers. Values which
+// are not valid JSON are returned as string.
+func (kv KeyValue) Interface() interface{} {
+	if kv.Kind != KindRaw {
+		return kv.Value
+	}
+	decoder := json.NewDecoder(strings.NewReader(kv.Value))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		return kv.Value
+	}
+	return value
+}
+
+// String formats the record in the klog text format, without a trailing
+// line break. The header uses microsecond precision.
+func (r Record) String() string {
+	var b bytes.Buffer
+	if r.HasHeader {
+		s := r.Severity
+		if s < 0 || int(s) >= len(severity.Char) {
+			s = SeverityInfo
+		}
+		b.WriteByte(severity.Char[s])
+		b.WriteString(r.Time.Format("0102 15:04:05.000000"))
+		b.WriteByte(' ')
+		id := strconv.Itoa(r.ThreadID)
+		for i := len(id); i < 7; i++ {
+			b.WriteByte(' ')
+		}
+		b.WriteString(id)
+		b.WriteByte(' ')
+		b.WriteString(r.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(r.Line))
+		b.WriteString("] ")
+	}
+	if !r.Structured {
+		b.WriteString(r.Message)
+		return b.String()
+	}
+	b.WriteString(strconv.Quote(r.Message))
+	for _, kv := range r.Values {
+		b.WriteByte(' ')
+		b.WriteString(kv.Key)
+		b.WriteByte('=')
+		switch kv.Kind {
+		case KindString:
+			b.WriteString(strconv.Quote(kv.Value))
+		case KindMultiLine:
+			b.WriteString("<\n")
+			for _, line := range strings.Split(kv.Value, "\n") {
+				b.WriteByte('\t')
+				b.WriteString(line)
+				b.WriteByte('\n')
+			}
+			b.WriteString(" >")
+		default:
+			b.WriteString(kv.Value)
+		}
+	}
+	return b.String()
+}
+
+type config struct {
+	year     int
+	location *time.Location
+	follow   bool
+}
+
+// Option implements functional parameters for Parse and NewReader.
+type Option func(*config)
+
+// Year sets the year for time stamps without it. The default is the current
+// year, or the previous one if the time stamp would be more than a day in the
+// future.
+func Year(year int) Option {
+	return func(c *config) {
+		c.year = year
+	}
+}
+
+// Location sets the time zone for time stamps without it. The default is
+// time.Local.
+func Location(loc *time.Location) Option {
+	return func(c *config) {
+		c.location = loc
+	}
+}
+
+// Follow is for a Reader on a file that is still being written. Then
+// continuation lines of the last entry may get appended later, so Next keeps
+// that entry until the next entry starts. Flush returns it when waiting
+// longer makes no sense. Parse ignores this option.
+func Follow() Option {
+	return func(c *config) {
+		c.follow = true
+	}
+}
+
+// timeNow can be replaced by tests.
+var timeNow = time.Now
+
+func newConfig(opts []Option) config {
+	c := config{location: time.Local}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Parse parses a single log entry, which may span multiple lines. A trailing
+// line break is ignored. Text that cannot be parsed ends up in the message of
+// an unstructured record.
+func Parse(data []byte, opts ...Option) Record {
+	c := newConfig(opts)
+	return c.parse(strings.TrimSuffix(string(data), "\n"))
+}
+
+// Reader reads log entries from a stream.
+type Reader struct {
+	in     *bufio.Reader
+	config config
+
+	// next is the first line of the next entry, if already read.
+	next    string
+	hasNext bool
+	// pending is an entry that was held back at the end of the stream.
+	pending    string
+	hasPending bool
+	withHeader bool
+	// err is a permanent error.
+	err error
+}
+
+// NewReader creates a reader for the stream.
+func NewReader(in io.Reader, opts ...Option) *Reader {
+	return &Reader{
+		in:     bufio.NewReader(in),
+		config: newConfig(opts),
+	}
+}
+
+// Next returns the next record. At the end of the stream, the error is
+// io.EOF. Next may be called again afterwards, which is useful when reading
+// from a file that is still growing. All other errors are permanent.
+//
+// Lines which do not start with a header are added to the previous entry if
+// it has a header, because they are the continuation of a message with line
+// breaks. Otherwise, each of those lines is a record of its own. With Follow,
+// the last entry is only returned once the next one starts or by Flush.
+func (r *Reader) Next() (Record, error) {
+	if !r.hasPending {
+		text, err := r.readLine()
+		if err != nil {
+			return Record{}, err
+		}
+		_, _, r.withHeader = r.config.parseHeader(text)
+		r.pending, r.hasPending = text, true
+	}
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			if r.config.follow && errors.Is(err, io.EOF) {
+				return Record{}, err
+			}
+			break
+		}
+		if !r.continues(line, r.withHeader) {
+			r.next, r.hasNext = line, true
+			break
+		}
+		r.pending += "\n" + line
+	}
+	record, _ := r.Flush()
+	return record, nil
+}
+
+// Flush returns the entry that Next is holding back, if there is one.
+func (r *Reader) Flush() (Record, bool) {
+	if !r.hasPending {
+		return Record{}, false
+	}
+	text := r.pending
+	r.pending, r.hasPending = "", false
+	return r.config.parse(text), true
+}
+
+// continues determines whether the line belongs to the current entry.
+func (r *Reader) continues(line string, withHeader bool) bool {
+	if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, " >") {
+		// Inside a multi-line value.
+		return true
+	}
+	if _, _, ok := r.config.parseHeader(line); ok {
+		return false
+	}
+	return withHeader
+}
+
+// readLine returns the next line without the line break. A line without
+// line break at the end of the stream is also returned.
+func (r *Reader) readLine() (string, error) {
+	if r.hasNext {
+		r.hasNext = false
+		return r.next, nil
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	line, err := r.in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	if line != "" {
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+	return "", err
+}
+
+// parse turns one entry without the trailing line break into a record.
+func (c *config) parse(text string) Record {
+	record, body, ok := c.parseHeader(text)
+	if !ok {
+		record, body = Record{}, text
+	}
+	record.Message = body
+	if msg, values, ok := parseStructured(body); ok {
+		record.Structured = true
+		record.Message = msg
+		record.Values = values
+	}
+	return record
+}
+
+// parseHeader parses "Lmmdd hh:mm:ss.uuuuuu threadid file:line] " or
+// "L<RFC 3339 time stamp> threadid file:line] " and returns the record
+// with the header fields and the remaining text.
+func (c *config) parseHeader(text string) (Record, string, bool) {
+	firstLine := text
+	if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+		firstLine = text[:newline]
+	}
+	end := strings.Index(firstLine, "] ")
+	if end < 0 {
+		if !strings.HasSuffix(firstLine, "]") {
+			return Record{}, "", false
+		}
+		// Empty message and no key/value pairs, with trailing
+		// spaces removed.
+		end = len(firstLine) - 1
+	}
+	fields := strings.Fields(firstLine[:end])
+	if len(fields) < 3 || len(fields[0]) < 5 {
+		return Record{}, "", false
+	}
+	s := strings.IndexByte(severity.Char, fields[0][0])
+	if s < 0 {
+		return Record{}, "", false
+	}
+	record := Record{HasHeader: true, Severity: Severity(s)}
+	if len(fields[0]) == 5 {
+		if len(fields) != 4 {
+			return Record{}, "", false
+		}
+		t, ok := c.parseTime(fields[0][1:], fields[1])
+		if !ok {
+			return Record{}, "", false
+		}
+		record.Time = t
+		fields = fields[2:]
+	} else {
+		if len(fields) != 3 {
+			return Record{}, "", false
+		}
+		t, err := time.Parse(time.RFC3339Nano, fields[0][1:])
+		if err != nil {
+			return Record{}, "", false
+		}
+		record.Time = t
+		fields = fields[1:]
+	}
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Record{}, "", false
+	}
+	record.ThreadID = id
+	colon := strings.LastIndexByte(fields[1], ':')
+	if colon <= 0 {
+		return Record{}, "", false
+	}
+	line, err := strconv.Atoi(fields[1][colon+1:])
+	if err != nil {
+		return Record{}, "", false
+	}
+	record.File, record.Line = fields[1][:colon], line
+	if end+2 > len(text) {
+		return record, "", true
+	}
+	return record, text[end+2:], true
+}
+
+// parseTime parses "mmdd" and "hh:mm:ss.uuuuuu", with an arbitrary number of
+// digits for the fractions of a second.
+func (c *config) parseTime(date, clock string) (time.Time, bool) {
+	month, err := strconv.Atoi(date[0:2])
+	if err != nil || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	day, err := strconv.Atoi(date[2:4])
+	if err != nil || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("15:04:05.999999999", clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	year := c.year
+	if year == 0 {
+		now := timeNow().In(c.location)
+		year = now.Year()
+		if date := time.Date(year, time.Month(month), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), c.location); date.Sub(now) > 24*time.Hour {
+			// Probably written last year.
+			year--
+		}
+	}
+	return time.Date(year, time.Month(month), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), c.location), true
+}
+
+// parseStructured parses a quoted message and key/value pairs.
+func parseStructured(text string) (string, []KeyValue, bool) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", nil, false
+	}
+	quoted, err := strconv.QuotedPrefix(text)
+	if err != nil {
+		return "", nil, false
+	}
+	msg, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", nil, false
+	}
+	var values []KeyValue
+	for text = text[len(quoted):]; text != ""; {
+		kv, rest, ok := parseKV(text)
+		if !ok {
+			return "", nil, false
+		}
+		values = append(values, kv)
+		text = rest
+	}
+	return msg, values, true
+}
+
+// parseKV parses one key/value pair with a leading space, in the format
+// written by plog.
+func parseKV(text string) (KeyValue, string, bool) {
+	if !strings.HasPrefix(text, " ") {
+		return KeyValue{}, "", false
+	}
+	text = text[1:]
+	eq := keyEnd(text)
+	if eq <= 0 {
+		return KeyValue{}, "", false
+	}
+	kv := KeyValue{Key: text[:eq]}
+	text = text[eq+1:]
+
+	switch {
+	case strings.HasPrefix(text, `"`):
+		quoted, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return KeyValue{}, "", false
+		}
+		kv.Kind = KindString
+		kv.Value, _ = strconv.Unquote(quoted)
+		return kv, text[len(quoted):], true
+	case strings.HasPrefix(text, "<\n"):
+		// Multi-line string, each line is indented with a tab.
+		end := strings.Index(text, "\n >")
+		if end < 0 {
+			return KeyValue{}, "", false
+		}
+		lines := strings.Split(text[2:end], "\n")
+		for i, line := range lines {
+			if !strings.HasPrefix(line, "\t") {
+				return KeyValue{}, "", false
+			}
+			lines[i] = line[1:]
+		}
+		kv.Kind = KindMultiLine
+		kv.Value = strings.Join(lines, "\n")
+		return kv, text[end+3:], true
+	case strings.HasPrefix(text, "{"), strings.HasPrefix(text, "["):
+		end := matchBracket(text)
+		if end < 0 {
+			return KeyValue{}, "", false
+		}
+		kv.Kind = KindRaw
+		kv.Value = text[:end]
+		return kv, text[end:], true
+	default:
+		end := strings.IndexAny(text, " \n")
+		if end < 0 {
+			end = len(text)
+		}
+		kv.Kind = KindRaw
+		kv.Value = text[:end]
+		return kv, text[end:], true
+	}
+}
+
+// keyEnd returns the index of the equal sign after the key. Keys which are
+// not strings get formatted with %s, which can produce things like
+// "%!s(int=1)" or "map[a:1]", therefore an equal sign inside brackets is
+// skipped. It returns -1 if there is no equal sign before a space or line
+// break.
+func keyEnd(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		case '=':
+			if depth == 0 {
+				return i
+			}
+		case ' ', '\n':
+			if depth == 0 {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// matchBracket returns the index after the bracket which closes the one at
+// the start of the text, skipping over JSON strings. It returns -1 if there
+// is none.
+func matchBracket(text string) int {
+	depth := 0
+	inString := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
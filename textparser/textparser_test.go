@@ -0,0 +1,316 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package textparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixedTime(t *testing.T) {
+	t.Cleanup(func() { timeNow = time.Now })
+	timeNow = func() time.Time {
+		return time.Date(2006, 6, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+func TestParse(t *testing.T) {
+	fixedTime(t)
+	ts := time.Date(2006, 1, 2, 15, 4, 5, 67890000, time.UTC)
+	for name, tc := range map[string]struct {
+		text     string
+		expected Record
+	}{
+		"structured": {
+			text: `E0102 15:04:05.067890    1234 main.go:42] "hello \"world\"" err="fail" count=1 obj={"name":"a]b","ns":"c"} list=[1 2] logger="foo.bar"` + "\n",
+			expected: Record{
+				HasHeader:  true,
+				Severity:   SeverityError,
+				Time:       ts,
+				ThreadID:   1234,
+				File:       "main.go",
+				Line:       42,
+				Message:    `hello "world"`,
+				Structured: true,
+				Values: []KeyValue{
+					{Key: "err", Value: "fail"},
+					{Key: "count", Kind: KindRaw, Value: "1"},
+					{Key: "obj", Kind: KindRaw, Value: `{"name":"a]b","ns":"c"}`},
+					{Key: "list", Kind: KindRaw, Value: "[1 2]"},
+					{Key: "logger", Value: "foo.bar"},
+				},
+			},
+		},
+		"multi-line": {
+			text: "W0102 15:04:05.067890    1234 main.go:42] \"msg\" text=<\n\tline 1\n\t\n\tline 3\n > a=1\n",
+			expected: Record{
+				HasHeader:  true,
+				Severity:   SeverityWarning,
+				Time:       ts,
+				ThreadID:   1234,
+				File:       "main.go",
+				Line:       42,
+				Message:    "msg",
+				Structured: true,
+				Values: []KeyValue{
+					{Key: "text", Kind: KindMultiLine, Value: "line 1\n\nline 3"},
+					{Key: "a", Kind: KindRaw, Value: "1"},
+				},
+			},
+		},
+		"bytes": {
+			text: `I0102 15:04:05.067890    1234 main.go:42] "msg" data=` + fmt.Sprintf("%+q", []byte("a\x00\nä")) + "\n",
+			expected: Record{
+				HasHeader:  true,
+				Time:       ts,
+				ThreadID:   1234,
+				File:       "main.go",
+				Line:       42,
+				Message:    "msg",
+				Structured: true,
+				Values:     []KeyValue{{Key: "data", Value: "a\x00\nä"}},
+			},
+		},
+		"non-string keys": {
+			text: `I0102 15:04:05.067890    1234 main.go:42] "msg" %!s(int=1)="value" map[test:%!s(bool=true)]="test" {name}=1` + "\n",
+			expected: Record{
+				HasHeader:  true,
+				Time:       ts,
+				ThreadID:   1234,
+				File:       "main.go",
+				Line:       42,
+				Message:    "msg",
+				Structured: true,
+				Values: []KeyValue{
+					{Key: "%!s(int=1)", Value: "value"},
+					{Key: "map[test:%!s(bool=true)]", Value: "test"},
+					{Key: "{name}", Kind: KindRaw, Value: "1"},
+				},
+			},
+		},
+		"rfc3339": {
+			text: "F2006-01-02T15:04:05.067890123+02:00 42 pkg/main.go:42] \"hello\"\n",
+			expected: Record{
+				HasHeader:  true,
+				Severity:   SeverityFatal,
+				Time:       time.Date(2006, 1, 2, 13, 4, 5, 67890123, time.UTC),
+				ThreadID:   42,
+				File:       "pkg/main.go",
+				Line:       42,
+				Message:    "hello",
+				Structured: true,
+			},
+		},
+		"milliseconds": {
+			text: "I0102 15:04:05.067    1234 main.go:42] hello\n",
+			expected: Record{
+				HasHeader: true,
+				Time:      time.Date(2006, 1, 2, 15, 4, 5, 67000000, time.UTC),
+				ThreadID:  1234,
+				File:      "main.go",
+				Line:      42,
+				Message:   "hello",
+			},
+		},
+		"last-year": {
+			text: "I1231 23:59:59.000000    1234 main.go:42] hello\n",
+			expected: Record{
+				HasHeader: true,
+				Time:      time.Date(2005, 12, 31, 23, 59, 59, 0, time.UTC),
+				ThreadID:  1234,
+				File:      "main.go",
+				Line:      42,
+				Message:   "hello",
+			},
+		},
+		"unstructured": {
+			text: "I0102 15:04:05.067890    1234 main.go:42] hello world\nsecond line\n",
+			expected: Record{
+				HasHeader: true,
+				Time:      ts,
+				ThreadID:  1234,
+				File:      "main.go",
+				Line:      42,
+				Message:   "hello world\nsecond line",
+			},
+		},
+		"empty": {
+			text: "I0102 15:04:05.067890    1234 main.go:42] \n",
+			expected: Record{
+				HasHeader: true,
+				Time:      ts,
+				ThreadID:  1234,
+				File:      "main.go",
+				Line:      42,
+			},
+		},
+		"no-header": {
+			text: "\"hello world\" a=1\n",
+			expected: Record{
+				Message:    "hello world",
+				Structured: true,
+				Values:     []KeyValue{{Key: "a", Kind: KindRaw, Value: "1"}},
+			},
+		},
+		"invalid-header": {
+			text: "I1302 15:04:05.067890    1234 main.go:42] hello\n",
+			expected: Record{
+				Message: "I1302 15:04:05.067890    1234 main.go:42] hello",
+			},
+		},
+		"unparsable": {
+			text: `F0102 15:04:05.067890    1234 main.go:42] "msg" a=1 map[x:1 y:2]`,
+			expected: Record{
+				HasHeader: true,
+				Severity:  SeverityFatal,
+				Time:      ts,
+				ThreadID:  1234,
+				File:      "main.go",
+				Line:      42,
+				Message:   `"msg" a=1 map[x:1 y:2]`,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual := Parse([]byte(tc.text), Location(time.UTC))
+			if !actual.Time.Equal(tc.expected.Time) {
+				t.Errorf("expected time %s, got %s", tc.expected.Time, actual.Time)
+			}
+			actual.Time, tc.expected.Time = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("unexpected record:\n%+v\nexpected:\n%+v", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	input := `I0102 15:04:05.067890    1234 main.go:1] "first" text=<
+	a
+	b
+ >
+I0102 15:04:05.067890    1234 main.go:2] multi
+line
+message
+garbage before entry
+W0102 15:04:05.067890    1234 main.go:3] "third"`
+	reader := NewReader(strings.NewReader("garbage before entry\n"+input), Year(2006))
+	var actual []string
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		actual = append(actual, record.String())
+	}
+	expected := []string{
+		"garbage before entry",
+		"I0102 15:04:05.067890    1234 main.go:1] \"first\" text=<\n\ta\n\tb\n >",
+		"I0102 15:04:05.067890    1234 main.go:2] multi\nline\nmessage\ngarbage before entry",
+		`W0102 15:04:05.067890    1234 main.go:3] "third"`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected records:\n%q\nexpected:\n%q", actual, expected)
+	}
+}
+
+func TestInterface(t *testing.T) {
+	for _, tc := range []struct {
+		kv       KeyValue
+		expected string
+	}{
+		{kv: KeyValue{Value: "1"}, expected: `"1"`},
+		{kv: KeyValue{Kind: KindRaw, Value: "1"}, expected: `1`},
+		{kv: KeyValue{Kind: KindRaw, Value: `{"a":[1,true,null]}`}, expected: `{"a":[1,true,null]}`},
+		{kv: KeyValue{Kind: KindRaw, Value: `1 2`}, expected: `"1 2"`},
+		{kv: KeyValue{Kind: KindRaw, Value: `map[x:1]`}, expected: `"map[x:1]"`},
+	} {
+		actual, err := json.Marshal(tc.kv.Interface())
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", tc.kv, err)
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("%+v: expected %s, got %s", tc.kv, tc.expected, actual)
+		}
+	}
+}
+
+func TestReaderGrowing(t *testing.T) {
+	// A bytes.Buffer returns io.EOF when empty and can be filled again.
+	var buffer bytes.Buffer
+	reader := NewReader(&buffer, Year(2006))
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	buffer.WriteString("I0102 15:04:05.067890    1234 main.go:1] \"first\"\n")
+	record, err := reader.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Message != "first" {
+		t.Errorf("expected first record, got %+v", record)
+	}
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	buffer.WriteString("I0102 15:04:05.067890    1234 main.go:2] \"second\"\n")
+	record, err = reader.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Message != "second" {
+		t.Errorf("expected second record, got %+v", record)
+	}
+}
+
+func TestReaderFollow(t *testing.T) {
+	var buffer bytes.Buffer
+	reader := NewReader(&buffer, Year(2006), Follow())
+	buffer.WriteString("I0102 15:04:05.067890    1234 main.go:1] first\n")
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF while holding the entry, got %v", err)
+	}
+	// The continuation arrives after the end of the stream was reached.
+	buffer.WriteString("line two\nI0102 15:04:05.067890    1234 main.go:2] second\n")
+	record, err := reader.Next()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record.Message != "first\nline two" {
+		t.Errorf("expected first record with continuation, got %+v", record)
+	}
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF while holding the entry, got %v", err)
+	}
+	record, ok := reader.Flush()
+	if !ok || record.Message != "second" {
+		t.Errorf("expected second record from Flush, got %+v, %v", record, ok)
+	}
+	if _, ok := reader.Flush(); ok {
+		t.Error("expected nothing to flush")
+	}
+}